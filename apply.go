@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// applyFieldManager owns the fields set by apply_manifest
+const applyFieldManager = "kuadrant-mcp-server"
+
+// applyGroups are the API groups apply_manifest writes to, those of the
+// objects the create_* tools generate
+var applyGroups = []string{"gateway.networking.k8s.io", "kuadrant.io", "cert-manager.io"}
+
+type ApplyManifestParams struct {
+	Manifest string `json:"manifest" jsonschema:"YAML manifest to apply, may contain several documents separated by ---"`
+	Confirm  bool   `json:"confirm,omitempty" jsonschema:"Apply for real instead of a server-side dry run; only honoured when the server allows writes (default: false)"`
+	Force    bool   `json:"force,omitempty" jsonschema:"Take ownership of fields managed by other field managers instead of reporting conflicts (default: false)"`
+}
+
+// fieldConflict is a field another field manager owns
+type fieldConflict struct {
+	Field   string `yaml:"field"`
+	Manager string `yaml:"manager,omitempty"`
+	Message string `yaml:"message"`
+}
+
+type applyResult struct {
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Action is what the apply does to the live object: created or configured
+	Action string `yaml:"action,omitempty"`
+	// Outcome is Accepted (dry run), Applied, Conflict or Rejected
+	Outcome   string          `yaml:"outcome"`
+	Reason    string          `yaml:"reason,omitempty"`
+	Message   string          `yaml:"message,omitempty"`
+	Causes    []string        `yaml:"causes,omitempty"`
+	Conflicts []fieldConflict `yaml:"conflicts,omitempty"`
+}
+
+// parseManifests splits a multi-document YAML manifest into objects,
+// expanding any lists
+func parseManifests(manifest string) ([]*unstructured.Unstructured, error) {
+	objects, err := decodeManifests(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("manifest has no objects")
+	}
+	return objects, nil
+}
+
+// decodeManifests is parseManifests without the check that there is at
+// least one object, for files such as an empty kubectl get -o yaml list
+func decodeManifests(manifest string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		data, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if string(data) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		// expand lists such as the output of kubectl get -o yaml
+		items := []*unstructured.Unstructured{obj}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+			items = items[:0]
+			for j := range list.Items {
+				items = append(items, &list.Items[j])
+			}
+		}
+		for _, item := range items {
+			if item.GetName() == "" {
+				return nil, fmt.Errorf("document %d: metadata.name is required", i)
+			}
+			objects = append(objects, item)
+		}
+	}
+	return objects, nil
+}
+
+func (c *clusterClient) applyManifestHandler(ctx context.Context, params ApplyManifestParams) (string, error) {
+	if params.Confirm && !c.allowWrites {
+		return "Error: this server is read-only; start it with -allow-writes to apply manifests for real, or omit confirm for a dry run", nil
+	}
+	objects, err := parseManifests(params.Manifest)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid manifest: %v", err), nil
+	}
+	c.defaultNamespace(ctx, objects)
+	// a tenant with allowedNamespaces can only write to them
+	if allowed := tenantNamespaces(ctx); len(allowed) > 0 {
+		for _, obj := range objects {
+			if ns := obj.GetNamespace(); ns != "" && !slices.Contains(allowed, ns) {
+				return fmt.Sprintf("Error: %s %s is in namespace %s; this tenant can only apply to %s", obj.GetKind(), obj.GetName(), ns, strings.Join(allowed, ", ")), nil
+			}
+		}
+	}
+
+	// organisation guardrails apply to anything reaching the cluster, not
+	// only to manifests the tools generated
+	var violations guardrailError
+	for _, obj := range objects {
+		var ge *guardrailError
+		if err := guardrails.check(ctx, obj.Object); errors.As(err, &ge) {
+			violations.Violations = append(violations.Violations, ge.Violations...)
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if len(violations.Violations) > 0 {
+		return "", &violations
+	}
+
+	dryRun := !params.Confirm
+	results := make([]applyResult, 0, len(objects))
+	for _, obj := range objects {
+		results = append(results, c.apply(ctx, obj, dryRun, params.Force))
+	}
+	return renderSummary(map[string]interface{}{
+		"dryRun":  dryRun,
+		"results": results,
+	})
+}
+
+// apply server-side applies one object and reports what admission made of it
+func (c *clusterClient) apply(ctx context.Context, obj *unstructured.Unstructured, dryRun, force bool) applyResult {
+	result := applyResult{Kind: obj.GetKind(), Name: obj.GetName(), Namespace: obj.GetNamespace()}
+
+	// only namespaced kinds of the groups the create_* tools generate can
+	// be applied
+	gvk := obj.GroupVersionKind()
+	res, namespaced, err := c.resourceFor(obj)
+	switch {
+	case !slices.Contains(applyGroups, gvk.Group):
+		err = fmt.Errorf("%s is not a Gateway API, Kuadrant or cert-manager kind; only those can be applied", gvk.GroupKind())
+	case err == nil && !namespaced:
+		err = fmt.Errorf("%s is cluster-scoped; only namespaced objects can be applied", gvk.Kind)
+	}
+	if err != nil {
+		result.Outcome = "Rejected"
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Action = "configured"
+	if _, err := res.Get(ctx, obj.GetName(), metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		result.Action = "created"
+	}
+
+	opts := metav1.ApplyOptions{FieldManager: applyFieldManager, Force: force}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	_, err = res.Apply(ctx, obj.GetName(), obj, opts)
+	switch {
+	case err == nil && dryRun:
+		result.Outcome = "Accepted"
+	case err == nil:
+		result.Outcome = "Applied"
+	case apierrors.IsConflict(err):
+		result.Outcome = "Conflict"
+		result.Reason = string(apierrors.ReasonForError(err))
+		result.Conflicts = fieldConflicts(err)
+	default:
+		result.Outcome = "Rejected"
+		result.Reason = string(apierrors.ReasonForError(err))
+		result.Message = err.Error()
+		var status apierrors.APIStatus
+		if errors.As(err, &status) && status.Status().Details != nil {
+			for _, cause := range status.Status().Details.Causes {
+				result.Causes = append(result.Causes, fmt.Sprintf("%s: %s", cause.Field, cause.Message))
+			}
+		}
+	}
+	return result
+}
+
+// resourceFor returns the client for an object's kind at its API version,
+// scoped to its namespace if the kind is namespaced, and whether it is
+func (c *clusterClient) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, bool, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, false, fmt.Errorf("%s is not installed in the cluster", gvk)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource), false, nil
+	}
+	if obj.GetNamespace() == "" {
+		return nil, true, errors.New("metadata.namespace is required")
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace()), true, nil
+}
+
+// defaultNamespace puts objects of namespaced kinds that have no
+// namespace in the caller's default namespace, as the create_* tools do
+func (c *clusterClient) defaultNamespace(ctx context.Context, objects []*unstructured.Unstructured) {
+	namespace := toolDefaultsFrom(ctx).Namespace
+	if namespace == "" {
+		return
+	}
+	for _, obj := range objects {
+		if obj.GetNamespace() != "" {
+			continue
+		}
+		gvk := obj.GroupVersionKind()
+		if mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil && mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			obj.SetNamespace(namespace)
+		}
+	}
+}
+
+// conflictManager extracts the field manager from messages such as
+// `conflict with "kubectl" using kuadrant.io/v1`
+var conflictManager = regexp.MustCompile(`conflict with "([^"]+)"`)
+
+// fieldConflicts lists the fields an apply conflicted on
+func fieldConflicts(err error) []fieldConflict {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return []fieldConflict{{Message: err.Error()}}
+	}
+	var conflicts []fieldConflict
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflict := fieldConflict{Field: cause.Field, Message: cause.Message}
+		if m := conflictManager.FindStringSubmatch(cause.Message); m != nil {
+			conflict.Manager = m[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
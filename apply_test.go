@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testRoute = `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: store
+  namespace: shop
+spec:
+  parentRefs:
+    - name: external
+`
+
+type applyOutput struct {
+	DryRun  bool          `yaml:"dryRun"`
+	Results []applyResult `yaml:"results"`
+}
+
+// applyActions returns the server-side apply patches the fake client saw
+func applyActions(actions []k8stesting.Action) []k8stesting.PatchAction {
+	var patches []k8stesting.PatchAction
+	for _, action := range actions {
+		if patch, ok := action.(k8stesting.PatchAction); ok && patch.GetPatchType() == types.ApplyPatchType {
+			patches = append(patches, patch)
+		}
+	}
+	return patches
+}
+
+// acceptApply answers server-side applies as an API server accepting the
+// object would; the fake's tracker can't apply objects that don't exist
+func acceptApply(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(action.(k8stesting.PatchAction).GetPatch()); err != nil {
+		return true, nil, err
+	}
+	return true, obj, nil
+}
+
+func TestApplyManifestHandler(t *testing.T) {
+	conflict := func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Field:   ".spec.parentRefs",
+			Message: `conflict with "kubectl" using gateway.networking.k8s.io/v1`,
+		}}, "Apply failed with 1 conflict")
+	}
+
+	tests := []struct {
+		name        string
+		manifest    string
+		params      ApplyManifestParams
+		tenant      *tenantConfig
+		defaults    toolDefaults
+		allowWrites bool
+		existing    []runtime.Object
+		reactor     k8stesting.ReactionFunc
+		// want is the outcome and action of each object, or the error
+		want   []string
+		errMsg string
+		// message is the first result's message
+		message  string
+		applies  int
+		dryRun   bool
+		conflict *fieldConflict
+	}{
+		{
+			name:     "dry run of a new object",
+			manifest: testRoute,
+			want:     []string{"Accepted created"},
+			applies:  1,
+			dryRun:   true,
+		},
+		{
+			name:     "dry run of an existing object",
+			manifest: testRoute,
+			existing: []runtime.Object{newObject("gateway.networking.k8s.io/v1", "HTTPRoute", "shop", "store", nil)},
+			want:     []string{"Accepted configured"},
+			applies:  1,
+			dryRun:   true,
+		},
+		{
+			name:     "conflict",
+			manifest: testRoute,
+			reactor:  conflict,
+			want:     []string{"Conflict created"},
+			applies:  1,
+			dryRun:   true,
+			conflict: &fieldConflict{Field: ".spec.parentRefs", Manager: "kubectl", Message: `conflict with "kubectl" using gateway.networking.k8s.io/v1`},
+		},
+		{
+			name:     "confirm without allow-writes",
+			manifest: testRoute,
+			params:   ApplyManifestParams{Confirm: true},
+			errMsg:   "Error: this server is read-only",
+		},
+		{
+			name:        "confirm with allow-writes",
+			manifest:    testRoute,
+			params:      ApplyManifestParams{Confirm: true},
+			allowWrites: true,
+			want:        []string{"Applied created"},
+			applies:     1,
+		},
+		{
+			name:     "kinds outside the generated groups",
+			manifest: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: creds\n  namespace: shop\n",
+			want:     []string{"Rejected "},
+			message:  "Secret is not a Gateway API, Kuadrant or cert-manager kind; only those can be applied",
+			dryRun:   true,
+		},
+		{
+			name:     "cluster-scoped kinds",
+			manifest: "apiVersion: gateway.networking.k8s.io/v1\nkind: GatewayClass\nmetadata:\n  name: istio\n",
+			defaults: toolDefaults{Namespace: "shop"},
+			want:     []string{"Rejected "},
+			message:  "GatewayClass is cluster-scoped; only namespaced objects can be applied",
+			dryRun:   true,
+		},
+		{
+			name:     "default namespace fills in a missing namespace",
+			manifest: strings.Replace(testRoute, "  namespace: shop\n", "", 1),
+			defaults: toolDefaults{Namespace: "shop"},
+			want:     []string{"Accepted created"},
+			applies:  1,
+			dryRun:   true,
+		},
+		{
+			name:     "missing namespace without a default",
+			manifest: strings.Replace(testRoute, "  namespace: shop\n", "", 1),
+			want:     []string{"Rejected "},
+			message:  "metadata.namespace is required",
+			dryRun:   true,
+		},
+		{
+			name:     "default namespace doesn't restrict writes",
+			manifest: testRoute,
+			defaults: toolDefaults{Namespace: "team-b"},
+			tenant:   &tenantConfig{toolDefaults: toolDefaults{Namespace: "team-b"}},
+			want:     []string{"Accepted created"},
+			applies:  1,
+			dryRun:   true,
+		},
+		{
+			name:     "allowed namespaces",
+			manifest: testRoute,
+			tenant:   &tenantConfig{AllowedNamespaces: []string{"team-b", "shop"}},
+			want:     []string{"Accepted created"},
+			applies:  1,
+			dryRun:   true,
+		},
+		{
+			name:     "allowed namespaces refuse other namespaces",
+			manifest: testRoute,
+			tenant:   &tenantConfig{AllowedNamespaces: []string{"team-b", "team-c"}},
+			errMsg:   "Error: HTTPRoute store is in namespace shop; this tenant can only apply to team-b, team-c",
+		},
+		{
+			name:     "allowed namespaces check the default namespace",
+			manifest: strings.Replace(testRoute, "  namespace: shop\n", "", 1),
+			defaults: toolDefaults{Namespace: "shop"},
+			tenant:   &tenantConfig{AllowedNamespaces: []string{"team-b"}},
+			errMsg:   "Error: HTTPRoute store is in namespace shop; this tenant can only apply to team-b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dyn := newFakeCluster(tt.existing...)
+			c.allowWrites = tt.allowWrites
+			reactor := tt.reactor
+			if reactor == nil {
+				reactor = acceptApply
+			}
+			dyn.PrependReactor("patch", "*", reactor)
+			params := tt.params
+			params.Manifest = tt.manifest
+
+			ctx := withToolDefaults(context.Background(), tt.defaults)
+			if tt.tenant != nil {
+				ctx = context.WithValue(ctx, tenantKey{}, tt.tenant)
+			}
+			out, err := c.applyManifestHandler(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(applyActions(dyn.Actions())); got != tt.applies {
+				t.Errorf("got %d applies, want %d", got, tt.applies)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+
+			var result applyOutput
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if result.DryRun != tt.dryRun {
+				t.Errorf("dryRun = %v, want %v", result.DryRun, tt.dryRun)
+			}
+			var got []string
+			for _, r := range result.Results {
+				got = append(got, r.Outcome+" "+r.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("results = %v, want %v\n%s", got, tt.want, out)
+			}
+			if tt.message != "" && result.Results[0].Message != tt.message {
+				t.Errorf("message = %q, want %q", result.Results[0].Message, tt.message)
+			}
+			if tt.conflict != nil {
+				if len(result.Results[0].Conflicts) != 1 || result.Results[0].Conflicts[0] != *tt.conflict {
+					t.Errorf("conflicts = %+v, want %+v", result.Results[0].Conflicts, *tt.conflict)
+				}
+			}
+		})
+	}
+}
+
+func TestResourceFor(t *testing.T) {
+	tests := []struct {
+		manifest   string
+		namespaced bool
+		errMsg     string
+	}{
+		{testRoute, true, ""},
+		{"apiVersion: v1\nkind: Secret\nmetadata:\n  name: creds\n  namespace: shop\n", true, ""},
+		{"apiVersion: gateway.networking.k8s.io/v1\nkind: GatewayClass\nmetadata:\n  name: istio\n", false, ""},
+		{strings.Replace(testRoute, "  namespace: shop\n", "", 1), true, "metadata.namespace is required"},
+		{"apiVersion: kuadrant.io/v1\nkind: DNSPolicy\nmetadata:\n  name: dns\n  namespace: shop\n", false, "kuadrant.io/v1, Kind=DNSPolicy is not installed"},
+	}
+	c, _ := newFakeCluster()
+	for _, tt := range tests {
+		objects, err := parseManifests(tt.manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, namespaced, err := c.resourceFor(objects[0])
+		switch {
+		case tt.errMsg == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", objects[0].GetKind(), err)
+		case tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)):
+			t.Errorf("%s: error %v, want %q", objects[0].GetKind(), err, tt.errMsg)
+		case namespaced != tt.namespaced:
+			t.Errorf("%s: namespaced = %v, want %v", objects[0].GetKind(), namespaced, tt.namespaced)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/oauthex"
+)
+
+// Authentication modes for the SSE and StreamableHTTP transports
+const (
+	authNone  = "none"
+	authToken = "token"
+	authMTLS  = "mtls"
+	authOAuth = "oauth"
+)
+
+// protectedResourcePath is where OAuth protected resource metadata is
+// served (RFC 9728)
+const protectedResourcePath = "/.well-known/oauth-protected-resource"
+
+// authConfig selects how SSE and StreamableHTTP clients authenticate
+type authConfig struct {
+	mode       string
+	tokensFile string // token: file of static bearer tokens
+	clientCA   string // mtls: PEM bundle client certificates must chain to
+	jwksFile   string // oauth: JSON Web Key Set of the authorization server
+	issuer     string // oauth: expected token issuer
+	audience   string // oauth: canonical URI of this server, expected in aud
+	scopes     string // oauth: comma separated scopes every token must carry
+}
+
+// install registers next on mux behind the configured authentication,
+// along with any discovery endpoints clients need to obtain credentials.
+// Requests are rejected before they reach the MCP handler, so no session
+// is created for unauthenticated clients.
+func (c authConfig) install(mux *http.ServeMux, next http.Handler) error {
+	switch c.mode {
+	case "", authNone:
+		mux.Handle("/", next)
+
+	case authToken:
+		if c.tokensFile == "" {
+			return fmt.Errorf("-auth-tokens-file is required with -auth %s", authToken)
+		}
+		tokens, err := loadTokens(c.tokensFile)
+		if err != nil {
+			return err
+		}
+		mux.Handle("/", auth.RequireBearerToken(tokens.verify, nil)(next))
+
+	case authMTLS:
+		if c.clientCA == "" {
+			return fmt.Errorf("-auth-client-ca or -tls-client-ca is required with -auth %s", authMTLS)
+		}
+		mux.Handle("/", requireClientCert(next))
+
+	case authOAuth:
+		if c.jwksFile == "" || c.issuer == "" || c.audience == "" {
+			return fmt.Errorf("-auth-jwks, -auth-issuer and -auth-audience are required with -auth %s", authOAuth)
+		}
+		resource, err := url.Parse(c.audience)
+		if err != nil || resource.Scheme == "" || resource.Host == "" {
+			return fmt.Errorf("-auth-audience must be an absolute URL, got %q", c.audience)
+		}
+		keys, err := loadJWKS(c.jwksFile)
+		if err != nil {
+			return err
+		}
+		verifier := &jwtVerifier{keys: keys, issuer: c.issuer, audience: c.audience}
+		scopes := splitList(c.scopes)
+
+		// clients discover the authorization server from the metadata
+		// URL in the WWW-Authenticate header of a 401
+		metadataPath := protectedResourcePath + strings.TrimSuffix(resource.Path, "/")
+		metadata := auth.ProtectedResourceMetadataHandler(&oauthex.ProtectedResourceMetadata{
+			Resource:               c.audience,
+			AuthorizationServers:   []string{c.issuer},
+			ScopesSupported:        scopes,
+			BearerMethodsSupported: []string{"header"},
+		})
+		mux.Handle(protectedResourcePath, metadata)
+		if metadataPath != protectedResourcePath {
+			mux.Handle(metadataPath, metadata)
+		}
+		mux.Handle("/", auth.RequireBearerToken(verifier.verify, &auth.RequireBearerTokenOptions{
+			ResourceMetadataURL: resource.Scheme + "://" + resource.Host + metadataPath,
+			Scopes:              scopes,
+		})(next))
+
+	default:
+		return fmt.Errorf("unknown auth mode %q (want %s, %s, %s or %s)", c.mode, authNone, authToken, authMTLS, authOAuth)
+	}
+	return nil
+}
+
+// requireClientCert rejects requests that didn't present a client
+// certificate verified against the client CA
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIdentity returns who authenticated a request: the token's user
+// for bearer tokens, or the client certificate's common name for mTLS
+func requestIdentity(r *http.Request) string {
+	if info := auth.TokenInfoFromContext(r.Context()); info != nil {
+		return info.UserID
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return ""
+}
+
+// staticTokens maps the SHA-256 of each accepted bearer token to the
+// identity it authenticates as. Looking tokens up by hash avoids comparing
+// secrets byte by byte.
+type staticTokens map[[sha256.Size]byte]string
+
+// loadTokens reads a tokens file: one token per line, optionally followed
+// by whitespace and the identity it authenticates as, which defaults to
+// token-<the first 12 hex digits of the token's SHA-256>. Blank lines and
+// lines starting with # are ignored.
+func loadTokens(path string) (staticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tokens file: %w", err)
+	}
+	defer f.Close()
+
+	tokens := make(staticTokens)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and an optional identity", path, line)
+		}
+		hash := sha256.Sum256([]byte(fields[0]))
+		// tokens without an identity are named by their hash, which stays
+		// the same when the file is reordered and doesn't reveal the token
+		identity := fmt.Sprintf("token-%x", hash[:6])
+		if len(fields) == 2 {
+			identity = fields[1]
+		}
+		tokens[hash] = identity
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading tokens file: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens found in %s", path)
+	}
+	return tokens, nil
+}
+
+func (t staticTokens) verify(_ context.Context, token string, _ *http.Request) (*auth.TokenInfo, error) {
+	identity, ok := t[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown token", auth.ErrInvalidToken)
+	}
+	// static tokens don't expire, but the SDK requires an expiry
+	return &auth.TokenInfo{UserID: identity, Expiration: time.Now().Add(time.Hour)}, nil
+}
+
+// jwtVerifier validates OAuth 2.1 access tokens issued as JWTs, as
+// described by the MCP authorization spec: the signature must match a key
+// from the JWKS, and the issuer, audience and expiry must be valid
+type jwtVerifier struct {
+	keys     map[string]interface{} // public keys by key ID
+	issuer   string
+	audience string
+}
+
+func (v *jwtVerifier) verify(_ context.Context, token string, _ *http.Request) (*auth.TokenInfo, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, v.key,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+
+	exp, _ := claims.GetExpirationTime()
+	sub, _ := claims.GetSubject()
+	return &auth.TokenInfo{
+		Scopes:     tokenScopes(claims),
+		Expiration: exp.Time,
+		UserID:     sub,
+	}, nil
+}
+
+// key returns the public key a token was signed with
+func (v *jwtVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// tokenScopes reads scopes from the space separated "scope" claim (RFC
+// 9068), falling back to "scp" as used by some authorization servers
+func tokenScopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		var scopes []string
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// jsonWebKey is the subset of RFC 7517 needed for signature verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the signing keys from a JSON Web Key Set file
+func loadJWKS(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS: %w", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS %s: %w", path, err)
+	}
+
+	keys := make(map[string]interface{})
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// keys are looked up by ID, so one would silently replace another
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("JWKS %s: key %d: duplicate key ID %q", path, i, k.Kid)
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %s: key %d (%q): %w", path, i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in JWKS %s", path)
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeKeyParam(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyParam(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := decodeKeyParam(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyParam(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("EC point is not on curve %s", k.Crv)
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := decodeKeyParam(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeKeyParam(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key parameter: %w", err)
+	}
+	return b, nil
+}
+
+// splitList splits a comma separated flag value
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
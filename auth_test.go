@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// writeTestFile writes content to name in a temporary directory and
+// returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// want maps tokens to the identity they authenticate as
+		want   map[string]string
+		errMsg string
+	}{
+		{
+			name:    "tokens and identities",
+			content: "# ops team\nsecret-a alice\n\n  secret-b\n",
+			want:    map[string]string{"secret-a": "alice", "secret-b": "token-ff492ef788c8"},
+		},
+		{
+			// unnamed tokens keep their identity when the file is reordered
+			name:    "reordered",
+			content: "secret-b\nsecret-a alice\n",
+			want:    map[string]string{"secret-a": "alice", "secret-b": "token-ff492ef788c8"},
+		},
+		{
+			name:    "too many fields",
+			content: "secret-a alice admin\n",
+			errMsg:  ":1: expected a token and an optional identity",
+		},
+		{
+			name:    "only comments",
+			content: "# nothing yet\n",
+			errMsg:  "no tokens found in ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := loadTokens(writeTestFile(t, "tokens", tt.content))
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != len(tt.want) {
+				t.Errorf("got %d tokens, want %d", len(tokens), len(tt.want))
+			}
+			for token, identity := range tt.want {
+				info, err := tokens.verify(context.Background(), token, nil)
+				if err != nil || info.UserID != identity {
+					t.Errorf("verify(%s) = %+v, %v, want %s", token, info, err, identity)
+				}
+			}
+			if _, err := tokens.verify(context.Background(), "unknown", nil); !errors.Is(err, auth.ErrInvalidToken) {
+				t.Errorf("unknown token error %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := `{"keys": [
+		{"kty": "OKP", "crv": "Ed25519", "kid": "signing", "x": "` + base64.RawURLEncoding.EncodeToString(public) + `"},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "", "e": ""}
+	]}`
+	keys, err := loadJWKS(writeTestFile(t, "jwks.json", jwks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &jwtVerifier{keys: keys, issuer: "https://sso.example.com", audience: "https://mcp.example.com/mcp"}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://sso.example.com",
+			"aud":   "https://mcp.example.com/mcp",
+			"sub":   "alice",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "kuadrant:read kuadrant:write",
+		}
+	}
+	sign := func(claims jwt.MapClaims, kid string, key ed25519.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		errMsg string
+	}{
+		{"valid", sign(valid(), "signing", private), ""},
+		// the only signing key is used when the token names none
+		{"no key ID", sign(valid(), "", private), ""},
+		{"unknown key ID", sign(valid(), "rotated", private), `unknown key ID "rotated"`},
+		{"wrong key", sign(valid(), "signing", otherKey), "signature is invalid"},
+		{"wrong issuer", sign(with("iss", "https://evil.example.com"), "signing", private), "token has invalid issuer"},
+		{"wrong audience", sign(with("aud", "https://other.example.com"), "signing", private), "token has invalid audience"},
+		{"expired", sign(with("exp", time.Now().Add(-time.Minute).Unix()), "signing", private), "token is expired"},
+		{"no expiry", sign(with("exp", nil), "signing", private), "exp claim is required"},
+		{"not a JWT", "opaque-token", "token is malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := verifier.verify(context.Background(), tt.token, nil)
+			if tt.errMsg != "" {
+				if !errors.Is(err, auth.ErrInvalidToken) || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want ErrInvalidToken with %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.UserID != "alice" || !reflect.DeepEqual(info.Scopes, []string{"kuadrant:read", "kuadrant:write"}) {
+				t.Errorf("got %+v", info)
+			}
+		})
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	tests := []struct {
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{jwt.MapClaims{"scope": "read  write"}, []string{"read", "write"}},
+		{jwt.MapClaims{"scope": "read", "scp": "write"}, []string{"read"}},
+		{jwt.MapClaims{"scp": "read write"}, []string{"read", "write"}},
+		{jwt.MapClaims{"scp": []interface{}{"read", 42, "write"}}, []string{"read", "write"}},
+		{jwt.MapClaims{"sub": "alice"}, nil},
+	}
+	for _, tt := range tests {
+		if got := tokenScopes(tt.claims); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenScopes(%v) = %v, want %v", tt.claims, got, tt.want)
+		}
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	// a P-256 point from RFC 7515 appendix A.3
+	x, y := "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"
+	tests := []struct {
+		name   string
+		key    jsonWebKey
+		errMsg string
+	}{
+		{"RSA", jsonWebKey{Kty: "RSA", N: "sXchDaQebHnPiGvyDOAT4saGEUetSyo9MKLOoWFsueri23bOdgWp4Dy1WlUzewbgBHod5pcM9H95GQRV3JDXboIRROSBigeC5yjU1hGzHHyXss8UDprecbAYxknTcQkhslANGRUZmdTOQ5qTRsLAt6BTYuyvVRdhS8exSZEy_c4gs_7svlJJQ4H9_NxsiIoLwAEk7-Q3UXERGYw_75IDrGA84-lA_-Ct4eTlXHBIY2EaV7t7LjJaynVJCpkv4LKjTTAumiGUIuQhrNhZLuF_RJLqHpM2kgWFLU7-VTdL1VbC2tejvcI2BlMkEpk1BzBZI0KQB0GaDWFLN-aEAw3vRw", E: "AQAB"}, ""},
+		{"RSA without exponent", jsonWebKey{Kty: "RSA", N: "sXch"}, "invalid RSA key"},
+		{"EC", jsonWebKey{Kty: "EC", Crv: "P-256", X: x, Y: y}, ""},
+		{"EC point off the curve", jsonWebKey{Kty: "EC", Crv: "P-256", X: x, Y: x}, "EC point is not on curve P-256"},
+		{"EC curve", jsonWebKey{Kty: "EC", Crv: "secp256k1", X: x, Y: y}, `unsupported EC curve "secp256k1"`},
+		{"Ed25519 length", jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: x[:10]}, "invalid Ed25519 key"},
+		{"OKP curve", jsonWebKey{Kty: "OKP", Crv: "X25519", X: x}, `unsupported OKP curve "X25519"`},
+		{"bad encoding", jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: "not base64!"}, "invalid key parameter"},
+		{"symmetric", jsonWebKey{Kty: "oct"}, `unsupported key type "oct"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.key.publicKey()
+			switch {
+			case tt.errMsg == "" && (err != nil || key == nil):
+				t.Errorf("got %v, %v, want a key", key, err)
+			case tt.errMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.errMsg)):
+				t.Errorf("error %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	const x = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	tests := []struct {
+		name   string
+		keys   string
+		want   []string // key IDs
+		errMsg string
+	}{
+		{
+			name: "distinct key IDs",
+			keys: `{"kty": "OKP", "crv": "Ed25519", "kid": "a", "x": "` + x + `"}, {"kty": "OKP", "crv": "Ed25519", "kid": "b", "x": "` + x + `"}`,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "single key without an ID",
+			keys: `{"kty": "OKP", "crv": "Ed25519", "x": "` + x + `"}`,
+			want: []string{""},
+		},
+		{
+			// only signing keys are loaded, so an encryption key may share an ID
+			name: "encryption key with the same ID",
+			keys: `{"kty": "OKP", "crv": "Ed25519", "kid": "a", "x": "` + x + `"}, {"kty": "RSA", "kid": "a", "use": "enc"}`,
+			want: []string{"a"},
+		},
+		{
+			name:   "duplicate key ID",
+			keys:   `{"kty": "OKP", "crv": "Ed25519", "kid": "a", "x": "` + x + `"}, {"kty": "OKP", "crv": "Ed25519", "kid": "a", "x": "` + x + `"}`,
+			errMsg: `key 1: duplicate key ID "a"`,
+		},
+		{
+			name:   "keys without an ID",
+			keys:   `{"kty": "OKP", "crv": "Ed25519", "x": "` + x + `"}, {"kty": "OKP", "crv": "Ed25519", "x": "` + x + `"}`,
+			errMsg: `key 1: duplicate key ID ""`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := loadJWKS(writeTestFile(t, "jwks.json", `{"keys": [`+tt.keys+`]}`))
+			if tt.errMsg != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Errorf("got %d keys, want %d", len(keys), len(tt.want))
+			}
+			for _, kid := range tt.want {
+				if _, ok := keys[kid]; !ok {
+					t.Errorf("key %q not loaded", kid)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthConfigInstall(t *testing.T) {
+	tokens := writeTestFile(t, "tokens", "secret-a alice\n")
+	jwks := writeTestFile(t, "jwks.json", `{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "k", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestIdentity(r)))
+	})
+
+	tests := []struct {
+		name   string
+		config authConfig
+		// requests maps "path token" to the expected status code
+		requests map[string]int
+		errMsg   string
+	}{
+		{
+			name:     "none",
+			config:   authConfig{mode: authNone},
+			requests: map[string]int{"/mcp ": http.StatusOK},
+		},
+		{
+			name:     "token",
+			config:   authConfig{mode: authToken, tokensFile: tokens},
+			requests: map[string]int{"/mcp ": http.StatusUnauthorized, "/mcp secret-a": http.StatusOK, "/mcp secret-b": http.StatusUnauthorized},
+		},
+		{
+			name:     "mtls without a certificate",
+			config:   authConfig{mode: authMTLS, clientCA: "ca.pem"},
+			requests: map[string]int{"/mcp ": http.StatusUnauthorized},
+		},
+		{
+			name:   "oauth",
+			config: authConfig{mode: authOAuth, jwksFile: jwks, issuer: "https://sso.example.com", audience: "https://mcp.example.com/mcp"},
+			requests: map[string]int{
+				"/mcp ":                                  http.StatusUnauthorized,
+				"/.well-known/oauth-protected-resource ": http.StatusOK,
+				"/.well-known/oauth-protected-resource/mcp ": http.StatusOK,
+			},
+		},
+		{
+			name:   "token without a file",
+			config: authConfig{mode: authToken},
+			errMsg: "-auth-tokens-file is required with -auth token",
+		},
+		{
+			name:   "oauth with a relative audience",
+			config: authConfig{mode: authOAuth, jwksFile: jwks, issuer: "https://sso.example.com", audience: "/mcp"},
+			errMsg: `-auth-audience must be an absolute URL, got "/mcp"`,
+		},
+		{
+			name:   "unknown mode",
+			config: authConfig{mode: "basic"},
+			errMsg: `unknown auth mode "basic"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			err := tt.config.install(mux, next)
+			if tt.errMsg != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for request, want := range tt.requests {
+				path, token, _ := strings.Cut(request, " ")
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+				if rec.Code != want {
+					t.Errorf("%s: status %d, want %d", request, rec.Code, want)
+				}
+				if want == http.StatusUnauthorized && tt.config.mode == authOAuth &&
+					!strings.Contains(rec.Header().Get("WWW-Authenticate"), "resource_metadata=https://mcp.example.com/.well-known/oauth-protected-resource/mcp") {
+					t.Errorf("%s: WWW-Authenticate = %q", request, rec.Header().Get("WWW-Authenticate"))
+				}
+				if token == "secret-a" && rec.Body.String() != "alice" {
+					t.Errorf("%s: identity %q, want alice", request, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"read", []string{"read"}},
+		{" read, write ,,", []string{"read", "write"}},
+	}
+	for _, tt := range tests {
+		if got := splitList(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	authPolicyKind = schema.GroupKind{Group: "kuadrant.io", Kind: "AuthPolicy"}
+	authConfigKind = schema.GroupKind{Group: "authorino.kuadrant.io", Kind: "AuthConfig"}
+	secretKind     = schema.GroupKind{Kind: "Secret"}
+)
+
+// authRuleSections are the named rule maps shared by AuthPolicy rules and
+// AuthConfig specs
+var authRuleSections = []string{"authentication", "metadata", "authorization", "callbacks"}
+
+// authMethods are the keys selecting a rule's method, in the order
+// they're looked for
+var authMethods = []string{
+	"apiKey", "jwt", "kubernetesTokenReview", "x509", "plain", "anonymous", "oauth2Introspection",
+	"http", "userInfo", "uma", "opa", "patternMatching", "kubernetesSubjectAccessReview", "spicedb",
+}
+
+// authConfigIDHost matches the hosts Kuadrant v1 gives AuthConfigs, a hash
+// the wasm-shim sends instead of the request's host
+var authConfigIDHost = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type ExplainAuthConfigParams struct {
+	Policy      string `json:"policy,omitempty" jsonschema:"AuthPolicy YAML, optionally with its target HTTPRoute or Gateway; every AuthPolicy in the snapshot is explained if omitted"`
+	AuthConfigs string `json:"authConfigs,omitempty" jsonschema:"AuthConfig YAML, e.g. kubectl get authconfigs -n kuadrant-system -o yaml"`
+	Path        string `json:"path,omitempty" jsonschema:"Snapshot directory or archive, relative to the server's -snapshot-dir, to read AuthPolicies, AuthConfigs, routes and Secrets from"`
+}
+
+type authConfigSummary struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace"`
+	Hosts     []string `yaml:"hosts,omitempty"`
+	State     string   `yaml:"state"`
+	// MatchedBy is how the AuthConfig was tied to the policy: reference, when
+	// it references the policy, or ruleNames when it only serves the
+	// policy's hostnames and shares rules with it
+	MatchedBy string `yaml:"matchedBy"`
+}
+
+// ruleTranslation is how one AuthPolicy rule appears in its AuthConfigs
+type ruleTranslation struct {
+	Rule string `yaml:"rule"`
+	// Section is defaults or overrides for rules declared there
+	Section      string        `yaml:"section,omitempty"`
+	Method       string        `yaml:"method,omitempty"`
+	TranslatedIn []string      `yaml:"translatedIn,omitempty"`
+	Differences  []fieldChange `yaml:"differences,omitempty"`
+}
+
+type authPolicyTranslation struct {
+	Policy      string              `yaml:"policy"`
+	State       string              `yaml:"state"`
+	Hostnames   []string            `yaml:"hostnames,omitempty"`
+	AuthConfigs []authConfigSummary `yaml:"authConfigs"`
+	Rules       []ruleTranslation   `yaml:"rules"`
+}
+
+// authRule is a rule of an AuthPolicy, addressed by its path in the
+// AuthConfig spec, e.g. authentication.api-key-users
+type authRule struct {
+	path    []string
+	section string
+	rule    interface{}
+}
+
+func explainAuthConfigHandler(ctx context.Context, params ExplainAuthConfigParams) (string, error) {
+	var objects []*unstructured.Unstructured
+	if params.Path != "" {
+		snapshot, _, err := loadSnapshot(params.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		objects = snapshot
+	}
+	var given []*unstructured.Unstructured
+	if params.Policy != "" {
+		parsed, err := parseManifests(params.Policy)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid policy: %v", err), nil
+		}
+		given = parsed
+		objects = replaceObjects(objects, parsed)
+	}
+	if params.AuthConfigs != "" {
+		parsed, err := parseManifests(params.AuthConfigs)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid authConfigs: %v", err), nil
+		}
+		objects = replaceObjects(objects, parsed)
+	}
+	idx := newSnapshotIndex(objects)
+
+	policies := idx.all(authPolicyKind)
+	if params.Policy != "" {
+		policies = objectsOfKind(given, authPolicyKind)
+	}
+	if len(policies) == 0 {
+		return "Error: no AuthPolicy given; pass policy, or a path to a snapshot containing AuthPolicies", nil
+	}
+	authConfigs := idx.all(authConfigKind)
+	if len(authConfigs) == 0 {
+		return "Error: no AuthConfigs given; pass authConfigs, or a path to a snapshot containing them", nil
+	}
+
+	var (
+		translations []authPolicyTranslation
+		findings     []finding
+	)
+	for _, policy := range policies {
+		translation, policyFindings := explainAuthPolicy(idx, policy, authConfigs)
+		translations = append(translations, translation)
+		findings = append(findings, policyFindings...)
+	}
+	findings = append(findings, checkDuplicateAuthConfigs(authConfigs)...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return slices.Index(severities, findings[i].Severity) < slices.Index(severities, findings[j].Severity)
+	})
+
+	report := map[string]interface{}{"policies": translations}
+	if len(findings) > 0 {
+		report["findings"] = findings
+	}
+	return renderSummary(report)
+}
+
+// replaceObjects adds pasted objects to those from a snapshot, replacing
+// any of the same kind, namespace and name, so an object given both ways
+// is only counted once and the pasted copy wins
+func replaceObjects(objects, pasted []*unstructured.Unstructured) []*unstructured.Unstructured {
+	key := func(obj *unstructured.Unstructured) string {
+		return obj.GroupVersionKind().GroupKind().String() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+	}
+	replaced := make(map[string]bool)
+	for _, obj := range pasted {
+		replaced[key(obj)] = true
+	}
+	kept := slices.DeleteFunc(slices.Clone(objects), func(obj *unstructured.Unstructured) bool {
+		return replaced[key(obj)]
+	})
+	return append(kept, pasted...)
+}
+
+// authPolicyRules reads a policy's rules, including those under defaults
+// and overrides. AuthPolicy's response.success.filters are rendered as
+// the AuthConfig's response.success.dynamicMetadata.
+func authPolicyRules(policy *unstructured.Unstructured) []authRule {
+	var rules []authRule
+	for _, section := range []string{"", "defaults", "overrides"} {
+		path := []string{"spec"}
+		if section != "" {
+			path = append(path, section)
+		}
+		spec, ok, _ := unstructured.NestedMap(policy.Object, append(path, "rules")...)
+		if !ok {
+			continue
+		}
+		for _, ruleSection := range authRuleSections {
+			named, _, _ := unstructured.NestedMap(spec, ruleSection)
+			for _, name := range sortedKeys(named) {
+				rules = append(rules, authRule{path: []string{ruleSection, name}, section: section, rule: named[name]})
+			}
+		}
+		for _, response := range []string{"unauthenticated", "unauthorized"} {
+			if rule, ok, _ := unstructured.NestedFieldNoCopy(spec, "response", response); ok {
+				rules = append(rules, authRule{path: []string{"response", response}, section: section, rule: rule})
+			}
+		}
+		for field, translated := range map[string]string{"headers": "headers", "filters": "dynamicMetadata"} {
+			named, _, _ := unstructured.NestedMap(spec, "response", "success", field)
+			for _, name := range sortedKeys(named) {
+				rules = append(rules, authRule{path: []string{"response", "success", translated, name}, section: section, rule: named[name]})
+			}
+		}
+	}
+	return rules
+}
+
+// ruleMethod returns the method a rule uses, e.g. apiKey or opa
+func ruleMethod(rule interface{}) string {
+	m, ok := rule.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, method := range authMethods {
+		if _, ok := m[method]; ok {
+			return method
+		}
+	}
+	return ""
+}
+
+// references reports whether an AuthConfig's owner references, or labels
+// or annotations about policies, e.g. kuadrant.io/authpolicies, name the
+// policy
+func references(authConfig, policy *unstructured.Unstructured) bool {
+	for _, owner := range authConfig.GetOwnerReferences() {
+		if owner.Kind == authPolicyKind.Kind && owner.Name == policy.GetName() && authConfig.GetNamespace() == policy.GetNamespace() {
+			return true
+		}
+	}
+	key := policy.GetNamespace() + "/" + policy.GetName()
+	for _, values := range []map[string]string{authConfig.GetAnnotations(), authConfig.GetLabels()} {
+		for k, v := range values {
+			if strings.Contains(strings.ToLower(k), "polic") && slices.Contains(policyKeys(v), key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyKeys reads the namespace/name of each policy named by an annotation
+// or label value: a JSON list of namespace/name strings or of objects with
+// namespace and name fields, or a comma separated list
+func policyKeys(value string) []string {
+	var keys []string
+	if err := json.Unmarshal([]byte(value), &keys); err == nil {
+		return keys
+	}
+	var refs []struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(value), &refs); err == nil {
+		for _, ref := range refs {
+			keys = append(keys, ref.Namespace+"/"+ref.Name)
+		}
+		return keys
+	}
+	for _, key := range strings.Split(value, ",") {
+		keys = append(keys, strings.TrimSpace(key))
+	}
+	return keys
+}
+
+// explainAuthPolicy finds the AuthConfigs translated from a policy and
+// compares each of its rules with them
+func explainAuthPolicy(idx *snapshotIndex, policy *unstructured.Unstructured, authConfigs []*unstructured.Unstructured) (authPolicyTranslation, []finding) {
+	conditions := conditionsAt(policy.Object, "status", "conditions")
+	translation := authPolicyTranslation{
+		Policy:    objectName(policy),
+		State:     policyState(conditions),
+		Hostnames: expectedHostnames(idx, policy),
+	}
+	rules := authPolicyRules(policy)
+
+	// AuthConfigs referencing the policy, or failing that any serving one
+	// of its hostnames and sharing a rule with it
+	var matched []*unstructured.Unstructured
+	matchedBy := "reference"
+	for _, authConfig := range authConfigs {
+		if references(authConfig, policy) {
+			matched = append(matched, authConfig)
+		}
+	}
+	if len(matched) == 0 {
+		matchedBy = "ruleNames"
+		for _, authConfig := range authConfigs {
+			hosts, _, _ := unstructured.NestedStringSlice(authConfig.Object, "spec", "hosts")
+			if !servesAny(hosts, translation.Hostnames) {
+				continue
+			}
+			if slices.ContainsFunc(rules, func(r authRule) bool {
+				_, ok, _ := unstructured.NestedFieldNoCopy(authConfig.Object, append([]string{"spec"}, r.path...)...)
+				return ok
+			}) {
+				matched = append(matched, authConfig)
+			}
+		}
+	}
+
+	object := translation.Policy
+	var findings []finding
+	overridden := false
+	if enforced := findCondition(conditions, "Enforced"); enforced != nil && enforced.Reason == "Overridden" {
+		overridden = true
+	}
+	if len(matched) == 0 {
+		severity := "critical"
+		if overridden {
+			severity = "info"
+		}
+		findings = append(findings, finding{
+			Severity: severity,
+			Check:    "no-authconfig",
+			Object:   object,
+			Summary:  "No AuthConfig references the policy, or serves its hostnames with any of its rules, so Authorino doesn't enforce it",
+			NextSteps: []string{
+				"Check the policy is Accepted and not overridden (explain_status)",
+				"Check the AuthConfigs were collected from the Kuadrant namespace, where the operator creates them",
+			},
+		})
+	}
+
+	for _, authConfig := range matched {
+		summary := authConfigSummary{
+			Name:      authConfig.GetName(),
+			Namespace: authConfig.GetNamespace(),
+			MatchedBy: matchedBy,
+			State:     "Unknown (no status yet)",
+		}
+		summary.Hosts, _, _ = unstructured.NestedStringSlice(authConfig.Object, "spec", "hosts")
+		if ready := findCondition(conditionsAt(authConfig.Object, "status", "conditions"), "Ready"); ready != nil {
+			summary.State = "Ready"
+			if ready.Status != "True" {
+				summary.State = "NotReady (" + ready.Reason + ")"
+				findings = append(findings, finding{
+					Severity: "critical",
+					Check:    "authconfig-not-ready",
+					Object:   objectName(authConfig),
+					Summary:  "AuthConfig is not ready, so Authorino rejects or ignores requests for it",
+					Details:  []string{conditionDetail(ready)},
+				})
+			}
+		}
+		translation.AuthConfigs = append(translation.AuthConfigs, summary)
+		findings = append(findings, checkIdentity(idx, authConfig)...)
+		findings = append(findings, checkHosts(authConfig, summary.Hosts, translation.Hostnames)...)
+	}
+
+	for _, rule := range rules {
+		t := ruleTranslation{Rule: strings.Join(rule.path, "."), Section: rule.section, Method: ruleMethod(rule.rule)}
+		for _, authConfig := range matched {
+			translated, ok, _ := unstructured.NestedFieldNoCopy(authConfig.Object, append([]string{"spec"}, rule.path...)...)
+			if !ok {
+				continue
+			}
+			t.TranslatedIn = append(t.TranslatedIn, authConfig.GetName())
+			var changes []fieldChange
+			diffValues(t.Rule, translated, rule.rule, false, &changes)
+			for _, change := range changes {
+				change.Path = authConfig.GetName() + ": " + change.Path
+				t.Differences = append(t.Differences, change)
+			}
+		}
+		if len(matched) > 0 && len(t.TranslatedIn) == 0 {
+			severity := "critical"
+			if overridden || rule.section == "defaults" {
+				// defaults are replaced by a more specific policy's rules
+				severity = "warning"
+			}
+			findings = append(findings, finding{
+				Severity: severity,
+				Check:    "rule-not-translated",
+				Object:   object,
+				Summary:  fmt.Sprintf("Rule %s is in none of the policy's AuthConfigs", t.Rule),
+			})
+		}
+		if len(t.Differences) > 0 {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "rule-differs",
+				Object:   object,
+				Summary:  fmt.Sprintf("Rule %s differs from its AuthConfig; another policy's defaults or overrides may have replaced it, or the operator hasn't reconciled", t.Rule),
+			})
+		}
+		translation.Rules = append(translation.Rules, t)
+	}
+	return translation, findings
+}
+
+// checkIdentity reports AuthConfigs without a usable identity source
+func checkIdentity(idx *snapshotIndex, authConfig *unstructured.Unstructured) []finding {
+	object := objectName(authConfig)
+	authentication, _, _ := unstructured.NestedMap(authConfig.Object, "spec", "authentication")
+	if len(authentication) == 0 {
+		return []finding{{
+			Severity: "warning",
+			Check:    "no-identity-source",
+			Object:   object,
+			Summary:  "AuthConfig has no authentication rules, so Authorino accepts every request anonymously",
+		}}
+	}
+
+	var findings []finding
+	for _, name := range sortedKeys(authentication) {
+		rule, _ := authentication[name].(map[string]interface{})
+		switch ruleMethod(rule) {
+		case "jwt":
+			if stringField(rule, "jwt", "issuerUrl") == "" && stringField(rule, "jwt", "jwksUrl") == "" {
+				findings = append(findings, finding{
+					Severity: "critical",
+					Check:    "missing-identity-source",
+					Object:   object,
+					Summary:  fmt.Sprintf("JWT rule %s has neither issuerUrl nor jwksUrl, so no token can be verified", name),
+				})
+			}
+		case "apiKey":
+			selector, _, _ := unstructured.NestedStringMap(rule, "apiKey", "selector", "matchLabels")
+			if !idx.has(secretKind) {
+				continue
+			}
+			allNamespaces, _, _ := unstructured.NestedBool(rule, "apiKey", "allNamespaces")
+			matching := 0
+			for _, secret := range idx.all(secretKind) {
+				if (allNamespaces || secret.GetNamespace() == authConfig.GetNamespace()) && labels.SelectorFromSet(selector).Matches(labels.Set(secret.GetLabels())) {
+					matching++
+				}
+			}
+			if matching == 0 {
+				where := "namespace " + authConfig.GetNamespace()
+				if allNamespaces {
+					where = "any namespace"
+				}
+				findings = append(findings, finding{
+					Severity: "critical",
+					Check:    "missing-identity-source",
+					Object:   object,
+					Summary:  fmt.Sprintf("API key rule %s selects no Secrets in %s, so every key is rejected", name, where),
+					Details:  []string{fmt.Sprintf("selector: %v", selector)},
+					NextSteps: []string{
+						"Label the API key Secrets with the selector's labels and authorino.kuadrant.io/managed-by: authorino",
+						"Set allNamespaces if the Secrets are outside the Kuadrant namespace",
+					},
+				})
+			}
+		case "":
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "missing-identity-source",
+				Object:   object,
+				Summary:  fmt.Sprintf("Authentication rule %s has no method, e.g. jwt or apiKey", name),
+			})
+		}
+	}
+	return findings
+}
+
+// checkHosts reports hostnames of the policy's target the AuthConfig
+// doesn't serve, and hosts it serves that aren't the target's. Kuadrant
+// v1 AuthConfigs are keyed by an id rather than hostnames, so they aren't
+// checked.
+func checkHosts(authConfig *unstructured.Unstructured, hosts, expected []string) []finding {
+	if len(expected) == 0 || slices.ContainsFunc(hosts, authConfigIDHost.MatchString) {
+		return nil
+	}
+	var findings []finding
+	for _, hostname := range expected {
+		if !slices.ContainsFunc(hosts, func(host string) bool { return hostMatches(host, hostname) }) {
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "hostname-mismatch",
+				Object:   objectName(authConfig),
+				Summary:  fmt.Sprintf("Target hostname %s is not in the AuthConfig's hosts %v, so its requests aren't authenticated by it", hostname, hosts),
+			})
+		}
+	}
+	for _, host := range hosts {
+		if !slices.ContainsFunc(expected, func(hostname string) bool { return hostMatches(hostname, host) || hostMatches(host, hostname) }) {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "hostname-mismatch",
+				Object:   objectName(authConfig),
+				Summary:  fmt.Sprintf("Host %s is not a hostname of the policy's target %v", host, expected),
+			})
+		}
+	}
+	return findings
+}
+
+// hostMatches reports whether pattern, which may start with a *. wildcard,
+// matches host
+func hostMatches(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return pattern == host
+}
+
+// servesAny reports whether any of an AuthConfig's hosts matches one of
+// the expected hostnames, either of which may be a wildcard
+func servesAny(hosts, expected []string) bool {
+	for _, host := range hosts {
+		for _, want := range expected {
+			if hostMatches(host, want) || hostMatches(want, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expectedHostnames returns the hostnames of a policy's targets: the
+// HTTPRoute's hostnames, or its Gateways' listener hostnames if it has
+// none, or the targeted Gateway's listener hostnames
+func expectedHostnames(idx *snapshotIndex, policy *unstructured.Unstructured) []string {
+	var hostnames []string
+	for _, ref := range policyTargets(policy) {
+		gk := schema.GroupKind{Group: ref.Group, Kind: ref.Kind}
+		target := idx.find(gk, ref.Namespace, ref.Name)
+		if target == nil {
+			continue
+		}
+		switch gk {
+		case httpRouteKind:
+			routeHosts, _, _ := unstructured.NestedStringSlice(target.Object, "spec", "hostnames")
+			if len(routeHosts) > 0 {
+				hostnames = append(hostnames, routeHosts...)
+				continue
+			}
+			for _, gateway := range idx.all(gatewayKind) {
+				if routeAttachesTo(target, gateway.GetNamespace(), gateway.GetName()) {
+					hostnames = append(hostnames, listenerHostnames(gateway, "")...)
+				}
+			}
+		case gatewayKind:
+			hostnames = append(hostnames, listenerHostnames(target, ref.SectionName)...)
+		}
+	}
+	slices.Sort(hostnames)
+	return slices.Compact(hostnames)
+}
+
+func listenerHostnames(gateway *unstructured.Unstructured, section string) []string {
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	var hostnames []string
+	for _, listener := range listeners {
+		l, ok := listener.(map[string]interface{})
+		if !ok || (section != "" && stringField(l, "name") != section) {
+			continue
+		}
+		if hostname := stringField(l, "hostname"); hostname != "" {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	return hostnames
+}
+
+// checkDuplicateAuthConfigs reports AuthConfigs serving the same host,
+// of which Authorino only links one, and AuthConfigs with identical specs
+func checkDuplicateAuthConfigs(authConfigs []*unstructured.Unstructured) []finding {
+	var findings []finding
+	owners := make(map[string]*unstructured.Unstructured)
+	for i, authConfig := range authConfigs {
+		hosts, _, _ := unstructured.NestedStringSlice(authConfig.Object, "spec", "hosts")
+		for _, host := range hosts {
+			if other, ok := owners[host]; ok {
+				findings = append(findings, finding{
+					Severity: "critical",
+					Check:    "duplicate-authconfig",
+					Object:   objectName(authConfig),
+					Summary:  fmt.Sprintf("Host %s is also served by %s; Authorino links it to only one of them", host, objectName(other)),
+				})
+				continue
+			}
+			owners[host] = authConfig
+		}
+
+		spec, _, _ := unstructured.NestedMap(authConfig.Object, "spec")
+		delete(spec, "hosts")
+		for _, other := range authConfigs[:i] {
+			otherSpec, _, _ := unstructured.NestedMap(other.Object, "spec")
+			delete(otherSpec, "hosts")
+			if len(spec) > 0 && reflect.DeepEqual(spec, otherSpec) {
+				findings = append(findings, finding{
+					Severity: "info",
+					Check:    "duplicate-authconfig",
+					Object:   objectName(authConfig),
+					Summary:  fmt.Sprintf("Same rules as %s apart from hosts; expected when one policy covers several routes, otherwise a leftover copy", objectName(other)),
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// useSnapshotDir points the server's -snapshot-dir at a temporary
+// directory holding files, restoring it when the test ends
+func useSnapshotDir(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := snapshotDir
+	snapshotDir = dir
+	t.Cleanup(func() { snapshotDir = previous })
+}
+
+const testAuthRoute = `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: store
+  namespace: shop
+spec:
+  hostnames: [api.example.com]
+  parentRefs:
+    - name: external
+`
+
+const testAuthPolicy = `apiVersion: kuadrant.io/v1
+kind: AuthPolicy
+metadata:
+  name: auth
+  namespace: shop
+spec:
+  targetRef:
+    group: gateway.networking.k8s.io
+    kind: HTTPRoute
+    name: store
+  rules:
+    authentication:
+      jwt-users:
+        jwt:
+          issuerUrl: https://sso.example.com
+`
+
+// testAuthConfig returns an AuthConfig with the policy's rule, serving
+// host, and referencing the policy if annotated
+func testAuthConfig(name, host string, annotated bool, issuer string) string {
+	annotations := ""
+	if annotated {
+		annotations = "\n  annotations:\n    kuadrant.io/authpolicies: '[\"shop/auth\"]'"
+	}
+	return `apiVersion: authorino.kuadrant.io/v1beta3
+kind: AuthConfig
+metadata:
+  name: ` + name + `
+  namespace: kuadrant-system` + annotations + `
+spec:
+  hosts: [` + host + `]
+  authentication:
+    jwt-users:
+      jwt:
+        issuerUrl: ` + issuer + `
+`
+}
+
+type authConfigOutput struct {
+	Policies []authPolicyTranslation `yaml:"policies"`
+	Findings []finding               `yaml:"findings"`
+}
+
+func TestExplainAuthConfigHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot map[string]string
+		params   ExplainAuthConfigParams
+		// authConfigs are name: matchedBy of the policy's AuthConfigs
+		authConfigs []string
+		checks      []string
+		notChecks   []string
+		differences int
+		errMsg      string
+	}{
+		{
+			name: "referenced AuthConfig",
+			params: ExplainAuthConfigParams{
+				Policy:      testAuthPolicy + "---\n" + testAuthRoute,
+				AuthConfigs: testAuthConfig("a1", "api.example.com", true, "https://sso.example.com"),
+			},
+			authConfigs: []string{"a1: reference"},
+			notChecks:   []string{"no-authconfig", "duplicate-authconfig"},
+		},
+		{
+			name: "pasted AuthConfig replaces the snapshot's copy",
+			snapshot: map[string]string{
+				"objects.yaml": testAuthPolicy + "---\n" + testAuthRoute + "---\n" + testAuthConfig("a1", "api.example.com", true, "https://old.example.com"),
+			},
+			params: ExplainAuthConfigParams{
+				Path:        ".",
+				AuthConfigs: testAuthConfig("a1", "api.example.com", true, "https://sso.example.com"),
+			},
+			authConfigs: []string{"a1: reference"},
+			notChecks:   []string{"duplicate-authconfig"},
+		},
+		{
+			name: "unreferenced AuthConfig serving the policy's hostname",
+			params: ExplainAuthConfigParams{
+				Policy:      testAuthPolicy + "---\n" + testAuthRoute,
+				AuthConfigs: testAuthConfig("a1", "'*.example.com'", false, "https://other.example.com"),
+			},
+			authConfigs: []string{"a1: ruleNames"},
+			differences: 1,
+		},
+		{
+			name: "another policy's AuthConfig sharing a rule name",
+			params: ExplainAuthConfigParams{
+				Policy:      testAuthPolicy + "---\n" + testAuthRoute,
+				AuthConfigs: testAuthConfig("a1", "admin.example.com", false, "https://sso.example.com"),
+			},
+			checks: []string{"no-authconfig"},
+		},
+		{
+			name: "same host served twice",
+			params: ExplainAuthConfigParams{
+				Policy:      testAuthPolicy + "---\n" + testAuthRoute,
+				AuthConfigs: testAuthConfig("a1", "api.example.com", true, "https://sso.example.com") + "---\n" + testAuthConfig("a2", "api.example.com", true, "https://sso.example.com"),
+			},
+			authConfigs: []string{"a1: reference", "a2: reference"},
+			checks:      []string{"duplicate-authconfig"},
+		},
+		{
+			name:   "no AuthConfigs",
+			params: ExplainAuthConfigParams{Policy: testAuthPolicy},
+			errMsg: "Error: no AuthConfigs given",
+		},
+		{
+			name:   "no policy",
+			params: ExplainAuthConfigParams{AuthConfigs: testAuthConfig("a1", "api.example.com", true, "https://sso.example.com")},
+			errMsg: "Error: no AuthPolicy given",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.snapshot != nil {
+				useSnapshotDir(t, tt.snapshot)
+			}
+			out, err := explainAuthConfigHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result authConfigOutput
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if len(result.Policies) != 1 {
+				t.Fatalf("got %d policies, want 1:\n%s", len(result.Policies), out)
+			}
+			var authConfigs []string
+			for _, a := range result.Policies[0].AuthConfigs {
+				authConfigs = append(authConfigs, a.Name+": "+a.MatchedBy)
+			}
+			if !reflect.DeepEqual(authConfigs, tt.authConfigs) {
+				t.Errorf("authConfigs = %v, want %v\n%s", authConfigs, tt.authConfigs, out)
+			}
+			differences := 0
+			for _, rule := range result.Policies[0].Rules {
+				differences += len(rule.Differences)
+			}
+			if differences != tt.differences {
+				t.Errorf("got %d differences, want %d\n%s", differences, tt.differences, out)
+			}
+			checks := make(map[string]bool)
+			for _, f := range result.Findings {
+				checks[f.Check] = true
+			}
+			for _, check := range tt.checks {
+				if !checks[check] {
+					t.Errorf("missing %s finding:\n%s", check, out)
+				}
+			}
+			for _, check := range tt.notChecks {
+				if checks[check] {
+					t.Errorf("unexpected %s finding:\n%s", check, out)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthPolicyRules(t *testing.T) {
+	policy, err := parseManifests(`apiVersion: kuadrant.io/v1
+kind: AuthPolicy
+metadata:
+  name: auth
+  namespace: shop
+spec:
+  defaults:
+    rules:
+      authorization:
+        admins:
+          opa:
+            rego: allow = true
+  rules:
+    authentication:
+      keys:
+        apiKey: {}
+      jwt:
+        jwt: {}
+    response:
+      unauthorized:
+        body:
+          value: denied
+      success:
+        filters:
+          identity:
+            json: {}
+  overrides:
+    rules:
+      response:
+        success:
+          headers:
+            x-user:
+              plain: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rule := range authPolicyRules(policy[0]) {
+		got = append(got, strings.Join(rule.path, ".")+" "+rule.section+" "+ruleMethod(rule.rule))
+	}
+	want := []string{
+		"authentication.jwt  jwt",
+		"authentication.keys  apiKey",
+		"response.unauthorized  ",
+		"response.success.dynamicMetadata.identity  ",
+		"authorization.admins defaults opa",
+		"response.success.headers.x-user overrides plain",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReplaceObjects(t *testing.T) {
+	object := func(kind, name, version string) *unstructured.Unstructured {
+		return newObject("authorino.kuadrant.io/v1beta3", kind, "kuadrant-system", name, map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"copy": version}},
+		})
+	}
+	snapshot := []*unstructured.Unstructured{object("AuthConfig", "a1", "snapshot"), object("AuthConfig", "a2", "snapshot")}
+	got := replaceObjects(snapshot, []*unstructured.Unstructured{object("AuthConfig", "a1", "pasted"), object("AuthConfig", "a3", "pasted")})
+
+	var names []string
+	for _, obj := range got {
+		names = append(names, obj.GetName()+" "+obj.GetLabels()["copy"])
+	}
+	want := []string{"a2 snapshot", "a1 pasted", "a3 pasted"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if len(snapshot) != 2 || snapshot[0].GetName() != "a1" {
+		t.Error("replaceObjects modified the snapshot's objects")
+	}
+}
+
+func TestServesAny(t *testing.T) {
+	tests := []struct {
+		hosts, expected []string
+		want            bool
+	}{
+		{[]string{"api.example.com"}, []string{"api.example.com"}, true},
+		{[]string{"*.example.com"}, []string{"api.example.com"}, true},
+		{[]string{"api.example.com"}, []string{"*.example.com"}, true},
+		{[]string{"example.com"}, []string{"*.example.com"}, false},
+		{[]string{"admin.example.com"}, []string{"api.example.com"}, false},
+		{[]string{"api.example.com"}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := servesAny(tt.hosts, tt.expected); got != tt.want {
+			t.Errorf("servesAny(%v, %v) = %v, want %v", tt.hosts, tt.expected, got, tt.want)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	policy := newObject("kuadrant.io/v1", "AuthPolicy", "shop", "auth", nil)
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		owner       string
+		want        bool
+	}{
+		{name: "JSON list", annotations: map[string]interface{}{"kuadrant.io/authpolicies": `["shop/auth"]`}, want: true},
+		{name: "JSON objects", annotations: map[string]interface{}{"kuadrant.io/authpolicies": `[{"Namespace":"shop","Name":"auth"}]`}, want: true},
+		{name: "comma separated", annotations: map[string]interface{}{"kuadrant.io/authpolicies": "shop/other, shop/auth"}, want: true},
+		{name: "name prefix", annotations: map[string]interface{}{"kuadrant.io/authpolicies": `["shop/authz"]`}},
+		{name: "namespace suffix", annotations: map[string]interface{}{"kuadrant.io/authpolicies": "myshop/auth"}},
+		{name: "unrelated annotation", annotations: map[string]interface{}{"kuadrant.io/owner": "shop/auth"}},
+		{name: "owner reference", owner: "auth", want: true},
+		{name: "another owner", owner: "authz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authConfig := newObject("authorino.kuadrant.io/v1beta3", "AuthConfig", "shop", "a1", map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": tt.annotations},
+			})
+			if tt.owner != "" {
+				authConfig.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "kuadrant.io/v1", Kind: "AuthPolicy", Name: tt.owner}})
+			}
+			if got := references(authConfig, policy); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDuplicateAuthConfigs(t *testing.T) {
+	authConfig := func(name string, hosts []interface{}, issuer string) *unstructured.Unstructured {
+		return newObject("authorino.kuadrant.io/v1beta3", "AuthConfig", "kuadrant-system", name, map[string]interface{}{
+			"spec": map[string]interface{}{
+				"hosts":          hosts,
+				"authentication": map[string]interface{}{"jwt": map[string]interface{}{"jwt": map[string]interface{}{"issuerUrl": issuer}}},
+			},
+		})
+	}
+	tests := []struct {
+		name        string
+		authConfigs []*unstructured.Unstructured
+		want        []string
+	}{
+		{
+			name:        "distinct",
+			authConfigs: []*unstructured.Unstructured{authConfig("a", []interface{}{"a.example.com"}, "x"), authConfig("b", []interface{}{"b.example.com"}, "y")},
+		},
+		{
+			name:        "same host",
+			authConfigs: []*unstructured.Unstructured{authConfig("a", []interface{}{"a.example.com"}, "x"), authConfig("b", []interface{}{"a.example.com"}, "y")},
+			want:        []string{"critical AuthConfig kuadrant-system/b"},
+		},
+		{
+			name:        "same rules on other hosts",
+			authConfigs: []*unstructured.Unstructured{authConfig("a", []interface{}{"a.example.com"}, "x"), authConfig("b", []interface{}{"b.example.com"}, "x")},
+			want:        []string{"info AuthConfig kuadrant-system/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range checkDuplicateAuthConfigs(tt.authConfigs) {
+				got = append(got, f.Severity+" "+f.Object)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// docCache stores fetched documents with TTL. When dir is set, documents are
+// also persisted to disk so they survive restarts; stale entries are
+// revalidated with conditional GETs and kept if upstream is unreachable.
+type docCache struct {
+	mu     sync.RWMutex
+	docs   map[string]cachedDoc
+	ttl    time.Duration
+	client *http.Client
+	dir    string // on-disk cache directory, empty to keep docs in memory only
+
+	// inflight collapses concurrent upstream requests for the same URL
+	inflight singleflight.Group
+
+	// onChange, if set, is called when a document's content changes upstream
+	onChange func(url string)
+
+	// warmed is set once warm has fetched every document
+	warmed atomic.Bool
+
+	// background tracks refreshes that close waits for
+	bgMu       sync.Mutex
+	background sync.WaitGroup
+	closing    bool
+}
+
+// docMaxBytes caps the size of a fetched document, so a misconfigured or
+// hostile upstream can't exhaust memory
+const docMaxBytes = 8 << 20
+
+type cachedDoc struct {
+	content      string
+	hash         string // sha256 of content
+	fetchedAt    time.Time
+	etag         string
+	lastModified string
+}
+
+// diskDoc is the on-disk form of a cachedDoc
+type diskDoc struct {
+	URL          string    `json:"url"`
+	Content      string    `json:"content"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+}
+
+var cache = &docCache{
+	docs: make(map[string]cachedDoc),
+	ttl:  15 * time.Minute,
+	client: &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: newDocTransport(),
+	},
+}
+
+// newDocTransport returns an HTTP transport that also serves file:// URLs,
+// for docs mirrored to or written on local disk
+func newDocTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return t
+}
+
+// fetch retrieves a document. Cached copies are always served immediately;
+// stale ones are revalidated in the background. Only a document that has
+// never been cached waits on upstream, and concurrent requests for it share
+// a single HTTP request.
+func (c *docCache) fetch(ctx context.Context, url, fallback string) (content string, err error) {
+	ctx, span := tracer.Start(ctx, "docCache.fetch", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	if doc, ok := c.lookup(url); ok {
+		if time.Since(doc.fetchedAt) >= c.ttl {
+			c.goBackground(func() { c.refresh(url) })
+		}
+		metrics.docCache.inc("hit")
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return doc.content, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	v, err, _ := c.inflight.Do(url, func() (interface{}, error) {
+		// detach from the caller so one cancelled read doesn't fail the others
+		return c.revalidate(context.WithoutCancel(ctx), url)
+	})
+	if err != nil {
+		return c.fallbackOrError(ctx, url, fallback, err)
+	}
+	metrics.docCache.inc("miss")
+	return v.(cachedDoc).content, nil
+}
+
+// goBackground runs fn in a goroutine that close waits for. Nothing new is
+// started once the cache is closing.
+func (c *docCache) goBackground(fn func()) {
+	c.bgMu.Lock()
+	defer c.bgMu.Unlock()
+	if c.closing {
+		return
+	}
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		fn()
+	}()
+}
+
+// close stops background refreshes and waits for those in progress to
+// finish writing to disk, or for ctx to be done
+func (c *docCache) close(ctx context.Context) error {
+	c.bgMu.Lock()
+	c.closing = true
+	c.bgMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh revalidates a cached document, sharing the request with any
+// concurrent fetch of the same URL
+func (c *docCache) refresh(url string) {
+	_, err, _ := c.inflight.Do(url, func() (interface{}, error) {
+		return c.revalidate(context.Background(), url)
+	})
+	if err != nil {
+		if doc, ok := c.lookup(url); ok {
+			slog.Warn("Failed to refresh doc, serving cached copy", "url", url, "error", err, "fetched_at", doc.fetchedAt)
+		} else {
+			slog.Warn("Failed to refresh doc", "url", url, "error", err)
+		}
+	}
+}
+
+// revalidate fetches url from upstream, using a conditional GET when a copy
+// is cached, and stores the result
+func (c *docCache) revalidate(ctx context.Context, url string) (_ cachedDoc, err error) {
+	doc, cached := c.lookup(url)
+
+	ctx, span := tracer.Start(ctx, "docCache.revalidate", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("url.full", url),
+		attribute.Bool("cache.conditional", cached),
+	))
+	defer func() { endSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return cachedDoc{}, err
+	}
+	if cached {
+		if doc.etag != "" {
+			req.Header.Set("If-None-Match", doc.etag)
+		}
+		if doc.lastModified != "" {
+			req.Header.Set("If-Modified-Since", doc.lastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return cachedDoc{}, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		doc.fetchedAt = time.Now()
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, docMaxBytes+1))
+		if err != nil {
+			return cachedDoc{}, err
+		}
+		if len(body) > docMaxBytes {
+			return cachedDoc{}, fmt.Errorf("document is larger than %d MiB", docMaxBytes>>20)
+		}
+		previous := doc.hash
+		doc = cachedDoc{
+			content:      string(body),
+			hash:         contentHash(string(body)),
+			fetchedAt:    time.Now(),
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+		}
+		if cached && doc.hash != previous && c.onChange != nil {
+			defer c.onChange(url)
+		}
+	default:
+		return cachedDoc{}, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	c.store(url, doc)
+	return doc, nil
+}
+
+// warm fetches every configured document for the default release so
+// the first reads are served from cache
+func (c *docCache) warm(ctx context.Context) {
+	release, _ := lookupRelease(defaultKuadrantVersion)
+
+	docs := sources.all()
+	var wg sync.WaitGroup
+	for _, source := range docs {
+		wg.Add(1)
+		go func(source docSource) {
+			defer wg.Done()
+			c.fetch(ctx, source.rawURL(release), source.fallback)
+		}(source)
+	}
+	wg.Wait()
+	c.warmed.Store(true)
+	slog.Info("Prefetched docs", "count", len(docs))
+}
+
+// refreshLoop revalidates cached documents every interval, refreshing any
+// that would expire before the next tick so reads never see a stale copy
+func (c *docCache) refreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var due []string
+		c.mu.RLock()
+		for url, doc := range c.docs {
+			if time.Since(doc.fetchedAt)+interval >= c.ttl {
+				due = append(due, url)
+			}
+		}
+		c.mu.RUnlock()
+
+		for _, url := range due {
+			c.refresh(url)
+		}
+	}
+}
+
+// lookup returns the cached document for url from memory, falling back to disk
+func (c *docCache) lookup(url string) (cachedDoc, bool) {
+	c.mu.RLock()
+	doc, ok := c.docs[url]
+	c.mu.RUnlock()
+	if ok || c.dir == "" {
+		return doc, ok
+	}
+
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to read cached doc", "url", url, "error", err)
+		}
+		return cachedDoc{}, false
+	}
+	var d diskDoc
+	if err := json.Unmarshal(data, &d); err != nil || d.URL != url {
+		slog.Warn("Ignoring corrupt cache entry", "url", url)
+		return cachedDoc{}, false
+	}
+
+	doc = cachedDoc{
+		content:      d.Content,
+		hash:         contentHash(d.Content),
+		fetchedAt:    d.FetchedAt,
+		etag:         d.ETag,
+		lastModified: d.LastModified,
+	}
+	c.mu.Lock()
+	c.docs[url] = doc
+	c.mu.Unlock()
+	return doc, true
+}
+
+// store saves a document in memory and, if configured, on disk
+func (c *docCache) store(url string, doc cachedDoc) {
+	c.mu.Lock()
+	c.docs[url] = doc
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return
+	}
+	if err := c.writeDisk(url, doc); err != nil {
+		slog.Warn("Failed to persist doc to cache", "url", url, "error", err)
+	}
+}
+
+// writeDisk atomically writes a document to the cache directory
+func (c *docCache) writeDisk(url string, doc cachedDoc) error {
+	data, err := json.Marshal(diskDoc{
+		URL:          url,
+		Content:      doc.content,
+		FetchedAt:    doc.fetchedAt,
+		ETag:         doc.etag,
+		LastModified: doc.lastModified,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".doc-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(url))
+}
+
+// path returns the cache file for url
+func (c *docCache) path(url string) string {
+	return filepath.Join(c.dir, contentHash(url)+".json")
+}
+
+func contentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *docCache) fallbackOrError(ctx context.Context, url, fallback string, err error) (string, error) {
+	if fallback != "" {
+		slog.WarnContext(ctx, "Failed to fetch doc, using fallback", "url", url, "error", err)
+		metrics.docCache.inc("fallback")
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.fallback_used", true))
+		return fallback, nil
+	}
+	metrics.docCache.inc("error")
+	return "", fmt.Errorf("failed to fetch %s: %w", url, err)
+}
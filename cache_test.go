@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testUpstream is a docs server whose content and ETag can be changed,
+// recording the conditional headers of each request
+type testUpstream struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	content     string
+	etag        string
+	status      int // served instead of the document when set
+	hits        int
+	conditional []string // If-None-Match and If-Modified-Since, per request
+}
+
+func newTestUpstream(t *testing.T, content, etag string) *testUpstream {
+	u := &testUpstream{content: content, etag: etag}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.hits++
+		u.conditional = append(u.conditional, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		if u.status != 0 {
+			w.WriteHeader(u.status)
+			return
+		}
+		w.Header().Set("ETag", u.etag)
+		w.Header().Set("Last-Modified", "Mon, 05 Oct 2026 10:00:00 GMT")
+		if r.Header.Get("If-None-Match") == u.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(u.content))
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func (u *testUpstream) set(content, etag string, status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.content, u.etag, u.status = content, etag, status
+}
+
+func (u *testUpstream) requests() (int, []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.hits, append([]string(nil), u.conditional...)
+}
+
+func newTestCache(dir string) *docCache {
+	return &docCache{docs: make(map[string]cachedDoc), ttl: time.Hour, client: http.DefaultClient, dir: dir}
+}
+
+func TestDocCachePersistence(t *testing.T) {
+	upstream := newTestUpstream(t, "# AuthPolicy", `"v1"`)
+	dir := t.TempDir()
+	url := upstream.URL + "/authpolicy.md"
+
+	if _, err := newTestCache(dir).fetch(context.Background(), url, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, contentHash(url)+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d diskDoc
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.URL != url || d.Content != "# AuthPolicy" || d.ETag != `"v1"` || d.LastModified == "" {
+		t.Errorf("cached on disk as %+v", d)
+	}
+
+	// a new cache, e.g. after a restart, serves the copy on disk without
+	// going upstream
+	upstream.Close()
+	got, err := newTestCache(dir).fetch(context.Background(), url, "")
+	if err != nil || got != "# AuthPolicy" {
+		t.Errorf("got %q, %v after a restart", got, err)
+	}
+	if hits, _ := upstream.requests(); hits != 1 {
+		t.Errorf("upstream was hit %d times, want 1", hits)
+	}
+}
+
+func TestDocCacheRevalidate(t *testing.T) {
+	upstream := newTestUpstream(t, "# AuthPolicy", `"v1"`)
+	c := newTestCache("")
+	var changed []string
+	c.onChange = func(url string) { changed = append(changed, url) }
+	url := upstream.URL + "/authpolicy.md"
+	ctx := context.Background()
+
+	first, err := c.revalidate(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 304 keeps the content and restarts the TTL
+	time.Sleep(time.Millisecond)
+	second, err := c.revalidate(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.content != "# AuthPolicy" || !second.fetchedAt.After(first.fetchedAt) {
+		t.Errorf("after a 304: %q fetched at %v, first fetched at %v", second.content, second.fetchedAt, first.fetchedAt)
+	}
+	if len(changed) != 0 {
+		t.Errorf("onChange called for an unchanged doc: %v", changed)
+	}
+
+	upstream.set("# AuthPolicy v2", `"v2"`, 0)
+	third, err := c.revalidate(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.content != "# AuthPolicy v2" || third.etag != `"v2"` {
+		t.Errorf("after a change: %q with ETag %s", third.content, third.etag)
+	}
+	if len(changed) != 1 || changed[0] != url {
+		t.Errorf("onChange calls = %v, want one for %s", changed, url)
+	}
+
+	_, conditional := upstream.requests()
+	want := []string{"|", `"v1"|Mon, 05 Oct 2026 10:00:00 GMT`, `"v1"|Mon, 05 Oct 2026 10:00:00 GMT`}
+	if strings.Join(conditional, "\n") != strings.Join(want, "\n") {
+		t.Errorf("conditional headers = %q, want %q", conditional, want)
+	}
+}
+
+func TestDocCacheStaleOnError(t *testing.T) {
+	upstream := newTestUpstream(t, "# AuthPolicy", `"v1"`)
+	upstream.set("", "", http.StatusBadGateway)
+	url := upstream.URL + "/authpolicy.md"
+	c := newTestCache(t.TempDir())
+	c.store(url, cachedDoc{content: "# Cached", hash: contentHash("# Cached"), fetchedAt: time.Now().Add(-2 * time.Hour)})
+
+	got, err := c.fetch(context.Background(), url, "")
+	if err != nil || got != "# Cached" {
+		t.Fatalf("got %q, %v, want the stale copy", got, err)
+	}
+	// wait for the background refresh, which fails
+	if err := c.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := upstream.requests(); hits != 1 {
+		t.Errorf("upstream was hit %d times, want a background refresh", hits)
+	}
+	if doc, _ := c.lookup(url); doc.content != "# Cached" {
+		t.Errorf("cached copy replaced with %q", doc.content)
+	}
+
+	// a document never cached falls back, or fails without a fallback
+	uncached := upstream.URL + "/dnspolicy.md"
+	if got, err := newTestCache("").fetch(context.Background(), uncached, "# DNSPolicy"); err != nil || got != "# DNSPolicy" {
+		t.Errorf("got %q, %v, want the fallback", got, err)
+	}
+	if _, err := newTestCache("").fetch(context.Background(), uncached, ""); err == nil || !strings.HasSuffix(err.Error(), "HTTP 502") {
+		t.Errorf("error %v, want HTTP 502", err)
+	}
+}
+
+func TestDocCacheTooLarge(t *testing.T) {
+	upstream := newTestUpstream(t, strings.Repeat("a", docMaxBytes+1), `"v1"`)
+	c := newTestCache("")
+	url := upstream.URL + "/huge.md"
+	if _, err := c.revalidate(context.Background(), url); err == nil || err.Error() != "document is larger than 8 MiB" {
+		t.Errorf("error %v", err)
+	}
+	if _, ok := c.lookup(url); ok {
+		t.Error("oversized document was cached")
+	}
+}
+
+func TestWriteDisk(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCache(dir)
+	url := "https://example.com/authpolicy.md"
+
+	for _, content := range []string{"# v1", "# v2"} {
+		if err := c.writeDisk(url, cachedDoc{content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if doc, ok := newTestCache(dir).lookup(url); !ok || doc.content != "# v2" {
+		t.Errorf("read back %q, %v, want the last write", doc.content, ok)
+	}
+
+	// a failed write leaves no temporary files behind
+	blocked := "https://example.com/blocked.md"
+	if err := os.Mkdir(c.path(blocked), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.writeDisk(blocked, cachedDoc{content: "# blocked"}); err == nil {
+		t.Error("write over a directory succeeded")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".doc-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d entries in the cache directory, want 2", len(entries))
+	}
+}
+
+func TestDocCacheFetchCollapsesRequests(t *testing.T) {
+	release := make(chan struct{})
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Write([]byte("# AuthPolicy"))
+	}))
+	defer upstream.Close()
+	c := newTestCache("")
+	url := upstream.URL + "/authpolicy.md"
+
+	const readers = 10
+	var wg sync.WaitGroup
+	results := make(chan string, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := c.fetch(context.Background(), url, "")
+			if err != nil {
+				t.Error(err)
+			}
+			results <- content
+		}()
+	}
+	// hold upstream until the first request arrives, giving the others
+	// time to join it
+	waitFor(t, func() bool { return hits.Load() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for content := range results {
+		if content != "# AuthPolicy" {
+			t.Errorf("got %q", content)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream was hit %d times by %d concurrent reads, want 1", n, readers)
+	}
+}
+
+func TestDocCacheRefreshLoop(t *testing.T) {
+	upstream := newTestUpstream(t, "# AuthPolicy", `"v1"`)
+	c := newTestCache("")
+	c.ttl = 100 * time.Millisecond
+	fresh, stale := upstream.URL+"/fresh.md", upstream.URL+"/stale.md"
+	c.store(fresh, cachedDoc{content: "# Fresh", fetchedAt: time.Now().Add(time.Hour)})
+	c.store(stale, cachedDoc{content: "# Stale", fetchedAt: time.Now().Add(-time.Hour)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.refreshLoop(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	// documents due to expire are refreshed before anyone reads them
+	waitFor(t, func() bool {
+		doc, _ := c.lookup(stale)
+		return doc.content == "# AuthPolicy"
+	})
+	cancel()
+	<-done
+
+	if doc, _ := c.lookup(fresh); doc.content != "# Fresh" {
+		t.Errorf("a fresh document was refreshed to %q", doc.content)
+	}
+	// only the stale document went upstream
+	if hits, _ := upstream.requests(); hits != 1 {
+		t.Errorf("upstream was hit %d times, want 1", hits)
+	}
+}
+
+func TestDocCacheWarm(t *testing.T) {
+	useDocs(t, map[string]string{
+		"kuadrant://docs/authpolicy": "# AuthPolicy",
+		"kuadrant://docs/dnspolicy":  "# DNSPolicy",
+	})
+	c := newTestCache("")
+	c.client = &http.Client{Transport: newDocTransport()}
+	c.warm(context.Background())
+
+	if !c.warmed.Load() {
+		t.Error("warmed is not set")
+	}
+	if len(c.docs) != 2 {
+		t.Errorf("got %d cached docs, want 2", len(c.docs))
+	}
+}
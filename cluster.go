@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// defaultKuadrantNamespace is where the Kuadrant operator is usually installed
+const defaultKuadrantNamespace = "kuadrant-system"
+
+// policyKinds are the Kuadrant policy kinds the cluster tools inspect
+var policyKinds = []schema.GroupKind{
+	{Group: "kuadrant.io", Kind: "AuthPolicy"},
+	{Group: "kuadrant.io", Kind: "RateLimitPolicy"},
+	{Group: "kuadrant.io", Kind: "TokenRateLimitPolicy"},
+	{Group: "kuadrant.io", Kind: "DNSPolicy"},
+	{Group: "kuadrant.io", Kind: "TLSPolicy"},
+}
+
+var (
+	gatewayKind    = schema.GroupKind{Group: "gateway.networking.k8s.io", Kind: "Gateway"}
+	httpRouteKind  = schema.GroupKind{Group: "gateway.networking.k8s.io", Kind: "HTTPRoute"}
+	dnsRecordKind  = schema.GroupKind{Group: "kuadrant.io", Kind: "DNSRecord"}
+	kuadrantKind   = schema.GroupKind{Group: "kuadrant.io", Kind: "Kuadrant"}
+	limitadorKind  = schema.GroupKind{Group: "limitador.kuadrant.io", Kind: "Limitador"}
+	authorinoKind  = schema.GroupKind{Group: "operator.authorino.kuadrant.io", Kind: "Authorino"}
+	deploymentKind = schema.GroupKind{Group: "apps", Kind: "Deployment"}
+)
+
+// clusterClient reads Kuadrant state from a cluster. Apart from
+// apply_manifest, which only changes objects when allowWrites is set, it
+// only gets and lists objects. Kinds are resolved through the mapper so the
+// served API versions of the installed release are used.
+type clusterClient struct {
+	dynamic dynamic.Interface
+	mapper  meta.RESTMapper
+
+	// allowWrites lets apply_manifest apply for real rather than dry run
+	allowWrites bool
+}
+
+// cluster is set when -kubernetes enables the cluster tools
+var cluster *clusterClient
+
+// newClusterClient connects using kubeconfig, or the standard kubeconfig
+// loading rules and in-cluster config if it's empty
+func newClusterClient(kubeconfig, kubeContext string) (*clusterClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	config.UserAgent = "kuadrant-mcp-server/" + serverVersion
+
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disco))
+	return &clusterClient{dynamic: dyn, mapper: mapper}, nil
+}
+
+// resource returns the client for a kind, scoped to namespace if set
+func (c *clusterClient) resource(kind schema.GroupKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := c.mapper.RESTMapping(kind)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("%s is not installed in the cluster: %w", kind.Kind, err)
+		}
+		return nil, err
+	}
+	if namespace == "" {
+		return c.dynamic.Resource(mapping.Resource), nil
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+func (c *clusterClient) list(ctx context.Context, kind schema.GroupKind, namespace string) ([]unstructured.Unstructured, error) {
+	res, err := c.resource(kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+	list, err := res.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", kind.Kind, err)
+	}
+	return list.Items, nil
+}
+
+func (c *clusterClient) get(ctx context.Context, kind schema.GroupKind, namespace, name string) (*unstructured.Unstructured, error) {
+	res, err := c.resource(kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := res.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting %s %s/%s: %w", kind.Kind, namespace, name, err)
+	}
+	return obj, nil
+}
+
+// listIn lists objects of a kind in each of namespaces
+func (c *clusterClient) listIn(ctx context.Context, kind schema.GroupKind, namespaces []string) ([]unstructured.Unstructured, error) {
+	var items []unstructured.Unstructured
+	for _, namespace := range namespaces {
+		list, err := c.list(ctx, kind, namespace)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, list...)
+	}
+	return items, nil
+}
+
+// namespacesFor returns the namespaces a read tool looks in for the
+// namespace asked for, "" meaning all of them, keeping to the caller's
+// tenant's allowedNamespaces
+func namespacesFor(ctx context.Context, namespace string) ([]string, error) {
+	allowed := tenantNamespaces(ctx)
+	switch {
+	case len(allowed) == 0:
+		return []string{namespace}, nil
+	case namespace == "":
+		return allowed, nil
+	case slices.Contains(allowed, namespace):
+		return []string{namespace}, nil
+	}
+	return nil, fmt.Errorf("this tenant can't read namespace %s, only %s", namespace, strings.Join(allowed, ", "))
+}
+
+// listPolicies lists policies of the given kinds in namespaces, skipping
+// kinds that aren't installed
+func (c *clusterClient) listPolicies(ctx context.Context, kinds []schema.GroupKind, namespaces []string) ([]unstructured.Unstructured, error) {
+	var policies []unstructured.Unstructured
+	for _, kind := range kinds {
+		items, err := c.listIn(ctx, kind, namespaces)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, items...)
+	}
+	return policies, nil
+}
+
+// conditionSummary is a status condition without the fields that only
+// matter to controllers
+type conditionSummary struct {
+	Type    string `yaml:"type"`
+	Status  string `yaml:"status"`
+	Reason  string `yaml:"reason,omitempty"`
+	Message string `yaml:"message,omitempty"`
+	Since   string `yaml:"since,omitempty"`
+}
+
+// objectRef identifies a Gateway API object a policy targets or a route
+// attaches to
+type objectRef struct {
+	Group       string `yaml:"group,omitempty"`
+	Kind        string `yaml:"kind"`
+	Name        string `yaml:"name"`
+	Namespace   string `yaml:"namespace,omitempty"`
+	SectionName string `yaml:"sectionName,omitempty"`
+}
+
+type policySummary struct {
+	Kind       string             `yaml:"kind"`
+	Name       string             `yaml:"name"`
+	Namespace  string             `yaml:"namespace"`
+	Targets    []objectRef        `yaml:"targets"`
+	State      string             `yaml:"state"`
+	Conditions []conditionSummary `yaml:"conditions,omitempty"`
+}
+
+// conditionsAt reads the conditions at the given path of an object
+func conditionsAt(obj map[string]interface{}, fields ...string) []conditionSummary {
+	raw, _, _ := unstructured.NestedSlice(obj, fields...)
+	var conditions []conditionSummary
+	for _, item := range raw {
+		c, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditions = append(conditions, conditionSummary{
+			Type:    stringField(c, "type"),
+			Status:  stringField(c, "status"),
+			Reason:  stringField(c, "reason"),
+			Message: stringField(c, "message"),
+			Since:   stringField(c, "lastTransitionTime"),
+		})
+	}
+	return conditions
+}
+
+func stringField(obj map[string]interface{}, fields ...string) string {
+	s, _, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprint(s)
+}
+
+func intField(obj map[string]interface{}, fields ...string) int64 {
+	n, _, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	switch n := n.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func findCondition(conditions []conditionSummary, condType string) *conditionSummary {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// policyState sums up a policy's Accepted and Enforced conditions
+func policyState(conditions []conditionSummary) string {
+	accepted := findCondition(conditions, "Accepted")
+	enforced := findCondition(conditions, "Enforced")
+	switch {
+	case accepted == nil:
+		return "Unknown (no status yet)"
+	case accepted.Status != "True":
+		return "NotAccepted (" + accepted.Reason + ")"
+	case enforced == nil:
+		return "Accepted"
+	case enforced.Status != "True":
+		return "NotEnforced (" + enforced.Reason + ")"
+	default:
+		return "Enforced"
+	}
+}
+
+// policyTargets reads spec.targetRef and spec.targetRefs, which default
+// to the policy's namespace
+func policyTargets(policy *unstructured.Unstructured) []objectRef {
+	var raw []interface{}
+	if ref, ok, _ := unstructured.NestedMap(policy.Object, "spec", "targetRef"); ok {
+		raw = append(raw, ref)
+	}
+	if refs, ok, _ := unstructured.NestedSlice(policy.Object, "spec", "targetRefs"); ok {
+		raw = append(raw, refs...)
+	}
+	var targets []objectRef
+	for _, item := range raw {
+		ref, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		targets = append(targets, objectRef{
+			Group:       stringField(ref, "group"),
+			Kind:        stringField(ref, "kind"),
+			Name:        stringField(ref, "name"),
+			Namespace:   policy.GetNamespace(),
+			SectionName: stringField(ref, "sectionName"),
+		})
+	}
+	return targets
+}
+
+func summarisePolicy(policy *unstructured.Unstructured) policySummary {
+	conditions := conditionsAt(policy.Object, "status", "conditions")
+	return policySummary{
+		Kind:       policy.GetKind(),
+		Name:       policy.GetName(),
+		Namespace:  policy.GetNamespace(),
+		Targets:    policyTargets(policy),
+		State:      policyState(conditions),
+		Conditions: conditions,
+	}
+}
+
+// renderSummary renders a summary as YAML for a tool result
+func renderSummary(v interface{}) (string, error) {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("Error: Failed to render summary: %v", err), nil
+	}
+	return string(out), nil
+}
+
+// lookupPolicyKind resolves a policy kind name, case-insensitively
+func lookupPolicyKind(kind string) (schema.GroupKind, bool) {
+	for _, gk := range policyKinds {
+		if strings.EqualFold(gk.Kind, kind) {
+			return gk, true
+		}
+	}
+	return schema.GroupKind{}, false
+}
+
+func policyKindNames() string {
+	var names []string
+	for _, gk := range policyKinds {
+		names = append(names, gk.Kind)
+	}
+	return strings.Join(names, ", ")
+}
+
+type ListPoliciesParams struct {
+	Namespace string `json:"namespace,omitempty" jsonschema:"Namespace to list policies in (default: all namespaces)"`
+	Kind      string `json:"kind,omitempty" jsonschema:"Policy kind to list, e.g. RateLimitPolicy (default: all Kuadrant policy kinds)"`
+}
+
+func (c *clusterClient) listPoliciesHandler(ctx context.Context, params ListPoliciesParams) (string, error) {
+	kinds := policyKinds
+	if params.Kind != "" {
+		kind, ok := lookupPolicyKind(params.Kind)
+		if !ok {
+			return fmt.Sprintf("Error: unknown policy kind %q, expected one of %s", params.Kind, policyKindNames()), nil
+		}
+		kinds = []schema.GroupKind{kind}
+	}
+
+	namespaces, err := namespacesFor(ctx, params.Namespace)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	policies, err := c.listPolicies(ctx, kinds, namespaces)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	summaries := make([]policySummary, 0, len(policies))
+	for i := range policies {
+		summary := summarisePolicy(&policies[i])
+		summary.Conditions = nil
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	if len(summaries) == 0 {
+		return "No Kuadrant policies found", nil
+	}
+	return renderSummary(map[string]interface{}{"policies": summaries})
+}
+
+type GetPolicyStatusParams struct {
+	Kind      string `json:"kind" jsonschema:"Policy kind, e.g. AuthPolicy"`
+	Name      string `json:"name" jsonschema:"Name of the policy"`
+	Namespace string `json:"namespace" jsonschema:"Namespace of the policy"`
+}
+
+// targetStatus is a policy target and whether it exists
+type targetStatus struct {
+	objectRef  `yaml:",inline"`
+	Found      bool               `yaml:"found"`
+	Error      string             `yaml:"error,omitempty"`
+	Conditions []conditionSummary `yaml:"conditions,omitempty"`
+}
+
+func (c *clusterClient) getPolicyStatusHandler(ctx context.Context, params GetPolicyStatusParams) (string, error) {
+	if params.Kind == "" || params.Name == "" || params.Namespace == "" {
+		return "Error: kind, name and namespace are required", nil
+	}
+	kind, ok := lookupPolicyKind(params.Kind)
+	if !ok {
+		return fmt.Sprintf("Error: unknown policy kind %q, expected one of %s", params.Kind, policyKindNames()), nil
+	}
+	if _, err := namespacesFor(ctx, params.Namespace); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	policy, err := c.get(ctx, kind, params.Namespace, params.Name)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	summary := summarisePolicy(policy)
+
+	var targets []targetStatus
+	for _, ref := range summary.Targets {
+		target := targetStatus{objectRef: ref}
+		obj, err := c.get(ctx, schema.GroupKind{Group: ref.Group, Kind: ref.Kind}, ref.Namespace, ref.Name)
+		if err != nil {
+			target.Error = err.Error()
+		} else {
+			target.Found = true
+			target.Conditions = conditionsAt(obj.Object, "status", "conditions")
+			if ref.Kind == "HTTPRoute" {
+				// route conditions are reported per parent
+				target.Conditions = nil
+				parents, _, _ := unstructured.NestedSlice(obj.Object, "status", "parents")
+				for _, parent := range parents {
+					if p, ok := parent.(map[string]interface{}); ok {
+						target.Conditions = append(target.Conditions, conditionsAt(p, "conditions")...)
+					}
+				}
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	return renderSummary(map[string]interface{}{
+		"policy":  summary,
+		"targets": targets,
+	})
+}
+
+type DescribeGatewayParams struct {
+	Name      string `json:"name" jsonschema:"Name of the Gateway"`
+	Namespace string `json:"namespace" jsonschema:"Namespace of the Gateway"`
+}
+
+type listenerSummary struct {
+	Name           string             `yaml:"name"`
+	Hostname       string             `yaml:"hostname,omitempty"`
+	Port           int64              `yaml:"port"`
+	Protocol       string             `yaml:"protocol"`
+	AttachedRoutes *int64             `yaml:"attachedRoutes,omitempty"`
+	Conditions     []conditionSummary `yaml:"conditions,omitempty"`
+}
+
+type routeSummary struct {
+	Name      string          `yaml:"name"`
+	Namespace string          `yaml:"namespace"`
+	Hostnames []string        `yaml:"hostnames,omitempty"`
+	Policies  []policySummary `yaml:"policies,omitempty"`
+}
+
+type gatewaySummary struct {
+	Name             string             `yaml:"name"`
+	Namespace        string             `yaml:"namespace"`
+	GatewayClassName string             `yaml:"gatewayClassName"`
+	Addresses        []string           `yaml:"addresses,omitempty"`
+	Conditions       []conditionSummary `yaml:"conditions,omitempty"`
+	Listeners        []listenerSummary  `yaml:"listeners"`
+	Policies         []policySummary    `yaml:"policies,omitempty"`
+	Routes           []routeSummary     `yaml:"routes,omitempty"`
+}
+
+func (c *clusterClient) describeGatewayHandler(ctx context.Context, params DescribeGatewayParams) (string, error) {
+	if params.Name == "" || params.Namespace == "" {
+		return "Error: name and namespace are required", nil
+	}
+	if _, err := namespacesFor(ctx, params.Namespace); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	gateway, err := c.get(ctx, gatewayKind, params.Namespace, params.Name)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	summary := gatewaySummary{
+		Name:             gateway.GetName(),
+		Namespace:        gateway.GetNamespace(),
+		GatewayClassName: stringField(gateway.Object, "spec", "gatewayClassName"),
+		Conditions:       conditionsAt(gateway.Object, "status", "conditions"),
+	}
+	addresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+	for _, address := range addresses {
+		if a, ok := address.(map[string]interface{}); ok {
+			summary.Addresses = append(summary.Addresses, stringField(a, "value"))
+		}
+	}
+
+	listenerStatus := make(map[string]map[string]interface{})
+	statuses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "listeners")
+	for _, status := range statuses {
+		if s, ok := status.(map[string]interface{}); ok {
+			listenerStatus[stringField(s, "name")] = s
+		}
+	}
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	for _, listener := range listeners {
+		l, ok := listener.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ls := listenerSummary{
+			Name:     stringField(l, "name"),
+			Hostname: stringField(l, "hostname"),
+			Port:     intField(l, "port"),
+			Protocol: stringField(l, "protocol"),
+		}
+		if status, ok := listenerStatus[ls.Name]; ok {
+			attached := intField(status, "attachedRoutes")
+			ls.AttachedRoutes = &attached
+			ls.Conditions = conditionsAt(status, "conditions")
+		}
+		summary.Listeners = append(summary.Listeners, ls)
+	}
+
+	// routes and policies in namespaces the tenant can't read are left out
+	namespaces, _ := namespacesFor(ctx, "")
+	policies, err := c.listPolicies(ctx, policyKinds, namespaces)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	summary.Policies = policiesTargeting(policies, gatewayKind, gateway.GetNamespace(), gateway.GetName())
+
+	routes, err := c.listIn(ctx, httpRouteKind, namespaces)
+	if err != nil && !meta.IsNoMatchError(err) {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	for i := range routes {
+		route := &routes[i]
+		if !routeAttachesTo(route, gateway.GetNamespace(), gateway.GetName()) {
+			continue
+		}
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+		summary.Routes = append(summary.Routes, routeSummary{
+			Name:      route.GetName(),
+			Namespace: route.GetNamespace(),
+			Hostnames: hostnames,
+			Policies:  policiesTargeting(policies, httpRouteKind, route.GetNamespace(), route.GetName()),
+		})
+	}
+
+	return renderSummary(summary)
+}
+
+// policiesTargeting returns summaries of the policies whose targets
+// include the named object
+func policiesTargeting(policies []unstructured.Unstructured, kind schema.GroupKind, namespace, name string) []policySummary {
+	var summaries []policySummary
+	for i := range policies {
+		summary := summarisePolicy(&policies[i])
+		if slices.ContainsFunc(summary.Targets, func(ref objectRef) bool {
+			return ref.Kind == kind.Kind && ref.Namespace == namespace && ref.Name == name
+		}) {
+			summary.Conditions = nil
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
+
+// routeAttachesTo reports whether a route has the Gateway as a parent.
+// Parent namespaces default to the route's.
+func routeAttachesTo(route *unstructured.Unstructured, namespace, name string) bool {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	for _, parent := range parents {
+		p, ok := parent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if kind := stringField(p, "kind"); kind != "" && kind != gatewayKind.Kind {
+			continue
+		}
+		parentNamespace := stringField(p, "namespace")
+		if parentNamespace == "" {
+			parentNamespace = route.GetNamespace()
+		}
+		if parentNamespace == namespace && stringField(p, "name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+type ListDNSRecordsParams struct {
+	Namespace string `json:"namespace,omitempty" jsonschema:"Namespace to list DNSRecords in (default: all namespaces)"`
+}
+
+type dnsRecordSummary struct {
+	Name       string             `yaml:"name"`
+	Namespace  string             `yaml:"namespace"`
+	RootHost   string             `yaml:"rootHost"`
+	OwnedBy    string             `yaml:"ownedBy,omitempty"`
+	Endpoints  []string           `yaml:"endpoints,omitempty"`
+	State      string             `yaml:"state"`
+	Conditions []conditionSummary `yaml:"conditions,omitempty"`
+}
+
+func (c *clusterClient) listDNSRecordsHandler(ctx context.Context, params ListDNSRecordsParams) (string, error) {
+	namespaces, err := namespacesFor(ctx, params.Namespace)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	records, err := c.listIn(ctx, dnsRecordKind, namespaces)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	summaries := make([]dnsRecordSummary, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		summary := dnsRecordSummary{
+			Name:       record.GetName(),
+			Namespace:  record.GetNamespace(),
+			RootHost:   stringField(record.Object, "spec", "rootHost"),
+			Conditions: conditionsAt(record.Object, "status", "conditions"),
+			State:      "Unknown (no status yet)",
+		}
+		for _, owner := range record.GetOwnerReferences() {
+			summary.OwnedBy = owner.Kind + "/" + owner.Name
+		}
+		endpoints, _, _ := unstructured.NestedSlice(record.Object, "spec", "endpoints")
+		for _, endpoint := range endpoints {
+			e, ok := endpoint.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			targets, _, _ := unstructured.NestedStringSlice(e, "targets")
+			summary.Endpoints = append(summary.Endpoints, fmt.Sprintf("%s %s -> %s", stringField(e, "dnsName"), stringField(e, "recordType"), strings.Join(targets, ", ")))
+		}
+		if ready := findCondition(summary.Conditions, "Ready"); ready != nil {
+			summary.State = "Ready"
+			if ready.Status != "True" {
+				summary.State = "NotReady (" + ready.Reason + ")"
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	if len(summaries) == 0 {
+		return "No DNSRecords found", nil
+	}
+	return renderSummary(map[string]interface{}{"dnsRecords": summaries})
+}
+
+type GetKuadrantStatusParams struct {
+	Namespace string `json:"namespace,omitempty" jsonschema:"Namespace Kuadrant is installed in (default: kuadrant-system)"`
+}
+
+type componentSummary struct {
+	Kind       string             `yaml:"kind"`
+	Name       string             `yaml:"name,omitempty"`
+	Ready      string             `yaml:"ready,omitempty"`
+	Conditions []conditionSummary `yaml:"conditions,omitempty"`
+	Error      string             `yaml:"error,omitempty"`
+}
+
+func (c *clusterClient) getKuadrantStatusHandler(ctx context.Context, params GetKuadrantStatusParams) (string, error) {
+	namespace := params.Namespace
+	if namespace == "" {
+		namespace = defaultKuadrantNamespace
+	}
+
+	var components []componentSummary
+	for _, kind := range []schema.GroupKind{kuadrantKind, limitadorKind, authorinoKind} {
+		items, err := c.list(ctx, kind, namespace)
+		if err != nil {
+			components = append(components, componentSummary{Kind: kind.Kind, Error: err.Error()})
+			continue
+		}
+		if len(items) == 0 {
+			components = append(components, componentSummary{Kind: kind.Kind, Error: "none found in " + namespace})
+		}
+		for _, item := range items {
+			components = append(components, componentSummary{
+				Kind:       kind.Kind,
+				Name:       item.GetName(),
+				Conditions: conditionsAt(item.Object, "status", "conditions"),
+			})
+		}
+	}
+
+	deployments, err := c.list(ctx, deploymentKind, namespace)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	for _, deployment := range deployments {
+		components = append(components, componentSummary{
+			Kind:  "Deployment",
+			Name:  deployment.GetName(),
+			Ready: fmt.Sprintf("%d/%d", intField(deployment.Object, "status", "readyReplicas"), intField(deployment.Object, "spec", "replicas")),
+		})
+	}
+
+	return renderSummary(map[string]interface{}{
+		"namespace":  namespace,
+		"components": components,
+	})
+}
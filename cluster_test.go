@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// fakeKinds are the kinds the fake cluster serves. TokenRateLimitPolicy,
+// DNSPolicy and TLSPolicy are left out, as on a cluster without them.
+var fakeKinds = []struct {
+	gvk        schema.GroupVersionKind
+	namespaced bool
+}{
+	{schema.GroupVersionKind{Group: "kuadrant.io", Version: "v1", Kind: "AuthPolicy"}, true},
+	{schema.GroupVersionKind{Group: "kuadrant.io", Version: "v1", Kind: "RateLimitPolicy"}, true},
+	{schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}, true},
+	{schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}, true},
+	{schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "GatewayClass"}, false},
+	{schema.GroupVersionKind{Group: "kuadrant.io", Version: "v1alpha1", Kind: "DNSRecord"}, true},
+	{schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, true},
+}
+
+// newFakeCluster returns a cluster client backed by a fake dynamic client
+// holding objects
+func newFakeCluster(objects ...runtime.Object) (*clusterClient, *dynamicfake.FakeDynamicClient) {
+	var versions []schema.GroupVersion
+	for _, k := range fakeKinds {
+		if !slices.Contains(versions, k.gvk.GroupVersion()) {
+			versions = append(versions, k.gvk.GroupVersion())
+		}
+	}
+	mapper := meta.NewDefaultRESTMapper(versions)
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, k := range fakeKinds {
+		scope := meta.RESTScopeRoot
+		if k.namespaced {
+			scope = meta.RESTScopeNamespace
+		}
+		mapper.Add(k.gvk, scope)
+		plural, _ := meta.UnsafeGuessKindToResource(k.gvk)
+		listKinds[plural] = k.gvk.Kind + "List"
+	}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+	return &clusterClient{dynamic: dyn, mapper: mapper}, dyn
+}
+
+// newObject builds an object from apiVersion, kind, namespace and name,
+// with fields merged in at the top level
+func newObject(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range fields {
+		obj.Object[k] = v
+	}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func conditions(conds ...[3]string) map[string]interface{} {
+	var list []interface{}
+	for _, c := range conds {
+		list = append(list, map[string]interface{}{"type": c[0], "status": c[1], "reason": c[2]})
+	}
+	return map[string]interface{}{"conditions": list}
+}
+
+func targetRef(kind, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"targetRef": map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": kind, "name": name},
+	}
+}
+
+func testPolicies() []runtime.Object {
+	return []runtime.Object{
+		newObject("kuadrant.io/v1", "AuthPolicy", "shop", "auth", map[string]interface{}{
+			"spec":   targetRef("HTTPRoute", "store"),
+			"status": conditions([3]string{"Accepted", "True", "Accepted"}, [3]string{"Enforced", "True", "Enforced"}),
+		}),
+		newObject("kuadrant.io/v1", "RateLimitPolicy", "shop", "limits", map[string]interface{}{
+			"spec":   targetRef("Gateway", "missing"),
+			"status": conditions([3]string{"Accepted", "False", "TargetNotFound"}),
+		}),
+		newObject("kuadrant.io/v1", "RateLimitPolicy", "api", "global", map[string]interface{}{
+			"spec": targetRef("Gateway", "external"),
+		}),
+		newObject("gateway.networking.k8s.io/v1", "HTTPRoute", "shop", "store", map[string]interface{}{
+			"status": map[string]interface{}{
+				"parents": []interface{}{
+					conditions([3]string{"Accepted", "True", "Accepted"}, [3]string{"ResolvedRefs", "True", "ResolvedRefs"}),
+				},
+			},
+		}),
+	}
+}
+
+func TestListPoliciesHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ListPoliciesParams
+		want   []string // kind/namespace/name: state, in order
+		errMsg string
+	}{
+		{
+			name:   "all namespaces and installed kinds",
+			params: ListPoliciesParams{},
+			want: []string{
+				"RateLimitPolicy/api/global: Unknown (no status yet)",
+				"AuthPolicy/shop/auth: Enforced",
+				"RateLimitPolicy/shop/limits: NotAccepted (TargetNotFound)",
+			},
+		},
+		{
+			name:   "namespace",
+			params: ListPoliciesParams{Namespace: "api"},
+			want:   []string{"RateLimitPolicy/api/global: Unknown (no status yet)"},
+		},
+		{
+			name:   "kind is case-insensitive",
+			params: ListPoliciesParams{Kind: "authpolicy"},
+			want:   []string{"AuthPolicy/shop/auth: Enforced"},
+		},
+		{
+			name:   "kind not installed",
+			params: ListPoliciesParams{Kind: "DNSPolicy"},
+			errMsg: "No Kuadrant policies found",
+		},
+		{
+			name:   "unknown kind",
+			params: ListPoliciesParams{Kind: "Gateway"},
+			errMsg: `Error: unknown policy kind "Gateway"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeCluster(testPolicies()...)
+			out, err := c.listPoliciesHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result struct {
+				Policies []policySummary `yaml:"policies"`
+			}
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			var got []string
+			for _, p := range result.Policies {
+				got = append(got, p.Kind+"/"+p.Namespace+"/"+p.Name+": "+p.State)
+				if p.Conditions != nil {
+					t.Errorf("%s: conditions should be left out of the list", p.Name)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGetPolicyStatusHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      GetPolicyStatusParams
+		state       string
+		found       bool
+		targetConds []string
+		targetErr   string
+		errMsg      string
+	}{
+		{
+			name:        "route target conditions come from its parents",
+			params:      GetPolicyStatusParams{Kind: "AuthPolicy", Namespace: "shop", Name: "auth"},
+			state:       "Enforced",
+			found:       true,
+			targetConds: []string{"Accepted", "ResolvedRefs"},
+		},
+		{
+			name:      "missing target",
+			params:    GetPolicyStatusParams{Kind: "ratelimitpolicy", Namespace: "shop", Name: "limits"},
+			state:     "NotAccepted (TargetNotFound)",
+			targetErr: `getting Gateway shop/missing`,
+		},
+		{
+			name:   "missing policy",
+			params: GetPolicyStatusParams{Kind: "AuthPolicy", Namespace: "shop", Name: "nope"},
+			errMsg: "Error: getting AuthPolicy shop/nope",
+		},
+		{
+			name:   "required parameters",
+			params: GetPolicyStatusParams{Kind: "AuthPolicy"},
+			errMsg: "Error: kind, name and namespace are required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeCluster(testPolicies()...)
+			out, err := c.getPolicyStatusHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result struct {
+				Policy  policySummary `yaml:"policy"`
+				Targets []struct {
+					Kind       string             `yaml:"kind"`
+					Found      bool               `yaml:"found"`
+					Error      string             `yaml:"error"`
+					Conditions []conditionSummary `yaml:"conditions"`
+				} `yaml:"targets"`
+			}
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if result.Policy.State != tt.state {
+				t.Errorf("state = %q, want %q", result.Policy.State, tt.state)
+			}
+			if len(result.Targets) != 1 {
+				t.Fatalf("got %d targets, want 1", len(result.Targets))
+			}
+			target := result.Targets[0]
+			if target.Found != tt.found {
+				t.Errorf("found = %v, want %v", target.Found, tt.found)
+			}
+			if !strings.HasPrefix(target.Error, tt.targetErr) {
+				t.Errorf("error = %q, want prefix %q", target.Error, tt.targetErr)
+			}
+			var conds []string
+			for _, c := range target.Conditions {
+				conds = append(conds, c.Type)
+			}
+			if strings.Join(conds, ",") != strings.Join(tt.targetConds, ",") {
+				t.Errorf("target conditions = %v, want %v", conds, tt.targetConds)
+			}
+		})
+	}
+}
+
+func TestClusterToolsTenantNamespaces(t *testing.T) {
+	parentRef := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "external", "namespace": "gateways"}},
+		},
+	}
+	c, _ := newFakeCluster(
+		newObject("gateway.networking.k8s.io/v1", "Gateway", "gateways", "external", nil),
+		newObject("gateway.networking.k8s.io/v1", "HTTPRoute", "shop", "store", parentRef),
+		newObject("gateway.networking.k8s.io/v1", "HTTPRoute", "ops", "admin", parentRef),
+		newObject("kuadrant.io/v1", "AuthPolicy", "shop", "store-auth", map[string]interface{}{"spec": targetRef("HTTPRoute", "store")}),
+		newObject("kuadrant.io/v1", "AuthPolicy", "ops", "admin-auth", map[string]interface{}{"spec": targetRef("HTTPRoute", "admin")}),
+		newObject("kuadrant.io/v1alpha1", "DNSRecord", "shop", "store-dns", nil),
+		newObject("kuadrant.io/v1alpha1", "DNSRecord", "ops", "admin-dns", nil),
+	)
+	shop := &tenantConfig{Name: "shop", AllowedNamespaces: []string{"gateways", "shop"}}
+
+	tests := []struct {
+		name   string
+		tenant *tenantConfig
+		call   func(context.Context) (string, error)
+		// want and hide are names that must and mustn't be in the output
+		want []string
+		hide []string
+	}{
+		{
+			name:   "policies in allowed namespaces",
+			tenant: shop,
+			call:   func(ctx context.Context) (string, error) { return c.listPoliciesHandler(ctx, ListPoliciesParams{}) },
+			want:   []string{"store-auth"},
+			hide:   []string{"admin-auth"},
+		},
+		{
+			name: "policies without a tenant",
+			call: func(ctx context.Context) (string, error) { return c.listPoliciesHandler(ctx, ListPoliciesParams{}) },
+			want: []string{"store-auth", "admin-auth"},
+		},
+		{
+			name:   "policies in another namespace",
+			tenant: shop,
+			call: func(ctx context.Context) (string, error) {
+				return c.listPoliciesHandler(ctx, ListPoliciesParams{Namespace: "ops"})
+			},
+			want: []string{"Error: this tenant can't read namespace ops, only gateways, shop"},
+		},
+		{
+			name:   "policy status in another namespace",
+			tenant: shop,
+			call: func(ctx context.Context) (string, error) {
+				return c.getPolicyStatusHandler(ctx, GetPolicyStatusParams{Kind: "AuthPolicy", Namespace: "ops", Name: "admin-auth"})
+			},
+			want: []string{"Error: this tenant can't read namespace ops"},
+		},
+		{
+			name:   "policy status in an allowed namespace",
+			tenant: shop,
+			call: func(ctx context.Context) (string, error) {
+				return c.getPolicyStatusHandler(ctx, GetPolicyStatusParams{Kind: "AuthPolicy", Namespace: "shop", Name: "store-auth"})
+			},
+			want: []string{"store-auth"},
+		},
+		{
+			name:   "gateway routes and policies in allowed namespaces",
+			tenant: shop,
+			call: func(ctx context.Context) (string, error) {
+				return c.describeGatewayHandler(ctx, DescribeGatewayParams{Namespace: "gateways", Name: "external"})
+			},
+			want: []string{"store", "store-auth"},
+			hide: []string{"admin"},
+		},
+		{
+			name: "gateway without a tenant",
+			call: func(ctx context.Context) (string, error) {
+				return c.describeGatewayHandler(ctx, DescribeGatewayParams{Namespace: "gateways", Name: "external"})
+			},
+			want: []string{"store-auth", "admin-auth"},
+		},
+		{
+			name:   "gateway in another namespace",
+			tenant: &tenantConfig{Name: "shop", AllowedNamespaces: []string{"shop"}},
+			call: func(ctx context.Context) (string, error) {
+				return c.describeGatewayHandler(ctx, DescribeGatewayParams{Namespace: "gateways", Name: "external"})
+			},
+			want: []string{"Error: this tenant can't read namespace gateways, only shop"},
+		},
+		{
+			name:   "DNSRecords in allowed namespaces",
+			tenant: shop,
+			call:   func(ctx context.Context) (string, error) { return c.listDNSRecordsHandler(ctx, ListDNSRecordsParams{}) },
+			want:   []string{"store-dns"},
+			hide:   []string{"admin-dns"},
+		},
+		{
+			name:   "DNSRecords in another namespace",
+			tenant: shop,
+			call: func(ctx context.Context) (string, error) {
+				return c.listDNSRecordsHandler(ctx, ListDNSRecordsParams{Namespace: "ops"})
+			},
+			want: []string{"Error: this tenant can't read namespace ops"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.tenant != nil {
+				ctx = context.WithValue(ctx, tenantKey{}, tt.tenant)
+			}
+			out, err := tt.call(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in:\n%s", want, out)
+				}
+			}
+			for _, hide := range tt.hide {
+				if strings.Contains(out, hide) {
+					t.Errorf("%q should be left out of:\n%s", hide, out)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyState(t *testing.T) {
+	tests := []struct {
+		conditions []conditionSummary
+		want       string
+	}{
+		{nil, "Unknown (no status yet)"},
+		{[]conditionSummary{{Type: "Accepted", Status: "False", Reason: "Conflicted"}}, "NotAccepted (Conflicted)"},
+		{[]conditionSummary{{Type: "Accepted", Status: "True"}}, "Accepted"},
+		{[]conditionSummary{{Type: "Accepted", Status: "True"}, {Type: "Enforced", Status: "False", Reason: "Unknown"}}, "NotEnforced (Unknown)"},
+		{[]conditionSummary{{Type: "Enforced", Status: "True"}, {Type: "Accepted", Status: "True"}}, "Enforced"},
+	}
+	for _, tt := range tests {
+		if got := policyState(tt.conditions); got != tt.want {
+			t.Errorf("policyState(%v) = %q, want %q", tt.conditions, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyTargets(t *testing.T) {
+	policy := newObject("kuadrant.io/v1", "DNSPolicy", "ns", "dns", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"targetRefs": []interface{}{
+				map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": "Gateway", "name": "a", "sectionName": "https"},
+				map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": "Gateway", "name": "b"},
+			},
+		},
+	})
+	got := policyTargets(policy)
+	want := []objectRef{
+		{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: "a", Namespace: "ns", SectionName: "https"},
+		{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: "b", Namespace: "ns"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("targets[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// docRegistry holds the documents currently served. The map is replaced
+// wholesale on reload and never modified in place.
+type docRegistry struct {
+	mu   sync.RWMutex
+	docs map[string]docSource
+}
+
+var sources = &docRegistry{docs: resourceMapping}
+
+// all returns every configured document keyed by URI. Callers must not modify it.
+func (r *docRegistry) all() map[string]docSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.docs
+}
+
+func (r *docRegistry) get(uri string) (docSource, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	source, ok := r.docs[uri]
+	return source, ok
+}
+
+func (r *docRegistry) set(docs map[string]docSource) {
+	r.mu.Lock()
+	r.docs = docs
+	r.mu.Unlock()
+}
+
+// docsConfig is the YAML or JSON file that adds to or replaces the
+// built-in documents
+type docsConfig struct {
+	// IncludeBuiltin keeps the built-in Kuadrant docs (default: true)
+	IncludeBuiltin *bool `yaml:"includeBuiltin"`
+	// RawBaseURL fetches built-in docs from a mirror laid out as
+	// {repo}/{ref}/{path}, e.g. an internal Git server or a file:// path
+	RawBaseURL string `yaml:"rawBaseURL"`
+	// Docs are additional documents, or replacements for built-in ones
+	Docs []docConfig `yaml:"docs"`
+}
+
+type docConfig struct {
+	URI         string `yaml:"uri"`
+	URL         string `yaml:"url"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Fallback    string `yaml:"fallback"`
+	DocsURL     string `yaml:"docsUrl"`
+}
+
+// loadDocsConfig reads a docs config file and returns the resulting documents
+func loadDocsConfig(path string) (map[string]docSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config docsConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	docs := make(map[string]docSource)
+	if config.IncludeBuiltin == nil || *config.IncludeBuiltin {
+		for uri, source := range resourceMapping {
+			source.baseURL = strings.TrimSuffix(config.RawBaseURL, "/")
+			docs[uri] = source
+		}
+	}
+
+	for i, doc := range config.Docs {
+		if err := doc.validate(); err != nil {
+			return nil, fmt.Errorf("%s: docs[%d]: %w", path, i, err)
+		}
+		fallback := doc.Fallback
+		if fallback == "" {
+			fallback = "# " + doc.Name
+		}
+		docs[doc.URI] = docSource{
+			url:         doc.URL,
+			name:        doc.Name,
+			description: doc.Description,
+			fallback:    fallback,
+			docsUrl:     doc.DocsURL,
+		}
+	}
+
+	return docs, nil
+}
+
+func (d docConfig) validate() error {
+	name, ok := strings.CutPrefix(d.URI, "kuadrant://docs/")
+	if !ok || name == "" || strings.ContainsAny(name, "/#{}") {
+		return fmt.Errorf("uri must be kuadrant://docs/{name}, got %q", d.URI)
+	}
+	if _, err := lookupRelease(name); err == nil {
+		return fmt.Errorf("uri %q clashes with a Kuadrant version", d.URI)
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file" {
+		return fmt.Errorf("url must be http, https or file, got %q", d.URL)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+// watchDocsConfig reloads the docs config file whenever it changes, so
+// documents can be added or removed without a restart
+func watchDocsConfig(ctx context.Context, path string, interval time.Duration) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		docs, err := loadDocsConfig(path)
+		if err != nil {
+			slog.Error("Failed to reload docs config", "path", path, "error", err)
+			continue
+		}
+		sources.set(docs)
+		docIndexes.reset()
+		notifier.syncResources()
+		slog.Info("Reloaded docs config", "path", path, "docs", len(docs))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDocsConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// want maps URIs that must be present to their fetch URL for latest
+		want    map[string]string
+		builtin bool
+		errMsg  string
+	}{
+		{
+			name:    "empty",
+			config:  "",
+			want:    map[string]string{"kuadrant://docs/dnspolicy": "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/dnspolicy.md"},
+			builtin: true,
+		},
+		{
+			name:    "mirror",
+			config:  "rawBaseURL: file:///srv/mirror/\n",
+			want:    map[string]string{"kuadrant://docs/dnspolicy": "file:///srv/mirror/kuadrant-operator/main/doc/reference/dnspolicy.md"},
+			builtin: true,
+		},
+		{
+			name: "added and replaced docs",
+			config: `docs:
+  - uri: kuadrant://docs/runbook
+    url: https://wiki.example.com/runbook.md
+    name: Runbook
+  - uri: kuadrant://docs/dnspolicy
+    url: file:///srv/docs/dnspolicy.md
+    name: DNSPolicy
+`,
+			want: map[string]string{
+				"kuadrant://docs/runbook":   "https://wiki.example.com/runbook.md",
+				"kuadrant://docs/dnspolicy": "file:///srv/docs/dnspolicy.md",
+			},
+			builtin: true,
+		},
+		{
+			name:   "without built-in docs",
+			config: "includeBuiltin: false\ndocs:\n  - {uri: kuadrant://docs/runbook, url: https://wiki.example.com/runbook.md, name: Runbook}\n",
+			want:   map[string]string{"kuadrant://docs/runbook": "https://wiki.example.com/runbook.md"},
+		},
+		{
+			name:   "invalid doc",
+			config: "docs:\n  - {uri: kuadrant://docs/runbook, url: https://wiki.example.com/runbook.md}\n",
+			errMsg: "docs[0]: name is required",
+		},
+		{
+			name:   "not YAML",
+			config: "docs: [",
+			errMsg: "parsing ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "docs.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			docs, err := loadDocsConfig(path)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for uri, want := range tt.want {
+				source, ok := docs[uri]
+				if !ok {
+					t.Errorf("%s is missing", uri)
+					continue
+				}
+				if got := source.rawURL(kuadrantReleases["latest"]); got != want {
+					t.Errorf("%s fetches %s, want %s", uri, got, want)
+				}
+			}
+			if _, ok := docs["kuadrant://docs/ratelimitpolicy"]; ok != tt.builtin {
+				t.Errorf("built-in docs included = %v, want %v", ok, tt.builtin)
+			}
+			if runbook, ok := docs["kuadrant://docs/runbook"]; ok && runbook.fallback != "# Runbook" {
+				t.Errorf("fallback = %q, want the name as a heading", runbook.fallback)
+			}
+		})
+	}
+}
+
+func TestDocConfigValidate(t *testing.T) {
+	valid := docConfig{URI: "kuadrant://docs/runbook", URL: "https://wiki.example.com/runbook.md", Name: "Runbook"}
+	tests := []struct {
+		name   string
+		change func(*docConfig)
+		errMsg string
+	}{
+		{"valid", func(*docConfig) {}, ""},
+		{"file url", func(d *docConfig) { d.URL = "file:///srv/runbook.md" }, ""},
+		{"other scheme", func(d *docConfig) { d.URI = "kuadrant://manifests/runbook" }, `uri must be kuadrant://docs/{name}, got "kuadrant://manifests/runbook"`},
+		{"no name in uri", func(d *docConfig) { d.URI = "kuadrant://docs/" }, "uri must be kuadrant://docs/{name}"},
+		{"nested uri", func(d *docConfig) { d.URI = "kuadrant://docs/ops/runbook" }, "uri must be kuadrant://docs/{name}"},
+		{"section in uri", func(d *docConfig) { d.URI = "kuadrant://docs/runbook#steps" }, "uri must be kuadrant://docs/{name}"},
+		{"version uri", func(d *docConfig) { d.URI = "kuadrant://docs/v1.2" }, `uri "kuadrant://docs/v1.2" clashes with a Kuadrant version`},
+		{"ftp url", func(d *docConfig) { d.URL = "ftp://example.com/runbook.md" }, `url must be http, https or file, got "ftp://example.com/runbook.md"`},
+		{"relative url", func(d *docConfig) { d.URL = "runbook.md" }, "url must be http, https or file"},
+		{"bad url", func(d *docConfig) { d.URL = "http://[::1" }, "invalid url: "},
+		{"no name", func(d *docConfig) { d.Name = "" }, "name is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := valid
+			tt.change(&doc)
+			err := doc.validate()
+			switch {
+			case tt.errMsg == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.errMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.errMsg)):
+				t.Errorf("error %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// toolDefaults are used by the create_* tools for parameters the caller
+// omits. They come from the built-in conventions, the organisation's
+// defaults file and the caller's tenant, each overriding the one before.
+type toolDefaults struct {
+	Namespace        string                   `yaml:"namespace"`
+	GatewayClassName string                   `yaml:"gatewayClassName"`
+	Listeners        []map[string]interface{} `yaml:"listeners"`
+	// Labels and Annotations are added to every generated manifest; keys
+	// passed to a tool take precedence
+	Labels      map[string]string      `yaml:"labels"`
+	Annotations map[string]string      `yaml:"annotations"`
+	IssuerRef   map[string]interface{} `yaml:"issuerRef"`
+	// DNSProviderRef is shorthand for a single entry in DNSProviderRefs
+	DNSProviderRef  map[string]interface{}   `yaml:"dnsProviderRef"`
+	DNSProviderRefs []map[string]interface{} `yaml:"dnsProviderRefs"`
+	// RateLimits are used by create_ratelimitpolicy when no limits are
+	// given; an empty map disables the baseline
+	RateLimits map[string]LimitDefinition `yaml:"rateLimits"`
+}
+
+// builtinDefaults are the conventions used without a defaults file
+var builtinDefaults = toolDefaults{
+	GatewayClassName: "istio",
+	Listeners: []map[string]interface{}{
+		{"name": "http", "port": 80, "protocol": "HTTP"},
+	},
+	RateLimits: map[string]LimitDefinition{
+		"global": {Rates: []RateLimit{{Limit: 10, Window: "60s"}}},
+	},
+}
+
+// orgDefaults are the defaults every server instance starts from, replaced
+// at startup when -defaults-config is set
+var orgDefaults = builtinDefaults
+
+type toolDefaultsKey struct{}
+
+// withToolDefaults returns ctx carrying the defaults for the tools it's
+// passed to
+func withToolDefaults(ctx context.Context, defaults toolDefaults) context.Context {
+	return context.WithValue(ctx, toolDefaultsKey{}, defaults)
+}
+
+// toolDefaultsFrom returns the defaults for a tool call, or the
+// organisation defaults if the caller didn't set any
+func toolDefaultsFrom(ctx context.Context) toolDefaults {
+	if defaults, ok := ctx.Value(toolDefaultsKey{}).(toolDefaults); ok {
+		return defaults
+	}
+	return orgDefaults
+}
+
+// loadDefaultsConfig reads an organisation defaults file and returns it
+// layered over the built-in defaults
+func loadDefaultsConfig(path string) (toolDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return toolDefaults{}, fmt.Errorf("reading defaults config: %w", err)
+	}
+	var defaults toolDefaults
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return toolDefaults{}, fmt.Errorf("parsing defaults config %s: %w", path, err)
+	}
+	if err := defaults.validate(); err != nil {
+		return toolDefaults{}, err
+	}
+	return builtinDefaults.merge(defaults), nil
+}
+
+// validate checks the defaults are usable in a manifest and folds
+// DNSProviderRef into DNSProviderRefs
+func (d *toolDefaults) validate() error {
+	for i, listener := range d.Listeners {
+		if listener["name"] == nil || listener["port"] == nil || listener["protocol"] == nil {
+			return fmt.Errorf("listeners[%d] must have a name, port and protocol", i)
+		}
+	}
+	if d.IssuerRef != nil && (d.IssuerRef["kind"] == nil || d.IssuerRef["name"] == nil) {
+		return errors.New("issuerRef must have a kind and name")
+	}
+	if d.DNSProviderRef != nil {
+		d.DNSProviderRefs = append(d.DNSProviderRefs, d.DNSProviderRef)
+		d.DNSProviderRef = nil
+	}
+	for i, ref := range d.DNSProviderRefs {
+		if ref["name"] == nil {
+			return fmt.Errorf("dnsProviderRefs[%d] must have a name", i)
+		}
+	}
+	for name, limit := range d.RateLimits {
+		if len(limit.Rates) == 0 {
+			return fmt.Errorf("rateLimits %q must have at least one rate", name)
+		}
+		for i, rate := range limit.Rates {
+			if err := validateWindow(rate.Window); err != nil {
+				return fmt.Errorf("rateLimits %q rates[%d]: %w", name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// merge returns d with the defaults set in over taking precedence. Labels
+// and annotations are merged key by key.
+func (d toolDefaults) merge(over toolDefaults) toolDefaults {
+	merged := d
+	if over.Namespace != "" {
+		merged.Namespace = over.Namespace
+	}
+	if over.GatewayClassName != "" {
+		merged.GatewayClassName = over.GatewayClassName
+	}
+	if over.Listeners != nil {
+		merged.Listeners = over.Listeners
+	}
+	merged.Labels = mergeStrings(d.Labels, over.Labels)
+	merged.Annotations = mergeStrings(d.Annotations, over.Annotations)
+	if over.IssuerRef != nil {
+		merged.IssuerRef = over.IssuerRef
+	}
+	if over.DNSProviderRefs != nil {
+		merged.DNSProviderRefs = over.DNSProviderRefs
+	}
+	if over.RateLimits != nil {
+		merged.RateLimits = over.RateLimits
+	}
+	return merged
+}
+
+// gateway, httpRoute, ... fill in omitted parameters of each tool
+
+func (d toolDefaults) gateway(p *CreateGatewayParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	setDefault(&p.GatewayClassName, d.GatewayClassName)
+	if len(p.Listeners) == 0 {
+		for _, listener := range d.Listeners {
+			p.Listeners = append(p.Listeners, copyMap(listener))
+		}
+	}
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+func (d toolDefaults) httpRoute(p *CreateHTTPRouteParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+func (d toolDefaults) dnsPolicy(p *CreateDNSPolicyParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	if len(p.ProviderRefs) == 0 && p.ProviderRef == nil {
+		for _, ref := range d.DNSProviderRefs {
+			p.ProviderRefs = append(p.ProviderRefs, copyMap(ref))
+		}
+	}
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+func (d toolDefaults) tlsPolicy(p *CreateTLSPolicyParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	if p.IssuerRef == nil && d.IssuerRef != nil {
+		p.IssuerRef = copyMap(d.IssuerRef)
+	}
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+func (d toolDefaults) rateLimitPolicy(p *CreateRateLimitPolicyParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	if len(p.Limits) == 0 && len(d.RateLimits) > 0 {
+		p.Limits = make(map[string]LimitDefinition, len(d.RateLimits))
+		for name, limit := range d.RateLimits {
+			p.Limits[name] = limit
+		}
+	}
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+func (d toolDefaults) authPolicy(p *CreateAuthPolicyParams) {
+	setDefault(&p.Namespace, d.Namespace)
+	d.metadata(&p.Labels, &p.Annotations)
+}
+
+// metadata adds the default labels and annotations to those passed to a tool
+func (d toolDefaults) metadata(labels, annotations *map[string]string) {
+	*labels = mergeStrings(d.Labels, *labels)
+	*annotations = mergeStrings(d.Annotations, *annotations)
+}
+
+// described returns the parameters that have a default, with a short
+// description of the value for the tool schema
+func (d toolDefaults) described() map[string]string {
+	params := make(map[string]string)
+	if d.Namespace != "" {
+		params["namespace"] = d.Namespace
+	}
+	if d.GatewayClassName != "" {
+		params["gatewayClassName"] = d.GatewayClassName
+	}
+	if len(d.Listeners) > 0 {
+		var listeners []string
+		for _, listener := range d.Listeners {
+			listeners = append(listeners, fmt.Sprintf("%v %v/%v", listener["name"], listener["protocol"], listener["port"]))
+		}
+		params["listeners"] = strings.Join(listeners, ", ")
+	}
+	if d.IssuerRef != nil {
+		params["issuerRef"] = fmt.Sprintf("%v/%v", d.IssuerRef["kind"], d.IssuerRef["name"])
+	}
+	if len(d.DNSProviderRefs) > 0 {
+		var refs []string
+		for _, ref := range d.DNSProviderRefs {
+			refs = append(refs, fmt.Sprint(ref["name"]))
+		}
+		params["providerRefs"] = "[" + strings.Join(refs, ", ") + "]"
+	}
+	if len(d.RateLimits) > 0 {
+		var limits []string
+		for name, limit := range d.RateLimits {
+			var rates []string
+			for _, rate := range limit.Rates {
+				rates = append(rates, fmt.Sprintf("%d per %s", rate.Limit, rate.Window))
+			}
+			limits = append(limits, name+" "+strings.Join(rates, ", "))
+		}
+		sort.Strings(limits)
+		params["limits"] = strings.Join(limits, "; ")
+	}
+	return params
+}
+
+func setDefault(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// mergeStrings returns the entries of base and over, with over's values
+// winning, or nil if both are empty
+func mergeStrings(base, over map[string]string) map[string]string {
+	if len(base) == 0 && len(over) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range over {
+		merged[k] = v
+	}
+	return merged
+}
+
+// copyMap copies a default so handlers can't modify it through the params
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
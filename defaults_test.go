@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandlersApplyDefaults(t *testing.T) {
+	tenant := builtinDefaults.merge(toolDefaults{
+		Namespace:        "team-a",
+		GatewayClassName: "envoy-gateway",
+		Labels:           map[string]string{"team": "a"},
+		RateLimits:       map[string]LimitDefinition{},
+	})
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		handler func(context.Context) (string, error)
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "gateway called directly gets the built-in class and listener",
+			ctx:  context.Background(),
+			handler: func(ctx context.Context) (string, error) {
+				return createGatewayHandler(ctx, CreateGatewayParams{Name: "gw", Namespace: "ns"})
+			},
+			want: []string{"gatewayClassName: istio", "name: http", "port: 80"},
+		},
+		{
+			name: "gateway uses the tenant's defaults from the context",
+			ctx:  withToolDefaults(context.Background(), tenant),
+			handler: func(ctx context.Context) (string, error) {
+				return createGatewayHandler(ctx, CreateGatewayParams{Name: "gw"})
+			},
+			want: []string{"gatewayClassName: envoy-gateway", "namespace: team-a", "team: a"},
+		},
+		{
+			name: "ratelimitpolicy called directly gets the baseline limit",
+			ctx:  context.Background(),
+			handler: func(ctx context.Context) (string, error) {
+				return createRateLimitPolicyHandler(ctx, CreateRateLimitPolicyParams{
+					Name: "rl", Namespace: "ns", TargetRef: map[string]interface{}{"kind": "Gateway", "name": "gw"},
+				})
+			},
+			want: []string{"global:", "limit: 10", "window: 60s"},
+		},
+		{
+			name: "an empty rateLimits default disables the baseline",
+			ctx:  withToolDefaults(context.Background(), tenant),
+			handler: func(ctx context.Context) (string, error) {
+				return createRateLimitPolicyHandler(ctx, CreateRateLimitPolicyParams{
+					Name: "rl", TargetRef: map[string]interface{}{"kind": "Gateway", "name": "gw"},
+				})
+			},
+			want:    []string{"namespace: team-a"},
+			notWant: []string{"limits:"},
+		},
+		{
+			name: "explicit parameters win over defaults",
+			ctx:  withToolDefaults(context.Background(), tenant),
+			handler: func(ctx context.Context) (string, error) {
+				return createHTTPRouteHandler(ctx, CreateHTTPRouteParams{
+					Name: "r", Namespace: "other", Labels: map[string]string{"team": "b"},
+					ParentRefs: []interface{}{map[string]interface{}{"name": "gw"}},
+				})
+			},
+			want:    []string{"namespace: other", "team: b"},
+			notWant: []string{"team: a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.handler(tt.ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(out, "Error:") {
+				t.Fatal(out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestToolDefaultsMerge(t *testing.T) {
+	base := toolDefaults{
+		Namespace:        "default",
+		GatewayClassName: "istio",
+		Labels:           map[string]string{"owner": "platform", "env": "prod"},
+		IssuerRef:        map[string]interface{}{"kind": "ClusterIssuer", "name": "letsencrypt"},
+		RateLimits:       map[string]LimitDefinition{"global": {Rates: []RateLimit{{Limit: 10, Window: "60s"}}}},
+	}
+	tests := []struct {
+		name string
+		over toolDefaults
+		want toolDefaults
+	}{
+		{
+			name: "empty override keeps everything",
+			over: toolDefaults{},
+			want: base,
+		},
+		{
+			name: "scalars and maps replace",
+			over: toolDefaults{
+				Namespace: "team-a",
+				IssuerRef: map[string]interface{}{"kind": "Issuer", "name": "internal"},
+			},
+			want: toolDefaults{
+				Namespace:        "team-a",
+				GatewayClassName: "istio",
+				Labels:           base.Labels,
+				IssuerRef:        map[string]interface{}{"kind": "Issuer", "name": "internal"},
+				RateLimits:       base.RateLimits,
+			},
+		},
+		{
+			name: "labels merge key by key",
+			over: toolDefaults{Labels: map[string]string{"env": "dev", "team": "a"}},
+			want: toolDefaults{
+				Namespace:        "default",
+				GatewayClassName: "istio",
+				Labels:           map[string]string{"owner": "platform", "env": "dev", "team": "a"},
+				IssuerRef:        base.IssuerRef,
+				RateLimits:       base.RateLimits,
+			},
+		},
+		{
+			name: "empty rate limits replace the baseline",
+			over: toolDefaults{RateLimits: map[string]LimitDefinition{}},
+			want: toolDefaults{
+				Namespace:        "default",
+				GatewayClassName: "istio",
+				Labels:           base.Labels,
+				IssuerRef:        base.IssuerRef,
+				RateLimits:       map[string]LimitDefinition{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.merge(tt.over); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merge() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolDefaultsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults toolDefaults
+		errMsg   string
+	}{
+		{"valid", builtinDefaults, ""},
+		{"listener without port", toolDefaults{Listeners: []map[string]interface{}{{"name": "http", "protocol": "HTTP"}}}, "listeners[0] must have a name, port and protocol"},
+		{"issuer without name", toolDefaults{IssuerRef: map[string]interface{}{"kind": "ClusterIssuer"}}, "issuerRef must have a kind and name"},
+		{"provider without name", toolDefaults{DNSProviderRef: map[string]interface{}{"kind": "Secret"}}, "dnsProviderRefs[0] must have a name"},
+		{"limit without rates", toolDefaults{RateLimits: map[string]LimitDefinition{"global": {}}}, `rateLimits "global" must have at least one rate`},
+		{"bad window", toolDefaults{RateLimits: map[string]LimitDefinition{"global": {Rates: []RateLimit{{Limit: 1, Window: "1d"}}}}}, `rateLimits "global" rates[0]: window must end with`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.defaults
+			err := d.validate()
+			switch {
+			case tt.errMsg == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.errMsg != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.errMsg)):
+				t.Errorf("error %v, want prefix %q", err, tt.errMsg)
+			}
+		})
+	}
+}
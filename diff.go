@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// serverManagedMetadata are metadata fields set by the API server or
+// controllers rather than by the manifest author
+var serverManagedMetadata = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences", "finalizers",
+}
+
+// serverManagedAnnotations are annotations written by tooling
+var serverManagedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+type DiffManifestParams struct {
+	Manifest     string `json:"manifest" jsonschema:"YAML manifest to compare, may contain several documents separated by ---"`
+	Snapshot     string `json:"snapshot,omitempty" jsonschema:"YAML of the live objects, e.g. kubectl get -o yaml output, to diff against offline instead of the cluster"`
+	ShowLiveOnly bool   `json:"showLiveOnly,omitempty" jsonschema:"Also list fields set on the live object but not in the manifest; server-side apply leaves these unchanged (default: false)"`
+}
+
+// fieldChange is one field a manifest would change
+type fieldChange struct {
+	Path string `yaml:"path"`
+	// Op is changed, added (not on the live object) or liveOnly (not in
+	// the manifest)
+	Op       string      `yaml:"op"`
+	Live     interface{} `yaml:"live,omitempty"`
+	Manifest interface{} `yaml:"manifest,omitempty"`
+}
+
+type objectDiff struct {
+	Kind      string        `yaml:"kind"`
+	Name      string        `yaml:"name"`
+	Namespace string        `yaml:"namespace,omitempty"`
+	Live      string        `yaml:"live"`
+	Changes   []fieldChange `yaml:"changes,omitempty"`
+	Error     string        `yaml:"error,omitempty"`
+}
+
+// diffManifestHandler compares manifests with the live objects, from the
+// snapshot if one is given and otherwise from the cluster
+func diffManifestHandler(ctx context.Context, params DiffManifestParams) (string, error) {
+	objects, err := parseManifests(params.Manifest)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid manifest: %v", err), nil
+	}
+
+	var lookup func(*unstructured.Unstructured) (*unstructured.Unstructured, error)
+	switch {
+	case params.Snapshot != "":
+		snapshot, err := parseManifests(params.Snapshot)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid snapshot: %v", err), nil
+		}
+		lookup = func(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			return findObject(snapshot, obj), nil
+		}
+	case cluster != nil:
+		cluster.defaultNamespace(ctx, objects)
+		lookup = func(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			return cluster.getLive(ctx, obj)
+		}
+	default:
+		return "Error: cluster access is disabled (-kubernetes), pass the live objects as snapshot", nil
+	}
+
+	diffs := make([]objectDiff, 0, len(objects))
+	for _, obj := range objects {
+		diff := objectDiff{Kind: obj.GetKind(), Name: obj.GetName(), Namespace: obj.GetNamespace()}
+		live, err := lookup(obj)
+		switch {
+		case err != nil:
+			diff.Live = "unknown"
+			diff.Error = err.Error()
+		case live == nil:
+			diff.Live = "not found, would be created"
+		default:
+			diff.Live = "found"
+			diff.Changes = diffObjects(live.Object, obj.Object, params.ShowLiveOnly)
+			if len(diff.Changes) == 0 {
+				diff.Live = "found, unchanged"
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return renderSummary(map[string]interface{}{"diffs": diffs})
+}
+
+// getLive fetches the live version of an object, or nil if it doesn't exist
+func (c *clusterClient) getLive(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	res, _, err := c.resourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	live, err := res.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return live, err
+}
+
+// findObject returns the object in objects with the same group, kind,
+// namespace and name as obj, or nil
+func findObject(objects []*unstructured.Unstructured, obj *unstructured.Unstructured) *unstructured.Unstructured {
+	gk := obj.GroupVersionKind().GroupKind()
+	for _, candidate := range objects {
+		if candidate.GroupVersionKind().GroupKind() == gk &&
+			candidate.GetNamespace() == obj.GetNamespace() &&
+			candidate.GetName() == obj.GetName() {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// diffObjects returns the fields of manifest that differ from live,
+// ignoring status and server-managed metadata
+func diffObjects(live, manifest map[string]interface{}, showLiveOnly bool) []fieldChange {
+	live = withoutServerFields(live)
+	manifest = withoutServerFields(manifest)
+
+	var changes []fieldChange
+	diffValues("", live, manifest, showLiveOnly, &changes)
+	return changes
+}
+
+// withoutServerFields returns a copy of obj without status and
+// server-managed metadata
+func withoutServerFields(obj map[string]interface{}) map[string]interface{} {
+	u := (&unstructured.Unstructured{Object: obj}).DeepCopy()
+	unstructured.RemoveNestedField(u.Object, "status")
+	for _, field := range serverManagedMetadata {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	for _, annotation := range serverManagedAnnotations {
+		unstructured.RemoveNestedField(u.Object, "metadata", "annotations", annotation)
+	}
+	if annotations, ok, _ := unstructured.NestedMap(u.Object, "metadata", "annotations"); ok && len(annotations) == 0 {
+		unstructured.RemoveNestedField(u.Object, "metadata", "annotations")
+	}
+	return u.Object
+}
+
+// diffValues appends the differences between live and manifest at path.
+// Maps are compared key by key, and lists of named items by name, so a
+// reordered or inserted item doesn't show every later item as changed.
+func diffValues(path string, live, manifest interface{}, showLiveOnly bool, changes *[]fieldChange) {
+	switch m := manifest.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(m)+len(l))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		for k := range l {
+			if _, ok := m[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			lv, inLive := l[k]
+			mv, inManifest := m[k]
+			field := joinPath(path, k)
+			switch {
+			case !inLive:
+				*changes = append(*changes, fieldChange{Path: field, Op: "added", Manifest: mv})
+			case !inManifest:
+				if showLiveOnly {
+					*changes = append(*changes, fieldChange{Path: field, Op: "liveOnly", Live: lv})
+				}
+			default:
+				diffValues(field, lv, mv, showLiveOnly, changes)
+			}
+		}
+		return
+
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			break
+		}
+		if names, ok := itemNames(m); ok {
+			if liveNames, ok := itemNames(l); ok {
+				diffNamedItems(path, l, m, liveNames, names, showLiveOnly, changes)
+				return
+			}
+		}
+		if len(l) != len(m) {
+			break
+		}
+		for i := range m {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), l[i], m[i], showLiveOnly, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(live, manifest) {
+		*changes = append(*changes, fieldChange{Path: path, Op: "changed", Live: live, Manifest: manifest})
+	}
+}
+
+// diffNamedItems compares lists whose items all have a unique name
+func diffNamedItems(path string, live, manifest []interface{}, liveNames, names []string, showLiveOnly bool, changes *[]fieldChange) {
+	liveByName := make(map[string]interface{}, len(live))
+	for i, name := range liveNames {
+		liveByName[name] = live[i]
+	}
+	inManifest := make(map[string]bool, len(names))
+	for i, name := range names {
+		inManifest[name] = true
+		item := fmt.Sprintf("%s[name=%s]", path, name)
+		lv, ok := liveByName[name]
+		if !ok {
+			*changes = append(*changes, fieldChange{Path: item, Op: "added", Manifest: manifest[i]})
+			continue
+		}
+		diffValues(item, lv, manifest[i], showLiveOnly, changes)
+	}
+	if !showLiveOnly {
+		return
+	}
+	for i, name := range liveNames {
+		if !inManifest[name] {
+			*changes = append(*changes, fieldChange{Path: fmt.Sprintf("%s[name=%s]", path, name), Op: "liveOnly", Live: live[i]})
+		}
+	}
+}
+
+// itemNames returns the name of each item if every item is a map with a
+// unique string name
+func itemNames(items []interface{}) ([]string, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	names := make([]string, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, true
+}
+
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		key = "[" + key + "]"
+		return path + key
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testLiveRoute = `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: store
+  namespace: shop
+  uid: 0a1b2c
+  resourceVersion: "42"
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+  labels:
+    team: shop
+spec:
+  hostnames: [api.example.com]
+status:
+  parents: []
+`
+
+type diffOutput struct {
+	Diffs []objectDiff `yaml:"diffs"`
+}
+
+func TestDiffManifestHandler(t *testing.T) {
+	route := func(name, hostname string) string {
+		return fmt.Sprintf("apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: %s\n  namespace: shop\nspec:\n  hostnames: [%s]\n", name, hostname)
+	}
+	tests := []struct {
+		name   string
+		params DiffManifestParams
+		// want has a line per object with its live state and changed paths
+		want   []string
+		errMsg string
+	}{
+		{
+			name:   "unchanged",
+			params: DiffManifestParams{Manifest: route("store", "api.example.com"), Snapshot: testLiveRoute},
+			want:   []string{"HTTPRoute store: found, unchanged"},
+		},
+		{
+			name:   "changed",
+			params: DiffManifestParams{Manifest: route("store", "shop.example.com"), Snapshot: testLiveRoute},
+			want:   []string{"HTTPRoute store: found spec.hostnames[0] changed"},
+		},
+		{
+			name:   "live-only fields",
+			params: DiffManifestParams{Manifest: route("store", "api.example.com"), Snapshot: testLiveRoute, ShowLiveOnly: true},
+			want:   []string{"HTTPRoute store: found metadata.labels liveOnly"},
+		},
+		{
+			name: "created",
+			params: DiffManifestParams{
+				Manifest: route("store", "api.example.com") + "---\n" + route("cart", "api.example.com"),
+				Snapshot: testLiveRoute,
+			},
+			want: []string{"HTTPRoute store: found, unchanged", "HTTPRoute cart: not found, would be created"},
+		},
+		{
+			name:   "invalid manifest",
+			params: DiffManifestParams{Manifest: "kind: [", Snapshot: testLiveRoute},
+			errMsg: "Error: invalid manifest",
+		},
+		{
+			name:   "no cluster or snapshot",
+			params: DiffManifestParams{Manifest: route("store", "api.example.com")},
+			errMsg: "Error: cluster access is disabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := diffManifestHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			if got := diffLines(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q\n%s", got, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestDiffManifestHandlerCluster(t *testing.T) {
+	c, _ := newFakeCluster(
+		newObject("gateway.networking.k8s.io/v1", "HTTPRoute", "shop", "store", map[string]interface{}{
+			"spec": map[string]interface{}{"hostnames": []interface{}{"api.example.com"}},
+		}),
+		newObject("v1", "Secret", "shop", "creds", map[string]interface{}{"type": "Opaque"}),
+		newObject("gateway.networking.k8s.io/v1", "GatewayClass", "", "istio", map[string]interface{}{
+			"spec": map[string]interface{}{"controllerName": "istio.io/gateway-controller"},
+		}),
+	)
+	previous := cluster
+	cluster = c
+	t.Cleanup(func() { cluster = previous })
+
+	// kinds apply_manifest refuses, such as core and cluster-scoped ones,
+	// can still be diffed; objects without a namespace are looked up in
+	// the default one
+	ctx := withToolDefaults(context.Background(), toolDefaults{Namespace: "shop"})
+	out, err := diffManifestHandler(ctx, DiffManifestParams{
+		Manifest: "apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: store\nspec:\n  hostnames: [shop.example.com]\n" +
+			"---\napiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: cart\n  namespace: shop\n" +
+			"---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: creds\n  namespace: shop\ntype: kubernetes.io/basic-auth\n" +
+			"---\napiVersion: gateway.networking.k8s.io/v1\nkind: GatewayClass\nmetadata:\n  name: istio\nspec:\n  controllerName: istio.io/gateway-controller\n" +
+			"---\napiVersion: kuadrant.io/v1\nkind: DNSPolicy\nmetadata:\n  name: dns\n  namespace: shop\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"HTTPRoute store: found spec.hostnames[0] changed",
+		"HTTPRoute cart: not found, would be created",
+		"Secret creds: found type changed",
+		"GatewayClass istio: found, unchanged",
+		"DNSPolicy dns: unknown",
+	}
+	if got := diffLines(t, out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q\n%s", got, want, out)
+	}
+	var result diffOutput
+	if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Diffs[0].Namespace != "shop" || result.Diffs[3].Namespace != "" {
+		t.Errorf("namespaces %q and %q, want shop and none", result.Diffs[0].Namespace, result.Diffs[3].Namespace)
+	}
+}
+
+// diffLines summarises diff_manifest output as one line per object
+func diffLines(t *testing.T, out string) []string {
+	t.Helper()
+	var result diffOutput
+	if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("%v in:\n%s", err, out)
+	}
+	var lines []string
+	for _, d := range result.Diffs {
+		line := d.Kind + " " + d.Name + ": " + d.Live
+		for _, c := range d.Changes {
+			line += " " + c.Path + " " + c.Op
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestDiffValues(t *testing.T) {
+	listener := func(name string, port int) map[string]interface{} {
+		return map[string]interface{}{"name": name, "port": port}
+	}
+	tests := []struct {
+		name         string
+		live         interface{}
+		manifest     interface{}
+		showLiveOnly bool
+		want         []string
+	}{
+		{
+			name:     "equal",
+			live:     map[string]interface{}{"a": []interface{}{"x"}},
+			manifest: map[string]interface{}{"a": []interface{}{"x"}},
+		},
+		{
+			name:     "changed, added and live-only keys",
+			live:     map[string]interface{}{"a": 1, "b": 2},
+			manifest: map[string]interface{}{"a": 3, "c": 4},
+			want:     []string{"a changed", "c added"},
+		},
+		{
+			name:         "live-only keys shown",
+			live:         map[string]interface{}{"a": 1, "b": 2},
+			manifest:     map[string]interface{}{"a": 1},
+			showLiveOnly: true,
+			want:         []string{"b liveOnly"},
+		},
+		{
+			name:     "named items by name",
+			live:     []interface{}{listener("http", 80), listener("https", 443)},
+			manifest: []interface{}{listener("admin", 9090), listener("http", 80), listener("https", 8443)},
+			want:     []string{"[name=admin] added", "[name=https].port changed"},
+		},
+		{
+			name:         "named item removed",
+			live:         []interface{}{listener("http", 80), listener("https", 443)},
+			manifest:     []interface{}{listener("http", 80)},
+			showLiveOnly: true,
+			want:         []string{"[name=https] liveOnly"},
+		},
+		{
+			name:     "unnamed items by index",
+			live:     []interface{}{"a", "b"},
+			manifest: []interface{}{"a", "c"},
+			want:     []string{"[1] changed"},
+		},
+		{
+			name:     "list length differs",
+			live:     []interface{}{"a"},
+			manifest: []interface{}{"a", "b"},
+			want:     []string{" changed"},
+		},
+		{
+			name:     "type differs",
+			live:     "a",
+			manifest: map[string]interface{}{"a": 1},
+			want:     []string{" changed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []fieldChange
+			diffValues("", tt.live, tt.manifest, tt.showLiveOnly, &changes)
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.Path+" "+c.Op)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemNames(t *testing.T) {
+	tests := []struct {
+		items []interface{}
+		want  []string
+		ok    bool
+	}{
+		{[]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}, []string{"a", "b"}, true},
+		{nil, nil, false},
+		{[]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "a"}}, nil, false},
+		{[]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"port": 80}}, nil, false},
+		{[]interface{}{"a"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := itemNames(tt.items)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("itemNames(%v) = %v, %v, want %v, %v", tt.items, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct{ path, key, want string }{
+		{"", "spec", "spec"},
+		{"spec", "hostnames", "spec.hostnames"},
+		{"metadata.annotations", "kuadrant.io/policy", "metadata.annotations[kuadrant.io/policy]"},
+		{"spec", "a[0]", "spec[a[0]]"},
+	}
+	for _, tt := range tests {
+		if got := joinPath(tt.path, tt.key); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tt.path, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWithoutServerFields(t *testing.T) {
+	obj, err := parseManifests(testLiveRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := withoutServerFields(obj[0].Object)
+	want := map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "store", "namespace": "shop", "labels": map[string]interface{}{"team": "shop"}},
+		"spec":       map[string]interface{}{"hostnames": []interface{}{"api.example.com"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := obj[0].Object["status"]; !ok {
+		t.Error("the object passed in was modified")
+	}
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// limitadorConfigKey is the key of the limits in the ConfigMap the
+// limitador-operator renders from the Limitador CR
+const limitadorConfigKey = "limitador-config.yaml"
+
+var (
+	rateLimitPolicyKind      = schema.GroupKind{Group: "kuadrant.io", Kind: "RateLimitPolicy"}
+	configMapKind            = schema.GroupKind{Kind: "ConfigMap"}
+	wasmPluginKind           = schema.GroupKind{Group: "extensions.istio.io", Kind: "WasmPlugin"}
+	envoyExtensionPolicyKind = schema.GroupKind{Group: "gateway.envoyproxy.io", Kind: "EnvoyExtensionPolicy"}
+)
+
+// limitIdentifierPattern matches the descriptor keys the operator gives
+// each RateLimitPolicy limit, e.g. limit.per_user__1a2b3c4d
+var limitIdentifierPattern = regexp.MustCompile(`limit\.[A-Za-z0-9_]+__[0-9a-f]+`)
+
+// equalityPredicate matches CEL predicates comparing an attribute with a
+// string literal, e.g. request.method == 'GET'
+var equalityPredicate = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*)\s*==\s*['"]([^'"]*)['"]\s*$`)
+
+type ExplainEnforcementParams struct {
+	Policy     string `json:"policy,omitempty" jsonschema:"RateLimitPolicy YAML to explain; every RateLimitPolicy in the snapshot is explained if omitted"`
+	Limits     string `json:"limits,omitempty" jsonschema:"Limitador limits: the Limitador CR, the limitador-config ConfigMap or the bare list of limits"`
+	WasmConfig string `json:"wasmConfig,omitempty" jsonschema:"wasm-shim config: the gateway's WasmPlugin or EnvoyExtensionPolicy, or the bare plugin config with services and actionSets"`
+	Path       string `json:"path,omitempty" jsonschema:"Snapshot directory or archive, relative to the server's -snapshot-dir, to read policies, Limitador and wasm plugins from"`
+}
+
+// limitadorLimit is one limit in Limitador's limits config
+type limitadorLimit struct {
+	Namespace  string   `json:"namespace" yaml:"namespace"`
+	MaxValue   int64    `json:"max_value" yaml:"maxValue"`
+	Seconds    int64    `json:"seconds" yaml:"seconds"`
+	Conditions []string `json:"conditions" yaml:"conditions,omitempty"`
+	Variables  []string `json:"variables" yaml:"variables,omitempty"`
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+func (l limitadorLimit) String() string {
+	return fmt.Sprintf("%d per %ds in %s", l.MaxValue, l.Seconds, l.Namespace)
+}
+
+// wasmConfig is the wasm-shim plugin configuration the operator renders
+// for each gateway
+type wasmConfig struct {
+	Services   map[string]wasmService `json:"services"`
+	ActionSets []wasmActionSet        `json:"actionSets"`
+
+	// source names the object the config was read from
+	source string
+}
+
+type wasmService struct {
+	Type        string `json:"type"`
+	Endpoint    string `json:"endpoint"`
+	FailureMode string `json:"failureMode"`
+}
+
+type wasmActionSet struct {
+	Name                string `json:"name"`
+	RouteRuleConditions struct {
+		Hostnames  []string `json:"hostnames"`
+		Predicates []string `json:"predicates"`
+	} `json:"routeRuleConditions"`
+	Actions []wasmAction `json:"actions"`
+}
+
+type wasmAction struct {
+	Service    string     `json:"service"`
+	Scope      string     `json:"scope"`
+	Predicates []string   `json:"predicates"`
+	Data       []wasmData `json:"data"`
+}
+
+// wasmData is a descriptor entry an action sends. Expression is used by
+// current releases, Static by older ones.
+type wasmData struct {
+	Expression *struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"expression"`
+	Static *struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"static"`
+}
+
+func (d wasmData) key() string {
+	switch {
+	case d.Expression != nil:
+		return d.Expression.Key
+	case d.Static != nil:
+		return d.Static.Key
+	}
+	return ""
+}
+
+// policyLimit is a limit of a RateLimitPolicy
+type policyLimit struct {
+	Name string `yaml:"name"`
+	// Section is defaults or overrides for limits declared there
+	Section    string   `yaml:"section,omitempty"`
+	Identifier string   `yaml:"identifier"`
+	Rates      []string `yaml:"rates"`
+	Counters   []string `yaml:"counters,omitempty"`
+	When       []string `yaml:"when,omitempty"`
+	Limitador  []string `yaml:"limitador,omitempty"`
+	ActionSets []string `yaml:"actionSets,omitempty"`
+	State      string   `yaml:"state"`
+
+	seconds []int64
+	limits  []int64
+}
+
+type policyEnforcement struct {
+	Policy string        `yaml:"policy"`
+	State  string        `yaml:"state"`
+	Limits []policyLimit `yaml:"limits"`
+}
+
+// limitIdentifier derives the descriptor key the operator uses for a
+// policy's limit: its name with characters Limitador doesn't allow
+// replaced, and a hash of the policy and limit names so it stays unique
+func limitIdentifier(namespace, policy, limit string) string {
+	var b strings.Builder
+	b.WriteString("limit.")
+	for _, c := range limit {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	hash := sha256.Sum256([]byte(namespace + "/" + policy + "/" + limit))
+	return b.String() + "__" + hex.EncodeToString(hash[:4])
+}
+
+// sameLimit reports whether identifier belongs to the limit with the
+// given derived identifier. Identifiers are compared without their hash
+// when it differs, as releases haven't always hashed the same input.
+func sameLimit(identifier, derived string) bool {
+	if identifier == derived {
+		return true
+	}
+	prefix := derived[:strings.LastIndex(derived, "__")+2]
+	return strings.HasPrefix(identifier, prefix) && !strings.Contains(identifier[len(prefix):], "_")
+}
+
+func explainEnforcementHandler(ctx context.Context, params ExplainEnforcementParams) (string, error) {
+	var snapshot []*unstructured.Unstructured
+	if params.Path != "" {
+		objects, _, err := loadSnapshot(params.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		snapshot = objects
+	}
+
+	var policies []*unstructured.Unstructured
+	if params.Policy != "" {
+		objects, err := parseManifests(params.Policy)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid policy: %v", err), nil
+		}
+		policies = objectsOfKind(objects, rateLimitPolicyKind)
+	} else {
+		policies = objectsOfKind(snapshot, rateLimitPolicyKind)
+	}
+	if len(policies) == 0 {
+		return "Error: no RateLimitPolicy given; pass policy, or a path to a snapshot containing RateLimitPolicies", nil
+	}
+
+	limits, err := limitadorLimits(params.Limits, snapshot)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid limits: %v", err), nil
+	}
+	configs, err := wasmConfigs(params.WasmConfig, snapshot)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid wasmConfig: %v", err), nil
+	}
+
+	var (
+		explained []policyEnforcement
+		findings  []finding
+		known     []string
+	)
+	for _, policy := range policies {
+		enforcement, policyFindings := explainPolicyLimits(policy, limits, configs)
+		explained = append(explained, enforcement)
+		findings = append(findings, policyFindings...)
+		for _, limit := range enforcement.Limits {
+			known = append(known, limit.Identifier)
+		}
+	}
+	findings = append(findings, checkActionSets(configs, limits)...)
+	// other policies' limits are only known when every policy was given
+	if params.Policy == "" {
+		findings = append(findings, checkUnknownLimits(limits, configs, known)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return slices.Index(severities, findings[i].Severity) < slices.Index(severities, findings[j].Severity)
+	})
+
+	report := map[string]interface{}{"policies": explained}
+	if len(findings) > 0 {
+		report["findings"] = findings
+	}
+	var notChecked []string
+	if limits == nil {
+		notChecked = append(notChecked, "Limitador limits (pass limits, or a snapshot with the Limitador CR or limitador-config ConfigMap)")
+	}
+	if configs == nil {
+		notChecked = append(notChecked, "wasm-shim config (pass wasmConfig, or a snapshot with the WasmPlugin or EnvoyExtensionPolicy)")
+	}
+	if len(notChecked) > 0 {
+		report["notChecked"] = notChecked
+	}
+	return renderSummary(report)
+}
+
+func objectsOfKind(objects []*unstructured.Unstructured, kind schema.GroupKind) []*unstructured.Unstructured {
+	var matching []*unstructured.Unstructured
+	for _, obj := range objects {
+		if obj.GroupVersionKind().GroupKind() == kind {
+			matching = append(matching, obj)
+		}
+	}
+	return matching
+}
+
+// convertTo decodes a parsed YAML or JSON value into out
+func convertTo(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// parseConfig parses text as Kubernetes objects or, failing that, as a
+// bare config value
+func parseConfig(text string) ([]*unstructured.Unstructured, interface{}, error) {
+	if objects, err := parseManifests(text); err == nil {
+		return objects, nil, nil
+	}
+	data, err := yaml.YAMLToJSON([]byte(text))
+	if err != nil {
+		return nil, nil, err
+	}
+	var bare interface{}
+	if err := json.Unmarshal(data, &bare); err != nil {
+		return nil, nil, err
+	}
+	return nil, bare, nil
+}
+
+// limitadorLimits reads the limits from pasted text and the snapshot. It
+// returns nil if neither has any Limitador config.
+func limitadorLimits(text string, snapshot []*unstructured.Unstructured) ([]limitadorLimit, error) {
+	objects := snapshot
+	var limits []limitadorLimit
+	if text != "" {
+		parsed, bare, err := parseConfig(text)
+		if err != nil {
+			return nil, err
+		}
+		if bare != nil {
+			if err := convertTo(bare, &limits); err != nil {
+				return nil, fmt.Errorf("expected a Limitador CR, ConfigMap or list of limits: %w", err)
+			}
+			return nonNil(limits), nil
+		}
+		objects = parsed
+	}
+
+	found := false
+	for _, obj := range objects {
+		var raw interface{}
+		switch obj.GroupVersionKind().GroupKind() {
+		case limitadorKind:
+			raw, _, _ = unstructured.NestedFieldNoCopy(obj.Object, "spec", "limits")
+		case configMapKind:
+			config, ok, _ := unstructured.NestedString(obj.Object, "data", limitadorConfigKey)
+			if !ok {
+				continue
+			}
+			if err := yaml.Unmarshal([]byte(config), &raw); err != nil {
+				return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+			}
+		default:
+			continue
+		}
+		found = true
+		var items []limitadorLimit
+		if err := convertTo(raw, &items); err != nil {
+			return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+		}
+		limits = append(limits, items...)
+	}
+	if !found {
+		return nil, nil
+	}
+	return nonNil(limits), nil
+}
+
+// nonNil returns an empty slice for nil, as nil means no config was found
+func nonNil(limits []limitadorLimit) []limitadorLimit {
+	if limits == nil {
+		return []limitadorLimit{}
+	}
+	return limits
+}
+
+// wasmConfigs reads wasm-shim configs from pasted text and the snapshot.
+// It returns nil if neither has any.
+func wasmConfigs(text string, snapshot []*unstructured.Unstructured) ([]wasmConfig, error) {
+	objects := snapshot
+	if text != "" {
+		parsed, bare, err := parseConfig(text)
+		if err != nil {
+			return nil, err
+		}
+		if bare != nil {
+			var config wasmConfig
+			if err := convertTo(bare, &config); err != nil {
+				return nil, fmt.Errorf("expected a WasmPlugin, EnvoyExtensionPolicy or plugin config: %w", err)
+			}
+			config.source = "wasmConfig"
+			return []wasmConfig{config}, nil
+		}
+		objects = parsed
+	}
+
+	var configs []wasmConfig
+	for _, obj := range objects {
+		var raw []interface{}
+		switch obj.GroupVersionKind().GroupKind() {
+		case wasmPluginKind:
+			if config, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "pluginConfig"); ok {
+				raw = append(raw, config)
+			}
+		case envoyExtensionPolicyKind:
+			modules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "wasm")
+			for _, module := range modules {
+				if m, ok := module.(map[string]interface{}); ok && m["config"] != nil {
+					raw = append(raw, m["config"])
+				}
+			}
+		}
+		for _, r := range raw {
+			var config wasmConfig
+			if err := convertTo(r, &config); err != nil {
+				return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+			}
+			config.source = objectName(obj)
+			configs = append(configs, config)
+		}
+	}
+	return configs, nil
+}
+
+// rateLimitPolicyLimits reads a policy's limits, including those under
+// defaults and overrides
+func rateLimitPolicyLimits(policy *unstructured.Unstructured) []policyLimit {
+	var limits []policyLimit
+	for _, section := range []string{"", "defaults", "overrides"} {
+		path := []string{"spec"}
+		if section != "" {
+			path = append(path, section)
+		}
+		defs, _, _ := unstructured.NestedMap(policy.Object, append(path, "limits")...)
+		sectionWhen := predicates(policy.Object, append(path, "when")...)
+		names := make([]string, 0, len(defs))
+		for name := range defs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			def, ok := defs[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			limit := policyLimit{
+				Name:       name,
+				Section:    section,
+				Identifier: limitIdentifier(policy.GetNamespace(), policy.GetName(), name),
+				When:       append(slices.Clone(sectionWhen), predicates(def, "when")...),
+			}
+			rates, _, _ := unstructured.NestedSlice(def, "rates")
+			for _, rate := range rates {
+				r, ok := rate.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				seconds := rateSeconds(r)
+				limit.limits = append(limit.limits, intField(r, "limit"))
+				limit.seconds = append(limit.seconds, seconds)
+				limit.Rates = append(limit.Rates, fmt.Sprintf("%d per %ds", intField(r, "limit"), seconds))
+			}
+			counters, _, _ := unstructured.NestedSlice(def, "counters")
+			for _, counter := range counters {
+				switch c := counter.(type) {
+				case map[string]interface{}:
+					limit.Counters = append(limit.Counters, stringField(c, "expression"))
+				case string:
+					limit.Counters = append(limit.Counters, c)
+				}
+			}
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// predicates reads a when list of {predicate: ...} items
+func predicates(obj map[string]interface{}, fields ...string) []string {
+	items, _, _ := unstructured.NestedSlice(obj, fields...)
+	var out []string
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if p := stringField(m, "predicate"); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// rateSeconds reads a rate's window, or the duration and unit used
+// before v1
+func rateSeconds(rate map[string]interface{}) int64 {
+	if window := stringField(rate, "window"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return 0
+		}
+		return int64(d.Seconds())
+	}
+	units := map[string]int64{"second": 1, "minute": 60, "hour": 3600, "day": 86400}
+	return intField(rate, "duration") * units[stringField(rate, "unit")]
+}
+
+// identifiers returns the limit identifiers a Limitador limit's
+// conditions check
+func (l limitadorLimit) identifiers() []string {
+	var ids []string
+	for _, condition := range l.Conditions {
+		ids = append(ids, limitIdentifierPattern.FindAllString(condition, -1)...)
+	}
+	return ids
+}
+
+// explainPolicyLimits maps a policy's limits to the Limitador limits and
+// wasm action sets rendered for them
+func explainPolicyLimits(policy *unstructured.Unstructured, limits []limitadorLimit, configs []wasmConfig) (policyEnforcement, []finding) {
+	conditions := conditionsAt(policy.Object, "status", "conditions")
+	enforcement := policyEnforcement{
+		Policy: objectName(policy),
+		State:  policyState(conditions),
+		Limits: rateLimitPolicyLimits(policy),
+	}
+	// limits of an overridden policy are replaced by another policy's, so
+	// their absence is expected
+	overridden := false
+	if enforced := findCondition(conditions, "Enforced"); enforced != nil && enforced.Reason == "Overridden" {
+		overridden = true
+	}
+	missingSeverity := "critical"
+	if overridden {
+		missingSeverity = "info"
+	}
+
+	var findings []finding
+	for i := range enforcement.Limits {
+		limit := &enforcement.Limits[i]
+		object := fmt.Sprintf("%s limit %s", enforcement.Policy, limit.Name)
+
+		var rendered []limitadorLimit
+		for _, l := range limits {
+			if slices.ContainsFunc(l.identifiers(), func(id string) bool { return sameLimit(id, limit.Identifier) }) {
+				rendered = append(rendered, l)
+				limit.Limitador = append(limit.Limitador, l.String())
+			}
+		}
+		for _, config := range configs {
+			for _, set := range config.ActionSets {
+				for _, action := range set.Actions {
+					if slices.ContainsFunc(action.Data, func(d wasmData) bool { return sameLimit(d.key(), limit.Identifier) }) {
+						limit.ActionSets = append(limit.ActionSets, fmt.Sprintf("%s %s (scope %s, hosts %s)", config.source, set.Name, action.Scope, strings.Join(set.RouteRuleConditions.Hostnames, ", ")))
+						findings = append(findings, checkWhen(object, limit, action)...)
+					}
+				}
+			}
+		}
+
+		// Configured means both sides exist; scope and rate findings can
+		// still keep it from being enforced as written
+		limit.State = "Configured"
+		switch {
+		case limits != nil && len(rendered) == 0:
+			limit.State = "NotInLimitador"
+			findings = append(findings, finding{
+				Severity: missingSeverity,
+				Check:    "limit-not-in-limitador",
+				Object:   object,
+				Summary:  fmt.Sprintf("No Limitador limit checks %s, so requests are never counted against it", limit.Identifier),
+				NextSteps: []string{
+					"Check the policy is Accepted and not overridden (explain_status)",
+					"Check the kuadrant-operator logs for errors reconciling the Limitador CR",
+				},
+			})
+		case configs != nil && len(limit.ActionSets) == 0:
+			limit.State = "NotInWasmConfig"
+			findings = append(findings, finding{
+				Severity: missingSeverity,
+				Check:    "limit-not-in-wasm-config",
+				Object:   object,
+				Summary:  fmt.Sprintf("No wasm action sends %s, so the gateway never asks Limitador about it", limit.Identifier),
+				NextSteps: []string{
+					"Check the wasm plugin config is for the gateway the policy's target is attached to",
+					"Check the target HTTPRoute is accepted by the gateway and its hostnames match the listeners",
+				},
+			})
+		case limits == nil || configs == nil:
+			limit.State = "Unknown"
+		}
+		if len(rendered) > 0 {
+			findings = append(findings, checkRates(object, limit, rendered)...)
+		}
+		if overridden && limit.State != "Configured" {
+			limit.State += " (policy overridden)"
+		}
+	}
+	return enforcement, findings
+}
+
+// checkRates reports rates and counters that differ between the policy
+// and Limitador, which happens when the operator hasn't caught up
+func checkRates(object string, limit *policyLimit, rendered []limitadorLimit) []finding {
+	var findings []finding
+	for i, rate := range limit.Rates {
+		if !slices.ContainsFunc(rendered, func(l limitadorLimit) bool {
+			return l.MaxValue == limit.limits[i] && l.Seconds == limit.seconds[i]
+		}) {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "rate-not-in-limitador",
+				Object:   object,
+				Summary:  fmt.Sprintf("Rate %s is not in Limitador, which has %s", rate, strings.Join(limit.Limitador, "; ")),
+			})
+		}
+	}
+	for _, counter := range limit.Counters {
+		if !slices.ContainsFunc(rendered, func(l limitadorLimit) bool {
+			return slices.ContainsFunc(l.Variables, func(v string) bool { return strings.Contains(v, counter) })
+		}) {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "counter-not-in-limitador",
+				Object:   object,
+				Summary:  fmt.Sprintf("Counter %s is not a variable of the Limitador limit, so all requests share one counter", counter),
+			})
+		}
+	}
+	return findings
+}
+
+// checkWhen reports when predicates of a limit its wasm action doesn't
+// check, so the limit applies more widely than written
+func checkWhen(object string, limit *policyLimit, action wasmAction) []finding {
+	var findings []finding
+	for _, when := range limit.When {
+		if !slices.Contains(action.Predicates, when) {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "predicate-not-in-wasm-config",
+				Object:   object,
+				Summary:  fmt.Sprintf("when predicate %q is not on the wasm action, which has %v", when, action.Predicates),
+			})
+		}
+	}
+	return findings
+}
+
+// checkActionSets reports action sets and actions that can never reach a
+// limit: contradictory predicates, undefined services, and scopes no
+// Limitador limit is in
+func checkActionSets(configs []wasmConfig, limits []limitadorLimit) []finding {
+	var findings []finding
+	for _, config := range configs {
+		for _, set := range config.ActionSets {
+			object := fmt.Sprintf("%s actionSet %s", config.source, set.Name)
+			setReason := contradiction(set.RouteRuleConditions.Predicates)
+			if setReason != "" {
+				findings = append(findings, finding{
+					Severity: "warning",
+					Check:    "action-set-never-matches",
+					Object:   object,
+					Summary:  "Route rule predicates can never all be true: " + setReason,
+				})
+			}
+			for _, action := range set.Actions {
+				service, ok := config.Services[action.Service]
+				if !ok {
+					findings = append(findings, finding{
+						Severity: "critical",
+						Check:    "unknown-service",
+						Object:   object,
+						Summary:  fmt.Sprintf("Action uses service %q, which isn't in the config's services", action.Service),
+					})
+					continue
+				}
+				if service.Type != "ratelimit" {
+					continue
+				}
+				// a contradiction in the action set's own predicates is
+				// already reported
+				reason := contradiction(append(slices.Clone(set.RouteRuleConditions.Predicates), action.Predicates...))
+				if setReason == "" && reason != "" {
+					findings = append(findings, finding{
+						Severity: "warning",
+						Check:    "action-never-matches",
+						Object:   object,
+						Summary:  fmt.Sprintf("Action for scope %s can never run: %s", action.Scope, reason),
+					})
+				}
+				if limits != nil {
+					findings = append(findings, checkScope(object, action, limits)...)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// checkScope reports limit identifiers an action sends whose Limitador
+// limits are in a different namespace than the action's scope, so they
+// never match
+func checkScope(object string, action wasmAction, limits []limitadorLimit) []finding {
+	var findings []finding
+	for _, data := range action.Data {
+		key := data.key()
+		if !limitIdentifierPattern.MatchString(key) {
+			continue
+		}
+		var namespaces []string
+		for _, l := range limits {
+			if slices.Contains(l.identifiers(), key) && !slices.Contains(namespaces, l.Namespace) {
+				namespaces = append(namespaces, l.Namespace)
+			}
+		}
+		if len(namespaces) > 0 && !slices.Contains(namespaces, action.Scope) {
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "scope-mismatch",
+				Object:   object,
+				Summary:  fmt.Sprintf("Action sends %s with scope %s, but Limitador has it in %s, so it never matches", key, action.Scope, strings.Join(namespaces, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+// contradiction returns why a set of predicates, all of which must hold,
+// can never be true, or "" if no contradiction is found. Only literal
+// false and equality checks of one attribute against different strings
+// are detected.
+func contradiction(predicates []string) string {
+	values := make(map[string]string)
+	for _, p := range predicates {
+		if strings.TrimSpace(p) == "false" {
+			return "predicate is false"
+		}
+		m := equalityPredicate.FindStringSubmatch(p)
+		if m == nil {
+			continue
+		}
+		if v, ok := values[m[1]]; ok && v != m[2] {
+			return fmt.Sprintf("%s must equal both %q and %q", m[1], v, m[2])
+		}
+		values[m[1]] = m[2]
+	}
+	return ""
+}
+
+// checkUnknownLimits reports limit identifiers in Limitador or the wasm
+// config that belong to none of the policies, usually left behind by a
+// deleted policy or limit
+func checkUnknownLimits(limits []limitadorLimit, configs []wasmConfig, known []string) []finding {
+	isKnown := func(id string) bool {
+		return slices.ContainsFunc(known, func(k string) bool { return sameLimit(id, k) })
+	}
+	var findings []finding
+	for _, l := range limits {
+		for _, id := range l.identifiers() {
+			if !isKnown(id) {
+				findings = append(findings, finding{
+					Severity: "info",
+					Check:    "unknown-limit",
+					Object:   "Limitador limit " + id,
+					Summary:  fmt.Sprintf("Limit %s matches none of the RateLimitPolicies", l),
+				})
+			}
+		}
+	}
+	for _, config := range configs {
+		for _, set := range config.ActionSets {
+			for _, action := range set.Actions {
+				for _, data := range action.Data {
+					if id := data.key(); limitIdentifierPattern.MatchString(id) && !isKnown(id) {
+						findings = append(findings, finding{
+							Severity: "info",
+							Check:    "unknown-limit",
+							Object:   fmt.Sprintf("%s actionSet %s", config.source, set.Name),
+							Summary:  fmt.Sprintf("Action sends %s, which matches none of the RateLimitPolicies", id),
+						})
+					}
+				}
+			}
+		}
+	}
+	return findings
+}
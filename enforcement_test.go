@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// testLimitID is the identifier of limit per-user of RateLimitPolicy shop/rl
+	testLimitID = "limit.per_user__e129dcd4"
+
+	testRateLimitPolicy = `apiVersion: kuadrant.io/v1
+kind: RateLimitPolicy
+metadata:
+  name: rl
+  namespace: shop
+spec:
+  targetRef: {group: gateway.networking.k8s.io, kind: HTTPRoute, name: store}
+  limits:
+    per-user:
+      rates: [{limit: 10, window: 60s}]
+      when: [{predicate: "request.method == 'GET'"}]
+`
+)
+
+// testLimitadorLimits returns a bare list of Limitador limits with one
+// limit checking id in namespace
+func testLimitadorLimits(namespace, id string, maxValue int) string {
+	return `[{namespace: ` + namespace + `, max_value: ` + strconv.Itoa(maxValue) + `, seconds: 60, conditions: ["descriptors[0]['` + id + `'] == '1'"], variables: []}]`
+}
+
+// testWasmConfig returns a bare wasm-shim config with one action sending
+// id with scope and predicates
+func testWasmConfig(scope, id string, predicates ...string) string {
+	quoted := make([]string, len(predicates))
+	for i, p := range predicates {
+		quoted[i] = `"` + p + `"`
+	}
+	return `{services: {ratelimit-service: {type: ratelimit, endpoint: kuadrant-ratelimit-service}}, actionSets: [{
+  name: store-rule-1,
+  routeRuleConditions: {hostnames: [api.example.com]},
+  actions: [{service: ratelimit-service, scope: ` + scope + `, predicates: [` + strings.Join(quoted, ", ") + `], data: [{expression: {key: ` + id + `, value: "1"}}]}]
+}]}`
+}
+
+type enforcementOutput struct {
+	Policies   []policyEnforcement `yaml:"policies"`
+	Findings   []finding           `yaml:"findings"`
+	NotChecked []string            `yaml:"notChecked"`
+}
+
+func TestExplainEnforcementHandler(t *testing.T) {
+	getPredicate := "request.method == 'GET'"
+	tests := []struct {
+		name       string
+		params     ExplainEnforcementParams
+		state      string
+		checks     []string
+		notChecked int
+		errMsg     string
+	}{
+		{
+			name: "configured",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", testLimitID, 10),
+				WasmConfig: testWasmConfig("shop/rl", testLimitID, getPredicate),
+			},
+			state: "Configured",
+		},
+		{
+			name: "missing from Limitador",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", "limit.global__20ac210c", 10),
+				WasmConfig: testWasmConfig("shop/rl", testLimitID, getPredicate),
+			},
+			state:  "NotInLimitador",
+			checks: []string{"limit-not-in-limitador"},
+		},
+		{
+			name: "missing from the wasm config",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", testLimitID, 10),
+				WasmConfig: testWasmConfig("shop/rl", "limit.global__20ac210c"),
+			},
+			state:  "NotInWasmConfig",
+			checks: []string{"limit-not-in-wasm-config"},
+		},
+		{
+			name: "stale rate and dropped predicate",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", testLimitID, 5),
+				WasmConfig: testWasmConfig("shop/rl", testLimitID),
+			},
+			state:  "Configured",
+			checks: []string{"predicate-not-in-wasm-config", "rate-not-in-limitador"},
+		},
+		{
+			name: "scope mismatch",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", testLimitID, 10),
+				WasmConfig: testWasmConfig("shop/other", testLimitID, getPredicate),
+			},
+			state:  "Configured",
+			checks: []string{"scope-mismatch"},
+		},
+		{
+			name: "action never matches",
+			params: ExplainEnforcementParams{
+				Policy:     testRateLimitPolicy,
+				Limits:     testLimitadorLimits("shop/rl", testLimitID, 10),
+				WasmConfig: testWasmConfig("shop/rl", testLimitID, getPredicate, "request.method == 'POST'"),
+			},
+			state:  "Configured",
+			checks: []string{"action-never-matches"},
+		},
+		{
+			name:       "policy only",
+			params:     ExplainEnforcementParams{Policy: testRateLimitPolicy},
+			state:      "Unknown",
+			notChecked: 2,
+		},
+		{
+			name:   "no policy",
+			params: ExplainEnforcementParams{Limits: "[]"},
+			errMsg: "Error: no RateLimitPolicy given",
+		},
+		{
+			name:   "invalid limits",
+			params: ExplainEnforcementParams{Policy: testRateLimitPolicy, Limits: "{namespace: shop/rl}"},
+			errMsg: "Error: invalid limits: expected a Limitador CR, ConfigMap or list of limits",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := explainEnforcementHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result enforcementOutput
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if len(result.Policies) != 1 || len(result.Policies[0].Limits) != 1 {
+				t.Fatalf("want one policy with one limit, got:\n%s", out)
+			}
+			limit := result.Policies[0].Limits[0]
+			if limit.Identifier != testLimitID || limit.State != tt.state {
+				t.Errorf("limit %s is %s, want %s %s", limit.Identifier, limit.State, testLimitID, tt.state)
+			}
+			var checks []string
+			for _, f := range result.Findings {
+				checks = append(checks, f.Check)
+			}
+			if !reflect.DeepEqual(checks, tt.checks) {
+				t.Errorf("findings = %v, want %v\n%s", checks, tt.checks, out)
+			}
+			if len(result.NotChecked) != tt.notChecked {
+				t.Errorf("notChecked = %v, want %d entries", result.NotChecked, tt.notChecked)
+			}
+		})
+	}
+}
+
+func TestLimitIdentifier(t *testing.T) {
+	tests := []struct {
+		namespace, policy, limit string
+		want                     string
+	}{
+		{"shop", "rl", "per-user", testLimitID},
+		{"shop", "rl", "global", "limit.global__20ac210c"},
+		// the hash keeps limits of the same name in different policies apart
+		{"shop", "other", "global", "limit.global__3ed27238"},
+		{"shop", "rl", "ünï.côde", "limit.ünï_côde__0a5ea9c0"},
+	}
+	for _, tt := range tests {
+		if got := limitIdentifier(tt.namespace, tt.policy, tt.limit); got != tt.want {
+			t.Errorf("limitIdentifier(%s, %s, %s) = %s, want %s", tt.namespace, tt.policy, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSameLimit(t *testing.T) {
+	tests := []struct {
+		identifier, derived string
+		want                bool
+	}{
+		{testLimitID, testLimitID, true},
+		// another release hashed different input
+		{"limit.per_user__0badc0de", testLimitID, true},
+		{"limit.per_user_admin__e129dcd4", testLimitID, false},
+		{"limit.per__user__e129dcd4", "limit.per__e129dcd4", false},
+		{"limit.global__20ac210c", testLimitID, false},
+		{"", testLimitID, false},
+	}
+	for _, tt := range tests {
+		if got := sameLimit(tt.identifier, tt.derived); got != tt.want {
+			t.Errorf("sameLimit(%q, %q) = %v, want %v", tt.identifier, tt.derived, got, tt.want)
+		}
+	}
+}
+
+func TestContradiction(t *testing.T) {
+	tests := []struct {
+		predicates []string
+		want       string
+	}{
+		{nil, ""},
+		{[]string{"request.method == 'GET'", "request.path == '/api'"}, ""},
+		{[]string{"request.method == 'GET'", `request.method == "GET"`}, ""},
+		{[]string{"request.method == 'GET'", "request.method == 'POST'"}, `request.method must equal both "GET" and "POST"`},
+		{[]string{"request.method != 'GET'", "request.method == 'GET'"}, ""},
+		{[]string{" false "}, "predicate is false"},
+	}
+	for _, tt := range tests {
+		if got := contradiction(tt.predicates); got != tt.want {
+			t.Errorf("contradiction(%q) = %q, want %q", tt.predicates, got, tt.want)
+		}
+	}
+}
+
+func TestRateSeconds(t *testing.T) {
+	tests := []struct {
+		rate map[string]interface{}
+		want int64
+	}{
+		{map[string]interface{}{"window": "1m"}, 60},
+		{map[string]interface{}{"window": "90s"}, 90},
+		{map[string]interface{}{"window": "soon"}, 0},
+		{map[string]interface{}{"duration": int64(2), "unit": "hour"}, 7200},
+		{map[string]interface{}{"duration": int64(2), "unit": "fortnight"}, 0},
+	}
+	for _, tt := range tests {
+		if got := rateSeconds(tt.rate); got != tt.want {
+			t.Errorf("rateSeconds(%v) = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestLimitadorLimits(t *testing.T) {
+	limit := "- namespace: shop/rl\n  max_value: 10\n  seconds: 60\n  conditions: [\"descriptors[0]['" + testLimitID + "'] == '1'\"]\n"
+	indented := "    " + strings.ReplaceAll(strings.TrimSuffix(limit, "\n"), "\n", "\n    ") + "\n"
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"nothing", "", nil},
+		{"bare list", limit, []string{"10 per 60s in shop/rl"}},
+		{"empty list", "[]", []string{}},
+		{"Limitador CR", "apiVersion: limitador.kuadrant.io/v1alpha1\nkind: Limitador\nmetadata:\n  name: limitador\nspec:\n  limits:\n" + indented, []string{"10 per 60s in shop/rl"}},
+		{"ConfigMap", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: limitador-config\ndata:\n  limitador-config.yaml: |\n" + indented, []string{"10 per 60s in shop/rl"}},
+		{"other objects", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: other\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, err := limitadorLimits(tt.text, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if limits != nil {
+				got = []string{}
+			}
+			for _, l := range limits {
+				got = append(got, l.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
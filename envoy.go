@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	httpConnectionManager = "envoy.filters.network.http_connection_manager"
+	routerFilter          = "envoy.filters.http.router"
+	wasmFilterType        = "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm"
+	// envoyGatewayPortShift is added by Envoy Gateway to privileged
+	// listener ports, e.g. 80 listens on 10080
+	envoyGatewayPortShift = 10000
+)
+
+// kuadrantClusters are the clusters the operator adds for the wasm-shim's
+// services, checked when the plugin config itself isn't in the dump
+var kuadrantClusters = map[string]string{
+	"ratelimit": "kuadrant-ratelimit-service",
+	"auth":      "kuadrant-auth-service",
+}
+
+type AnalyzeEnvoyConfigParams struct {
+	ConfigDump string `json:"configDump,omitempty" jsonschema:"Envoy /config_dump JSON, e.g. from istioctl proxy-config all <pod> -o json"`
+	Path       string `json:"path,omitempty" jsonschema:"Config dump file, relative to the server's -snapshot-dir, to read instead of configDump"`
+	Gateway    string `json:"gateway,omitempty" jsonschema:"Gateway YAML whose listeners should have the Kuadrant wasm filter (default: every HTTP listener in the dump)"`
+	HTTPRoute  string `json:"httpRoute,omitempty" jsonschema:"HTTPRoute YAML whose hostnames and rules should be routed by the gateway"`
+}
+
+// envoyConfig is the parts of a config dump the checks read
+type envoyConfig struct {
+	listeners    []map[string]interface{}
+	routeConfigs map[string]map[string]interface{}
+	clusters     []string
+	// ecdsFilters are filter configs delivered by ECDS, as Istio does for
+	// WasmPlugins, by name
+	ecdsFilters map[string]map[string]interface{}
+}
+
+type envoyListenerSummary struct {
+	Name           string   `yaml:"name"`
+	Port           int64    `yaml:"port"`
+	KuadrantFilter string   `yaml:"kuadrantFilter"`
+	RouteConfigs   []string `yaml:"routeConfigs,omitempty"`
+	Domains        []string `yaml:"domains,omitempty"`
+}
+
+type wasmFilterSummary struct {
+	Name     string            `yaml:"name"`
+	Services map[string]string `yaml:"services,omitempty"`
+	// ActionSets is how many action sets the plugin config has
+	ActionSets int `yaml:"actionSets"`
+}
+
+func analyzeEnvoyConfigHandler(ctx context.Context, params AnalyzeEnvoyConfigParams) (string, error) {
+	data := []byte(params.ConfigDump)
+	if params.Path != "" {
+		var err error
+		data, err = readSnapshotFile(params.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+	}
+	if len(data) == 0 {
+		return "Error: configDump or path is required", nil
+	}
+	config, err := parseConfigDump(data)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid config dump: %v", err), nil
+	}
+	if len(config.listeners) == 0 {
+		return "Error: config dump has no listeners", nil
+	}
+
+	gateway, err := parseObject(params.Gateway, gatewayKind.Kind)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid gateway: %v", err), nil
+	}
+	route, err := parseObject(params.HTTPRoute, httpRouteKind.Kind)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid httpRoute: %v", err), nil
+	}
+
+	var (
+		findings  []finding
+		listeners []envoyListenerSummary
+		filters   = make(map[string]wasmFilterSummary)
+	)
+	for _, listener := range config.checkedListeners(gateway, &findings) {
+		summary, listenerFindings := config.checkListener(listener, filters)
+		listeners = append(listeners, summary)
+		findings = append(findings, listenerFindings...)
+	}
+	for _, filter := range filters {
+		findings = append(findings, config.checkServices(filter)...)
+	}
+	if route != nil {
+		findings = append(findings, config.checkRoute(route, listeners)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return slices.Index(severities, findings[i].Severity) < slices.Index(severities, findings[j].Severity)
+	})
+
+	report := map[string]interface{}{"listeners": listeners}
+	if len(filters) > 0 {
+		summaries := make([]wasmFilterSummary, 0, len(filters))
+		for _, name := range sortedKeys(filters) {
+			summaries = append(summaries, filters[name])
+		}
+		report["wasmFilters"] = summaries
+	}
+	var clusters []string
+	for _, cluster := range config.clusters {
+		if strings.Contains(cluster, "kuadrant") || strings.Contains(cluster, "limitador") || strings.Contains(cluster, "authorino") {
+			clusters = append(clusters, cluster)
+		}
+	}
+	report["kuadrantClusters"] = clusters
+	if len(findings) > 0 {
+		report["findings"] = findings
+	}
+	return renderSummary(report)
+}
+
+// parseObject parses a manifest of one object of the given kind, or
+// returns nil if text is empty
+func parseObject(text, kind string) (*unstructured.Unstructured, error) {
+	if text == "" {
+		return nil, nil
+	}
+	objects, err := parseManifests(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("expected one %s, got %d objects", kind, len(objects))
+	}
+	if objects[0].GetKind() != kind {
+		return nil, fmt.Errorf("expected a %s, not a %s", kind, objects[0].GetKind())
+	}
+	return objects[0], nil
+}
+
+// parseConfigDump reads a /config_dump, or a bare list of listeners,
+// route configs and clusters as printed by istioctl proxy-config
+func parseConfigDump(data []byte) (*envoyConfig, error) {
+	var raw interface{}
+	if err := utiljson.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	config := &envoyConfig{
+		routeConfigs: make(map[string]map[string]interface{}),
+		ecdsFilters:  make(map[string]map[string]interface{}),
+	}
+
+	var items []interface{}
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		configs, _, _ := unstructured.NestedSlice(raw, "configs")
+		for _, c := range configs {
+			dump, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"static_listeners", "dynamic_listeners", "static_route_configs", "dynamic_route_configs", "static_clusters", "dynamic_active_clusters", "ecds_filters"} {
+				entries, _, _ := unstructured.NestedSlice(dump, field)
+				items = append(items, entries...)
+			}
+		}
+	case []interface{}:
+		items = raw
+	default:
+		return nil, fmt.Errorf("expected a JSON object or list")
+	}
+
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// unwrap dump entries such as {"active_state": {"listener": ...}}
+		for _, path := range [][]string{{"active_state", "listener"}, {"listener"}, {"route_config"}, {"cluster"}, {"ec_filter"}} {
+			if inner, ok, _ := unstructured.NestedFieldNoCopy(entry, path...); ok {
+				if m, ok := inner.(map[string]interface{}); ok {
+					entry = m
+					break
+				}
+			}
+		}
+		switch {
+		case entry["filter_chains"] != nil || entry["default_filter_chain"] != nil:
+			config.listeners = append(config.listeners, entry)
+		case entry["virtual_hosts"] != nil:
+			config.routeConfigs[stringField(entry, "name")] = entry
+		case entry["typed_config"] != nil:
+			config.ecdsFilters[stringField(entry, "name")] = entry
+		case entry["name"] != nil:
+			config.clusters = append(config.clusters, stringField(entry, "name"))
+		}
+	}
+	return config, nil
+}
+
+// checkedListeners returns the Envoy listeners for the Gateway's
+// listeners, or every listener with an HTTP connection manager
+func (c *envoyConfig) checkedListeners(gateway *unstructured.Unstructured, findings *[]finding) []map[string]interface{} {
+	if gateway == nil {
+		var listeners []map[string]interface{}
+		for _, listener := range c.listeners {
+			if len(connectionManagers(listener)) > 0 {
+				listeners = append(listeners, listener)
+			}
+		}
+		return listeners
+	}
+
+	var listeners []map[string]interface{}
+	gatewayListeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	for _, gl := range gatewayListeners {
+		l, ok := gl.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		port := intField(l, "port")
+		i := slices.IndexFunc(c.listeners, func(listener map[string]interface{}) bool {
+			p := intField(listener, "address", "socket_address", "port_value")
+			return p == port || p == port+envoyGatewayPortShift
+		})
+		if i < 0 {
+			*findings = append(*findings, finding{
+				Severity: "critical",
+				Check:    "listener-missing",
+				Object:   fmt.Sprintf("%s listener %s", objectName(gateway), stringField(l, "name")),
+				Summary:  fmt.Sprintf("No Envoy listener on port %d; the gateway's proxy hasn't been configured for it", port),
+				NextSteps: []string{
+					"Check the dump is from a pod of this Gateway's deployment",
+					"Check the Gateway's Programmed condition and listener status (describe_gateway)",
+				},
+			})
+			continue
+		}
+		if !slices.ContainsFunc(listeners, func(listener map[string]interface{}) bool {
+			return stringField(listener, "name") == stringField(c.listeners[i], "name")
+		}) {
+			listeners = append(listeners, c.listeners[i])
+		}
+	}
+	return listeners
+}
+
+// connectionManagers returns the HTTP connection manager configs of a
+// listener's filter chains
+func connectionManagers(listener map[string]interface{}) []map[string]interface{} {
+	chains, _, _ := unstructured.NestedSlice(listener, "filter_chains")
+	if chain, ok, _ := unstructured.NestedFieldNoCopy(listener, "default_filter_chain"); ok {
+		chains = append(chains, chain)
+	}
+	var managers []map[string]interface{}
+	for _, chain := range chains {
+		ch, ok := chain.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		filters, _, _ := unstructured.NestedSlice(ch, "filters")
+		for _, filter := range filters {
+			f, ok := filter.(map[string]interface{})
+			if !ok || stringField(f, "name") != httpConnectionManager {
+				continue
+			}
+			if hcm, ok := f["typed_config"].(map[string]interface{}); ok {
+				managers = append(managers, hcm)
+			}
+		}
+	}
+	return managers
+}
+
+// isKuadrantFilter reports whether an HTTP filter is the Kuadrant
+// wasm-shim, named by Istio after the WasmPlugin, <namespace>.kuadrant-<gateway>,
+// and by Envoy Gateway after the EnvoyExtensionPolicy. Filters Istio
+// delivers over ECDS carry no typed_config, only the type they accept.
+func isKuadrantFilter(filter map[string]interface{}) bool {
+	name := stringField(filter, "name")
+	if !strings.Contains(name, "kuadrant") {
+		return false
+	}
+	if strings.Contains(name, "wasm") || stringField(filter, "typed_config", "@type") == wasmFilterType {
+		return true
+	}
+	typeURLs, _, _ := unstructured.NestedStringSlice(filter, "config_discovery", "type_urls")
+	return slices.Contains(typeURLs, wasmFilterType)
+}
+
+// checkListener reports whether each of a listener's connection managers
+// runs the Kuadrant wasm filter before the router, and records the
+// filters' plugin configs
+func (c *envoyConfig) checkListener(listener map[string]interface{}, filters map[string]wasmFilterSummary) (envoyListenerSummary, []finding) {
+	summary := envoyListenerSummary{
+		Name:           stringField(listener, "name"),
+		Port:           intField(listener, "address", "socket_address", "port_value"),
+		KuadrantFilter: "none",
+	}
+	object := "Envoy listener " + summary.Name
+
+	var findings []finding
+	for _, hcm := range connectionManagers(listener) {
+		if name := stringField(hcm, "rds", "route_config_name"); name != "" && !slices.Contains(summary.RouteConfigs, name) {
+			summary.RouteConfigs = append(summary.RouteConfigs, name)
+		}
+		if vhosts, ok, _ := unstructured.NestedSlice(hcm, "route_config", "virtual_hosts"); ok {
+			summary.Domains = append(summary.Domains, domains(vhosts)...)
+		}
+
+		httpFilters, _, _ := unstructured.NestedSlice(hcm, "http_filters")
+		kuadrant, router := -1, -1
+		for i, f := range httpFilters {
+			filter, ok := f.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch {
+			case isKuadrantFilter(filter) && kuadrant < 0:
+				kuadrant = i
+				summary.KuadrantFilter = stringField(filter, "name")
+				filters[summary.KuadrantFilter] = c.wasmFilter(filter, &findings)
+			case stringField(filter, "name") == routerFilter:
+				router = i
+			}
+		}
+		switch {
+		case kuadrant < 0:
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "wasm-filter-missing",
+				Object:   object,
+				Summary:  "The Kuadrant wasm filter is not in the listener's HTTP filters, so no RateLimitPolicy or AuthPolicy is enforced on it",
+				NextSteps: []string{
+					"Check the WasmPlugin (Istio) or EnvoyExtensionPolicy (Envoy Gateway) named kuadrant-<gateway> exists and selects this gateway",
+					"Check a RateLimitPolicy or AuthPolicy is enforced on a route of this gateway; the operator only adds the filter when one is",
+				},
+			})
+		case router >= 0 && router < kuadrant:
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "wasm-filter-after-router",
+				Object:   object,
+				Summary:  "The Kuadrant wasm filter comes after the router, which ends the filter chain, so it never runs",
+			})
+		}
+	}
+	for _, name := range summary.RouteConfigs {
+		if rc, ok := c.routeConfigs[name]; ok {
+			vhosts, _, _ := unstructured.NestedSlice(rc, "virtual_hosts")
+			summary.Domains = append(summary.Domains, domains(vhosts)...)
+		}
+	}
+	slices.Sort(summary.Domains)
+	summary.Domains = slices.Compact(summary.Domains)
+	return summary, findings
+}
+
+func domains(vhosts []interface{}) []string {
+	var out []string
+	for _, vhost := range vhosts {
+		if v, ok := vhost.(map[string]interface{}); ok {
+			d, _, _ := unstructured.NestedStringSlice(v, "domains")
+			out = append(out, d...)
+		}
+	}
+	return out
+}
+
+// wasmFilter reads the plugin config of a Kuadrant wasm filter, from the
+// filter itself or, for filters discovered through ECDS, the ECDS dump
+func (c *envoyConfig) wasmFilter(filter map[string]interface{}, findings *[]finding) wasmFilterSummary {
+	name := stringField(filter, "name")
+	summary := wasmFilterSummary{Name: name}
+
+	typed, _ := filter["typed_config"].(map[string]interface{})
+	if _, ok := filter["config_discovery"]; ok {
+		ecds, ok := c.ecdsFilters[name]
+		if !ok {
+			*findings = append(*findings, finding{
+				Severity: "critical",
+				Check:    "wasm-filter-not-loaded",
+				Object:   "wasm filter " + name,
+				Summary:  "The filter is discovered through ECDS but the dump has no config for it, so the wasm module hasn't loaded",
+				NextSteps: []string{
+					"Check the istio-proxy logs for errors fetching the wasm-shim image",
+					"Check the WasmPlugin's url is reachable from the gateway and any imagePullSecret exists",
+				},
+			})
+			return summary
+		}
+		typed, _ = ecds["typed_config"].(map[string]interface{})
+	}
+
+	// Istio may wrap the Wasm config in a TypedStruct
+	if value, ok := typed["value"].(map[string]interface{}); ok && stringField(typed, "type_url") == wasmFilterType {
+		typed = value
+	}
+	configuration, _, _ := unstructured.NestedFieldNoCopy(typed, "config", "configuration")
+	var (
+		pluginConfig wasmConfig
+		err          error
+	)
+	switch v := configuration.(type) {
+	case map[string]interface{}:
+		// a google.protobuf.StringValue holding the JSON plugin config
+		if s, ok := v["value"].(string); ok {
+			err = json.Unmarshal([]byte(s), &pluginConfig)
+		} else {
+			err = convertTo(v, &pluginConfig)
+		}
+	case nil:
+		err = fmt.Errorf("the filter has no config.configuration")
+	default:
+		err = fmt.Errorf("config.configuration is a %T, not a plugin config", v)
+	}
+	if err != nil {
+		*findings = append(*findings, finding{
+			Severity: "warning",
+			Check:    "wasm-config-unreadable",
+			Object:   "wasm filter " + name,
+			Summary:  "The filter's plugin config couldn't be read, so its services and action sets aren't checked; the wasm-shim rejects a config it can't parse",
+			Details:  []string{err.Error()},
+			NextSteps: []string{
+				"Check the dump wasn't redacted or truncated",
+				"Check the wasm-shim logs for errors parsing its configuration",
+			},
+		})
+		return summary
+	}
+	summary.Services = make(map[string]string, len(pluginConfig.Services))
+	for serviceName, service := range pluginConfig.Services {
+		summary.Services[serviceName] = service.Type + " -> " + service.Endpoint
+	}
+	summary.ActionSets = len(pluginConfig.ActionSets)
+	return summary
+}
+
+// checkServices reports wasm-shim services whose endpoint cluster isn't
+// configured, so calls to Limitador or Authorino fail
+func (c *envoyConfig) checkServices(filter wasmFilterSummary) []finding {
+	endpoints := make(map[string]string)
+	for name, service := range filter.Services {
+		serviceType, endpoint, _ := strings.Cut(service, " -> ")
+		endpoints[name+" ("+serviceType+")"] = endpoint
+	}
+	if len(filter.Services) == 0 {
+		for serviceType, cluster := range kuadrantClusters {
+			endpoints["default "+serviceType+" service"] = cluster
+		}
+	}
+
+	var findings []finding
+	for _, name := range sortedKeys(endpoints) {
+		if slices.Contains(c.clusters, endpoints[name]) {
+			continue
+		}
+		severity := "critical"
+		if len(filter.Services) == 0 {
+			// only the default name is known, which may not be used
+			severity = "warning"
+		}
+		findings = append(findings, finding{
+			Severity: severity,
+			Check:    "service-cluster-missing",
+			Object:   "wasm filter " + filter.Name,
+			Summary:  fmt.Sprintf("Service %s uses cluster %s, which isn't configured; calls fail and the service's failureMode applies", name, endpoints[name]),
+			NextSteps: []string{
+				"Check the EnvoyFilter (Istio) or EnvoyPatchPolicy (Envoy Gateway) the operator creates for the gateway adds the cluster",
+				"Check the Limitador and Authorino services exist in the Kuadrant namespace",
+			},
+		})
+	}
+	return findings
+}
+
+// checkRoute reports hostnames of the HTTPRoute without a virtual host on
+// the checked listeners, and virtual hosts without routes from it
+func (c *envoyConfig) checkRoute(route *unstructured.Unstructured, listeners []envoyListenerSummary) []finding {
+	object := objectName(route)
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+
+	var (
+		findings []finding
+		vhosts   []map[string]interface{}
+	)
+	for _, listener := range listeners {
+		for _, name := range listener.RouteConfigs {
+			items, _, _ := unstructured.NestedSlice(c.routeConfigs[name], "virtual_hosts")
+			for _, item := range items {
+				if v, ok := item.(map[string]interface{}); ok {
+					vhosts = append(vhosts, v)
+				}
+			}
+		}
+	}
+	for _, hostname := range hostnames {
+		served := slices.ContainsFunc(vhosts, func(v map[string]interface{}) bool {
+			d, _, _ := unstructured.NestedStringSlice(v, "domains")
+			return slices.ContainsFunc(d, func(domain string) bool {
+				domain, _, _ = strings.Cut(domain, ":")
+				return domain == "*" || hostMatches(domain, hostname) || hostMatches(hostname, domain)
+			})
+		})
+		if !served {
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "hostname-not-routed",
+				Object:   object,
+				Summary:  fmt.Sprintf("No virtual host on the checked listeners serves %s", hostname),
+				NextSteps: []string{
+					"Check the route is accepted by the gateway and its hostnames intersect the listeners' (describe_gateway)",
+				},
+			})
+		}
+	}
+
+	// Envoy Gateway names routes httproute/<namespace>/<name>/..., and
+	// Istio records the VirtualService generated for the HTTPRoute in the
+	// route's metadata
+	routed := false
+	needles := []string{
+		"httproute/" + route.GetNamespace() + "/" + route.GetName() + "/",
+		"/namespaces/" + route.GetNamespace() + "/virtual-service/" + route.GetName() + "-istio-autogenerated",
+	}
+	for _, v := range vhosts {
+		routes, _, _ := unstructured.NestedSlice(v, "routes")
+		for _, r := range routes {
+			data, _ := json.Marshal(r)
+			if slices.ContainsFunc(needles, func(needle string) bool { return strings.Contains(string(data), needle) }) {
+				routed = true
+			}
+			if m, ok := r.(map[string]interface{}); ok {
+				findings = append(findings, disabledKuadrantFilter(object, m)...)
+			}
+		}
+	}
+	if !routed && len(vhosts) > 0 {
+		findings = append(findings, finding{
+			Severity: "warning",
+			Check:    "route-not-found",
+			Object:   object,
+			Summary:  "No Envoy route on the checked listeners refers to this HTTPRoute; it may not be attached, or the dump is from another gateway",
+		})
+	}
+	return findings
+}
+
+// disabledKuadrantFilter reports routes that turn the Kuadrant wasm
+// filter off through per-filter config
+func disabledKuadrantFilter(object string, route map[string]interface{}) []finding {
+	perFilter, _, _ := unstructured.NestedMap(route, "typed_per_filter_config")
+	var findings []finding
+	for name, config := range perFilter {
+		c, ok := config.(map[string]interface{})
+		if !ok || !isKuadrantFilter(map[string]interface{}{"name": name}) {
+			continue
+		}
+		if disabled, _, _ := unstructured.NestedBool(c, "disabled"); disabled {
+			findings = append(findings, finding{
+				Severity: "warning",
+				Check:    "wasm-filter-disabled",
+				Object:   object,
+				Summary:  fmt.Sprintf("Envoy route %s disables the Kuadrant wasm filter", stringField(route, "name")),
+			})
+		}
+	}
+	return findings
+}
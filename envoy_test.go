@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	testRouter = `{"name": "envoy.filters.http.router"}`
+
+	testPluginConfig = `{\"services\": {\"ratelimit-service\": {\"type\": \"ratelimit\", \"endpoint\": \"kuadrant-ratelimit-service\"}}, \"actionSets\": [{\"name\": \"store\"}]}`
+)
+
+// testWasmFilter returns a Kuadrant wasm filter whose plugin config is
+// the JSON string config
+func testWasmFilter(config string) string {
+	return `{
+  "name": "shop.kuadrant-external",
+  "typed_config": {
+    "@type": "` + wasmFilterType + `",
+    "config": {"configuration": {"@type": "type.googleapis.com/google.protobuf.StringValue", "value": "` + config + `"}}
+  }
+}`
+}
+
+// testConfigDump returns an Istio config dump with a listener on 8080
+// running httpFilters, routing api.example.com to the HTTPRoute shop/store
+func testConfigDump(httpFilters ...string) string {
+	return `{
+  "configs": [
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+      "dynamic_listeners": [{
+        "name": "0.0.0.0_8080",
+        "active_state": {"listener": {
+          "name": "0.0.0.0_8080",
+          "address": {"socket_address": {"address": "0.0.0.0", "port_value": 8080}},
+          "filter_chains": [{"filters": [{
+            "name": "envoy.filters.network.http_connection_manager",
+            "typed_config": {
+              "rds": {"route_config_name": "http.8080"},
+              "http_filters": [` + strings.Join(httpFilters, ",") + `]
+            }
+          }]}]
+        }}
+      }]
+    },
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.RoutesConfigDump",
+      "dynamic_route_configs": [{"route_config": {
+        "name": "http.8080",
+        "virtual_hosts": [{
+          "name": "api.example.com:80",
+          "domains": ["api.example.com"],
+          "routes": [{
+            "name": "shop.store.0",
+            "metadata": {"filter_metadata": {"istio": {"config": "/apis/networking.istio.io/v1/namespaces/shop/virtual-service/store-istio-autogenerated-k8s-gateway-external-0"}}}
+          }]
+        }]
+      }}]
+    },
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+      "dynamic_active_clusters": [{"cluster": {"name": "kuadrant-ratelimit-service"}}, {"cluster": {"name": "kuadrant-auth-service"}}, {"cluster": {"name": "outbound|80||store.shop.svc.cluster.local"}}]
+    }
+  ]
+}`
+}
+
+type envoyOutput struct {
+	Listeners        []envoyListenerSummary `yaml:"listeners"`
+	WasmFilters      []wasmFilterSummary    `yaml:"wasmFilters"`
+	KuadrantClusters []string               `yaml:"kuadrantClusters"`
+	Findings         []finding              `yaml:"findings"`
+}
+
+func TestAnalyzeEnvoyConfigHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		params AnalyzeEnvoyConfigParams
+		// filter is the listener's Kuadrant filter
+		filter     string
+		actionSets int
+		checks     []string
+		errMsg     string
+	}{
+		{
+			name:       "filter before the router",
+			params:     AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(testWasmFilter(testPluginConfig), testRouter)},
+			filter:     "shop.kuadrant-external",
+			actionSets: 1,
+		},
+		{
+			name:   "no filter",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(testRouter)},
+			filter: "none",
+			checks: []string{"wasm-filter-missing"},
+		},
+		{
+			name:       "filter after the router",
+			params:     AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(testRouter, testWasmFilter(testPluginConfig))},
+			filter:     "shop.kuadrant-external",
+			actionSets: 1,
+			checks:     []string{"wasm-filter-after-router"},
+		},
+		{
+			name:   "unparseable plugin config",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(testWasmFilter(`{\"services\": `), testRouter)},
+			filter: "shop.kuadrant-external",
+			checks: []string{"wasm-config-unreadable"},
+		},
+		{
+			name: "service cluster missing",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(
+				testWasmFilter(strings.Replace(testPluginConfig, "kuadrant-ratelimit-service", "limitador", 1)), testRouter,
+			)},
+			filter:     "shop.kuadrant-external",
+			actionSets: 1,
+			checks:     []string{"service-cluster-missing"},
+		},
+		{
+			name:   "filter named after Kuadrant that isn't wasm",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(`{"name": "shop.kuadrant-lua", "typed_config": {"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua"}}`, testRouter)},
+			filter: "none",
+			checks: []string{"wasm-filter-missing"},
+		},
+		{
+			name:   "ECDS filter without config",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: testConfigDump(`{"name": "shop.kuadrant-external", "config_discovery": {"type_urls": ["`+wasmFilterType+`"]}}`, testRouter)},
+			filter: "shop.kuadrant-external",
+			checks: []string{"wasm-filter-not-loaded"},
+		},
+		{
+			name: "route hostname without a virtual host",
+			params: AnalyzeEnvoyConfigParams{
+				ConfigDump: testConfigDump(testWasmFilter(testPluginConfig), testRouter),
+				HTTPRoute:  "apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: store\n  namespace: shop\nspec:\n  hostnames: [api.example.com, shop.example.com]\n",
+			},
+			filter:     "shop.kuadrant-external",
+			actionSets: 1,
+			checks:     []string{"hostname-not-routed"},
+		},
+		{
+			name: "gateway listener without an Envoy listener",
+			params: AnalyzeEnvoyConfigParams{
+				ConfigDump: testConfigDump(testWasmFilter(testPluginConfig), testRouter),
+				Gateway:    "apiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: external\n  namespace: shop\nspec:\n  listeners:\n    - name: http\n      port: 8080\n    - name: admin\n      port: 9090\n",
+			},
+			filter:     "shop.kuadrant-external",
+			actionSets: 1,
+			checks:     []string{"listener-missing"},
+		},
+		{
+			name: "several gateways",
+			params: AnalyzeEnvoyConfigParams{
+				ConfigDump: testConfigDump(testRouter),
+				Gateway:    "apiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: a\n---\napiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: b\n",
+			},
+			errMsg: "Error: invalid gateway: expected one Gateway, got 2 objects",
+		},
+		{
+			name:   "not JSON",
+			params: AnalyzeEnvoyConfigParams{ConfigDump: "listeners:"},
+			errMsg: "Error: invalid config dump",
+		},
+		{
+			name:   "nothing given",
+			errMsg: "Error: configDump or path is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := analyzeEnvoyConfigHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result envoyOutput
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if len(result.Listeners) != 1 || result.Listeners[0].KuadrantFilter != tt.filter {
+				t.Errorf("listeners = %+v, want one with filter %s", result.Listeners, tt.filter)
+			}
+			if tt.filter != "none" && (len(result.WasmFilters) != 1 || result.WasmFilters[0].ActionSets != tt.actionSets) {
+				t.Errorf("wasmFilters = %+v, want one with %d action sets", result.WasmFilters, tt.actionSets)
+			}
+			var checks []string
+			for _, f := range result.Findings {
+				checks = append(checks, f.Check)
+			}
+			if !reflect.DeepEqual(checks, tt.checks) {
+				t.Errorf("findings = %v, want %v\n%s", checks, tt.checks, out)
+			}
+		})
+	}
+}
+
+func TestParseConfigDump(t *testing.T) {
+	tests := []struct {
+		name         string
+		dump         string
+		listeners    []string
+		routeConfigs []string
+		clusters     []string
+		ecdsFilters  []string
+		errMsg       string
+	}{
+		{
+			name:         "config dump",
+			dump:         testConfigDump(testRouter),
+			listeners:    []string{"0.0.0.0_8080"},
+			routeConfigs: []string{"http.8080"},
+			clusters:     []string{"kuadrant-ratelimit-service", "kuadrant-auth-service", "outbound|80||store.shop.svc.cluster.local"},
+		},
+		{
+			name: "static config and ECDS",
+			dump: `{"configs": [
+				{"static_listeners": [{"listener": {"name": "main", "default_filter_chain": {}}}]},
+				{"static_clusters": [{"cluster": {"name": "kuadrant-auth-service"}}]},
+				{"ecds_filters": [{"ec_filter": {"name": "kuadrant-wasm", "typed_config": {}}}]}
+			]}`,
+			listeners:   []string{"main"},
+			clusters:    []string{"kuadrant-auth-service"},
+			ecdsFilters: []string{"kuadrant-wasm"},
+		},
+		{
+			name:         "istioctl proxy-config list",
+			dump:         `[{"name": "0.0.0.0_80", "filter_chains": []}, {"name": "http.80", "virtual_hosts": []}, {"name": "limitador"}]`,
+			listeners:    []string{"0.0.0.0_80"},
+			routeConfigs: []string{"http.80"},
+			clusters:     []string{"limitador"},
+		},
+		{
+			name:   "scalar",
+			dump:   `"config"`,
+			errMsg: "expected a JSON object or list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseConfigDump([]byte(tt.dump))
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var listeners []string
+			for _, l := range config.listeners {
+				listeners = append(listeners, stringField(l, "name"))
+			}
+			for _, c := range []struct {
+				field     string
+				got, want []string
+			}{
+				{"listeners", listeners, tt.listeners},
+				{"routeConfigs", sortedKeys(config.routeConfigs), tt.routeConfigs},
+				{"clusters", config.clusters, tt.clusters},
+				{"ecdsFilters", sortedKeys(config.ecdsFilters), tt.ecdsFilters},
+			} {
+				if !slices.Equal(c.got, c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseObject(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   string
+		errMsg string
+	}{
+		{"", "", ""},
+		{"apiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: external\n", "external", ""},
+		{"apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: store\n", "", "expected a Gateway, not a HTTPRoute"},
+		{"apiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: a\n---\napiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\nmetadata:\n  name: b\n", "", "expected one Gateway, got 2 objects"},
+	}
+	for _, tt := range tests {
+		obj, err := parseObject(tt.text, gatewayKind.Kind)
+		switch {
+		case tt.errMsg != "":
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("parseObject(%q) error %v, want %q", tt.text, err, tt.errMsg)
+			}
+		case err != nil:
+			t.Errorf("parseObject(%q) unexpected error %v", tt.text, err)
+		case tt.want == "" && obj != nil, tt.want != "" && (obj == nil || obj.GetName() != tt.want):
+			t.Errorf("parseObject(%q) = %v, want %s", tt.text, obj, tt.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+)
+
+// reasonInfo explains a condition reason and what to check next
+type reasonInfo struct {
+	Explanation  string   `yaml:"explanation"`
+	LikelyCauses []string `yaml:"likelyCauses,omitempty"`
+	NextSteps    []string `yaml:"nextSteps,omitempty"`
+}
+
+// conditionReasons catalogues the reasons Kuadrant policies report, by
+// condition type and reason. Entries in kindReasons take precedence for a
+// policy kind.
+var conditionReasons = map[string]map[string]reasonInfo{
+	"Accepted": {
+		"Accepted": {
+			Explanation: "The policy is valid and attached to its target.",
+		},
+		"TargetNotFound": {
+			Explanation: "The object in spec.targetRef doesn't exist, so the policy applies to nothing.",
+			LikelyCauses: []string{
+				"The target's name or kind is misspelt, or it hasn't been created yet",
+				"targetRef.group is missing or wrong; Gateways and HTTPRoutes need gateway.networking.k8s.io",
+				"The target is in another namespace; policies can only target objects in their own namespace",
+				"targetRef.sectionName names a listener or route rule that doesn't exist",
+			},
+			NextSteps: []string{
+				"Compare spec.targetRef with the target's kind, name and namespace (get_policy_status shows whether it was found)",
+				"Check the target's sectionNames, e.g. listener names with describe_gateway",
+			},
+		},
+		"Invalid": {
+			Explanation: "The policy spec was rejected by the operator's validation. The condition message says which part.",
+			LikelyCauses: []string{
+				"A when predicate or counter is not valid CEL, or refers to an unknown attribute",
+				"Both top-level rules/limits and defaults or overrides are set",
+				"A rate window or limit is malformed",
+			},
+			NextSteps: []string{
+				"Read the condition message for the failing field",
+				"Compare the spec with the policy reference docs (kuadrant://docs/*) for the installed release",
+			},
+		},
+		"Conflicted": {
+			Explanation: "Another policy of the same kind targets the same object and takes precedence.",
+			LikelyCauses: []string{
+				"Two policies of this kind target the same Gateway, listener, HTTPRoute or route rule; the oldest wins",
+			},
+			NextSteps: []string{
+				"List policies of this kind targeting the same object (list_policies) and merge or remove one",
+			},
+		},
+		"MissingDependency": {
+			Explanation: "A component the policy needs is not installed or not ready, so it can't be accepted.",
+			LikelyCauses: []string{
+				"The Gateway API provider (Istio or Envoy Gateway) or its CRDs are missing",
+				"The Kuadrant CR doesn't exist, so the operator hasn't deployed its components",
+			},
+			NextSteps: []string{
+				"Check the Kuadrant, Limitador and Authorino instances and operator deployments (get_kuadrant_status)",
+				"Read the condition message for the missing dependency",
+			},
+		},
+	},
+	"Enforced": {
+		"Enforced": {
+			Explanation: "The policy's rules are configured in the data plane.",
+		},
+		"Unknown": {
+			Explanation: "The policy is accepted but the operator can't confirm its rules are in the data plane yet.",
+			LikelyCauses: []string{
+				"The gateway's data plane configuration (wasm plugin or ext_authz filter) hasn't been applied or is still rolling out",
+				"A component the policy relies on is not ready",
+			},
+			NextSteps: []string{
+				"Wait a few seconds and check again; the condition usually settles after reconciliation",
+				"Check the Kuadrant components are ready (get_kuadrant_status)",
+				"Check the kuadrant-operator logs for reconciliation errors",
+			},
+		},
+		"Overridden": {
+			Explanation: "Every rule of the policy is replaced by another policy, so none of its own rules are enforced.",
+			LikelyCauses: []string{
+				"A policy on the Gateway sets overrides, which win over policies on its routes",
+				"A policy on a more specific target (HTTPRoute or route rule) sets defaults for the same rules",
+			},
+			NextSteps: []string{
+				"Find the policies targeting the same Gateway and its routes (describe_gateway) and check their defaults and overrides",
+				"Read how defaults and overrides combine in the Kuadrant docs (search_docs \"defaults overrides\")",
+			},
+		},
+	},
+}
+
+// kindReasons are reasons whose causes depend on the policy kind
+var kindReasons = map[string]map[string]map[string]reasonInfo{
+	"RateLimitPolicy": {
+		"Enforced": {
+			"Unknown": {
+				Explanation: "The policy is accepted but its limits aren't confirmed in Limitador and the gateway's wasm-shim yet.",
+				LikelyCauses: []string{
+					"The Limitador deployment is not ready or crashlooping, e.g. a bad storage configuration",
+					"The wasm plugin (Istio WasmPlugin or Envoy Gateway EnvoyExtensionPolicy) hasn't been applied to the gateway",
+				},
+				NextSteps: []string{
+					"Check the Limitador instance and deployment (get_kuadrant_status)",
+					"Check the limits configured in the Limitador ConfigMap include this policy's limits",
+					"Check the wasm plugin for the gateway exists and lists this policy's actions",
+				},
+			},
+		},
+		"Accepted": {
+			"MissingDependency": {
+				Explanation: "Limitador or the Gateway API provider is missing, so rate limits can't be configured.",
+				NextSteps: []string{
+					"Check a Limitador instance exists and is ready (get_kuadrant_status)",
+				},
+			},
+		},
+	},
+	"AuthPolicy": {
+		"Enforced": {
+			"Unknown": {
+				Explanation: "The policy is accepted but its AuthConfig isn't confirmed ready in Authorino yet.",
+				LikelyCauses: []string{
+					"The Authorino deployment is not ready",
+					"The generated AuthConfig is not ready, e.g. an unreachable OIDC issuer or a missing API key Secret selector match",
+				},
+				NextSteps: []string{
+					"Check the Authorino instance and deployment (get_kuadrant_status)",
+					"Check the status of the AuthConfig generated for the policy in the Kuadrant namespace",
+				},
+			},
+		},
+		"Accepted": {
+			"MissingDependency": {
+				Explanation: "Authorino or the Gateway API provider is missing, so auth can't be configured.",
+				NextSteps: []string{
+					"Check an Authorino instance exists and is ready (get_kuadrant_status)",
+				},
+			},
+		},
+	},
+	"DNSPolicy": {
+		"Enforced": {
+			"Unknown": {
+				Explanation: "The policy is accepted but its DNSRecords haven't been published to the provider yet.",
+				LikelyCauses: []string{
+					"The provider credentials Secret in providerRefs is missing, in another namespace or lacks permissions",
+					"No hosted zone in the provider account matches the listener hostnames",
+					"Gateway listeners have no hostname, or the Gateway has no addresses yet",
+				},
+				NextSteps: []string{
+					"Check the DNSRecords for the policy and their Ready condition (list_dnsrecords)",
+					"Check the Gateway's listeners have hostnames and it has addresses (describe_gateway)",
+					"Check the dns-operator logs for provider errors",
+				},
+			},
+		},
+		"Accepted": {
+			"MissingDependency": {
+				Explanation: "The DNS operator is not installed, so DNS records can't be managed.",
+			},
+		},
+	},
+	"TLSPolicy": {
+		"Enforced": {
+			"Unknown": {
+				Explanation: "The policy is accepted but the certificates it requests aren't ready yet.",
+				LikelyCauses: []string{
+					"The issuer in issuerRef doesn't exist or is not ready",
+					"An ACME challenge is failing, e.g. DNS not yet resolving to the gateway",
+					"Gateway listeners have no hostname or no certificateRefs",
+				},
+				NextSteps: []string{
+					"Check the cert-manager Certificates and CertificateRequests created for the Gateway listeners",
+					"Check the Issuer or ClusterIssuer's Ready condition",
+				},
+			},
+		},
+		"Accepted": {
+			"MissingDependency": {
+				Explanation: "cert-manager is not installed, so certificates can't be issued.",
+			},
+		},
+	},
+}
+
+// explainReason looks up a reason, preferring the kind's own entry
+func explainReason(kind, condType, reason string) (reasonInfo, bool) {
+	if info, ok := kindReasons[kind][condType][reason]; ok {
+		return info, true
+	}
+	info, ok := conditionReasons[condType][reason]
+	return info, ok
+}
+
+type ExplainStatusParams struct {
+	Kind      string `json:"kind" jsonschema:"Policy kind, e.g. RateLimitPolicy"`
+	Status    string `json:"status,omitempty" jsonschema:"The policy's status block, or the whole policy, as YAML or JSON"`
+	Name      string `json:"name,omitempty" jsonschema:"Name of the policy to fetch from the cluster when status isn't given"`
+	Namespace string `json:"namespace,omitempty" jsonschema:"Namespace of the policy to fetch from the cluster"`
+}
+
+type explainedCondition struct {
+	conditionSummary `yaml:",inline"`
+	reasonInfo       `yaml:",inline"`
+}
+
+func explainStatusHandler(ctx context.Context, params ExplainStatusParams) (string, error) {
+	if params.Kind == "" {
+		return "Error: kind is required", nil
+	}
+	kind := params.Kind
+	if gk, ok := lookupPolicyKind(kind); ok {
+		kind = gk.Kind
+	}
+
+	var conditions []conditionSummary
+	switch {
+	case params.Status != "":
+		data, err := yaml.YAMLToJSON([]byte(params.Status))
+		if err != nil {
+			return fmt.Sprintf("Error: invalid status: %v", err), nil
+		}
+		var parsed interface{}
+		if err := utiljson.Unmarshal(data, &parsed); err != nil {
+			return fmt.Sprintf("Error: invalid status: %v", err), nil
+		}
+		// accept the whole policy, its status block, or a bare condition list
+		switch obj := parsed.(type) {
+		case map[string]interface{}:
+			if _, ok := obj["status"]; ok {
+				conditions = conditionsAt(obj, "status", "conditions")
+			} else {
+				conditions = conditionsAt(obj, "conditions")
+			}
+		case []interface{}:
+			conditions = conditionsAt(map[string]interface{}{"conditions": obj}, "conditions")
+		}
+	case cluster != nil && params.Name != "" && params.Namespace != "":
+		gk, ok := lookupPolicyKind(kind)
+		if !ok {
+			return fmt.Sprintf("Error: unknown policy kind %q, expected one of %s", params.Kind, policyKindNames()), nil
+		}
+		policy, err := cluster.get(ctx, gk, params.Namespace, params.Name)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		conditions = conditionsAt(policy.Object, "status", "conditions")
+	case cluster != nil:
+		return "Error: status, or name and namespace, are required", nil
+	default:
+		return "Error: status is required; fetching policies needs cluster access (-kubernetes)", nil
+	}
+	if len(conditions) == 0 {
+		return "Error: no status conditions found; the operator may not have reconciled the policy yet, or it isn't running", nil
+	}
+
+	explained := make([]explainedCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		info, ok := explainReason(kind, condition.Type, condition.Reason)
+		if !ok {
+			info = reasonInfo{
+				Explanation: fmt.Sprintf("%s=%s with reason %q is not in the catalogue for %s.", condition.Type, condition.Status, condition.Reason, kind),
+				NextSteps:   []string{"Read the condition message and the kuadrant-operator logs"},
+			}
+		}
+		// a healthy condition needs no diagnosis
+		if condition.Status == "True" {
+			info.LikelyCauses, info.NextSteps = nil, nil
+		}
+		explained = append(explained, explainedCondition{conditionSummary: condition, reasonInfo: info})
+	}
+
+	report := map[string]interface{}{
+		"kind":       kind,
+		"state":      policyState(conditions),
+		"conditions": explained,
+	}
+	if params.Name != "" {
+		report["policy"] = strings.TrimPrefix(params.Namespace+"/"+params.Name, "/")
+	}
+	return renderSummary(report)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+type explainOutput struct {
+	Kind       string               `yaml:"kind"`
+	State      string               `yaml:"state"`
+	Policy     string               `yaml:"policy"`
+	Conditions []explainedCondition `yaml:"conditions"`
+}
+
+func TestExplainReason(t *testing.T) {
+	tests := []struct {
+		kind, condType, reason string
+		// want is the start of the explanation
+		want string
+		ok   bool
+	}{
+		{"RateLimitPolicy", "Enforced", "Unknown", "The policy is accepted but its limits aren't confirmed in Limitador", true},
+		{"AuthPolicy", "Enforced", "Unknown", "The policy is accepted but its AuthConfig", true},
+		// kinds without their own entry fall back to the shared catalogue
+		{"TokenRateLimitPolicy", "Enforced", "Unknown", "The policy is accepted but the operator can't confirm", true},
+		{"DNSPolicy", "Accepted", "TargetNotFound", "The object in spec.targetRef doesn't exist", true},
+		{"DNSPolicy", "Accepted", "MissingDependency", "The DNS operator is not installed", true},
+		{"AuthPolicy", "Accepted", "Misconfigured", "", false},
+		{"AuthPolicy", "Ready", "Accepted", "", false},
+	}
+	for _, tt := range tests {
+		info, ok := explainReason(tt.kind, tt.condType, tt.reason)
+		if ok != tt.ok || !strings.HasPrefix(info.Explanation, tt.want) {
+			t.Errorf("explainReason(%s, %s, %s) = %q, %v, want %q, %v", tt.kind, tt.condType, tt.reason, info.Explanation, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExplainStatusHandler(t *testing.T) {
+	notFound := "conditions:\n  - type: Accepted\n    status: \"False\"\n    reason: TargetNotFound\n    message: target not found\n"
+	tests := []struct {
+		name   string
+		params ExplainStatusParams
+		kind   string
+		state  string
+		// want lists each condition as type/reason and whether next steps
+		// are given
+		want   []string
+		errMsg string
+	}{
+		{
+			name:   "status block",
+			params: ExplainStatusParams{Kind: "ratelimitpolicy", Status: notFound},
+			kind:   "RateLimitPolicy",
+			state:  "NotAccepted (TargetNotFound)",
+			want:   []string{"Accepted/TargetNotFound next steps"},
+		},
+		{
+			name:   "whole policy",
+			params: ExplainStatusParams{Kind: "DNSPolicy", Status: "apiVersion: kuadrant.io/v1\nkind: DNSPolicy\nstatus:\n" + indent(notFound, "  ")},
+			kind:   "DNSPolicy",
+			state:  "NotAccepted (TargetNotFound)",
+			want:   []string{"Accepted/TargetNotFound next steps"},
+		},
+		{
+			name:   "condition list as JSON",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Status: `[{"type": "Accepted", "status": "True", "reason": "Accepted"}, {"type": "Enforced", "status": "False", "reason": "Unknown"}]`},
+			kind:   "AuthPolicy",
+			state:  "NotEnforced (Unknown)",
+			want:   []string{"Accepted/Accepted", "Enforced/Unknown next steps"},
+		},
+		{
+			name:   "healthy condition has no next steps",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Status: "conditions:\n  - {type: Accepted, status: \"True\", reason: TargetNotFound}\n"},
+			kind:   "AuthPolicy",
+			state:  "Accepted",
+			want:   []string{"Accepted/TargetNotFound"},
+		},
+		{
+			name:   "reason not in the catalogue",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Status: "conditions:\n  - {type: Accepted, status: \"False\", reason: Misconfigured}\n"},
+			kind:   "AuthPolicy",
+			state:  "NotAccepted (Misconfigured)",
+			want:   []string{"Accepted/Misconfigured next steps"},
+		},
+		{
+			name:   "no kind",
+			params: ExplainStatusParams{Status: notFound},
+			errMsg: "Error: kind is required",
+		},
+		{
+			name:   "no conditions",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Status: "status: {}\n"},
+			errMsg: "Error: no status conditions found",
+		},
+		{
+			name:   "invalid status",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Status: "conditions: ["},
+			errMsg: "Error: invalid status",
+		},
+		{
+			name:   "name without cluster access",
+			params: ExplainStatusParams{Kind: "AuthPolicy", Name: "auth", Namespace: "shop"},
+			errMsg: "Error: status is required; fetching policies needs cluster access",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkExplainStatus(t, tt.params, tt.kind, tt.state, tt.want, tt.errMsg)
+		})
+	}
+}
+
+func TestExplainStatusHandlerCluster(t *testing.T) {
+	c, _ := newFakeCluster(testPolicies()...)
+	previous := cluster
+	cluster = c
+	t.Cleanup(func() { cluster = previous })
+
+	tests := []struct {
+		name   string
+		params ExplainStatusParams
+		kind   string
+		state  string
+		want   []string
+		errMsg string
+	}{
+		{
+			name:   "fetched",
+			params: ExplainStatusParams{Kind: "RateLimitPolicy", Name: "limits", Namespace: "shop"},
+			kind:   "RateLimitPolicy",
+			state:  "NotAccepted (TargetNotFound)",
+			want:   []string{"Accepted/TargetNotFound next steps"},
+		},
+		{
+			name:   "not reconciled",
+			params: ExplainStatusParams{Kind: "RateLimitPolicy", Name: "global", Namespace: "api"},
+			errMsg: "Error: no status conditions found",
+		},
+		{
+			name:   "unknown kind",
+			params: ExplainStatusParams{Kind: "Gateway", Name: "external", Namespace: "api"},
+			errMsg: `Error: unknown policy kind "Gateway"`,
+		},
+		{
+			name:   "no name",
+			params: ExplainStatusParams{Kind: "AuthPolicy"},
+			errMsg: "Error: status, or name and namespace, are required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkExplainStatus(t, tt.params, tt.kind, tt.state, tt.want, tt.errMsg)
+		})
+	}
+}
+
+func checkExplainStatus(t *testing.T, params ExplainStatusParams, kind, state string, want []string, errMsg string) {
+	t.Helper()
+	out, err := explainStatusHandler(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errMsg != "" {
+		if !strings.HasPrefix(out, errMsg) {
+			t.Fatalf("got %q, want prefix %q", out, errMsg)
+		}
+		return
+	}
+	var result explainOutput
+	if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("%v in:\n%s", err, out)
+	}
+	if result.Kind != kind || result.State != state {
+		t.Errorf("kind %s state %s, want %s %s", result.Kind, result.State, kind, state)
+	}
+	var got []string
+	for _, c := range result.Conditions {
+		line := c.Type + "/" + c.Reason
+		if c.Explanation == "" {
+			t.Errorf("%s has no explanation", line)
+		}
+		if len(c.NextSteps) > 0 {
+			line += " next steps"
+		}
+		got = append(got, line)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("conditions = %q, want %q\n%s", got, want, out)
+	}
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSuffix(text, "\n"), "\n", "\n"+prefix) + "\n"
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// guardrailsFile is one YAML file of organisation rules passed with -guardrails
+type guardrailsFile struct {
+	Rules []guardrailRule `yaml:"rules"`
+}
+
+// guardrailRule is a CEL check every matching manifest must pass
+type guardrailRule struct {
+	Name string `yaml:"name"`
+	// Kinds limits the rule to these manifest kinds, empty matches all
+	Kinds []string `yaml:"kinds"`
+	// Match, if set, is a CEL expression selecting the manifests the rule
+	// applies to, e.g. by namespace
+	Match string `yaml:"match"`
+	// Expression is a CEL expression that must be true for the manifest,
+	// which is available as object
+	Expression string `yaml:"expression"`
+	// Message explains a violation to the caller
+	Message string `yaml:"message"`
+
+	match      cel.Program
+	expression cel.Program
+}
+
+// guardrailSet holds the loaded rules. The zero value has no rules and
+// allows everything.
+type guardrailSet struct {
+	rules []guardrailRule
+}
+
+var guardrails = &guardrailSet{}
+
+// guardrailViolation is a rule a manifest failed
+type guardrailViolation struct {
+	Rule      string `json:"rule"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Message   string `json:"message"`
+}
+
+// guardrailError is returned by tools whose manifest violates guardrails.
+// textTool reports it as a tool error with the violations as structured
+// content.
+type guardrailError struct {
+	Violations []guardrailViolation `json:"violations"`
+}
+
+func (e *guardrailError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "manifest violates %d organisation guardrail(s):", len(e.Violations))
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n- %s: %s", v.Rule, v.Message)
+	}
+	return b.String()
+}
+
+// loadGuardrails reads rules from a YAML file, or from every .yaml and
+// .yml file in a directory, and compiles their expressions
+func loadGuardrails(path string) (*guardrailSet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+		slices.Sort(files)
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.CrossTypeNumericComparisons(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &guardrailSet{}
+	names := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var parsed guardrailsFile
+		if err := yaml.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		for i, rule := range parsed.Rules {
+			if rule.Name == "" {
+				return nil, fmt.Errorf("%s: rules[%d]: name is required", file, i)
+			}
+			if other, ok := names[rule.Name]; ok {
+				return nil, fmt.Errorf("%s: rule %q is already defined in %s", file, rule.Name, other)
+			}
+			names[rule.Name] = file
+
+			if rule.Expression == "" {
+				return nil, fmt.Errorf("%s: rule %q: expression is required", file, rule.Name)
+			}
+			if rule.expression, err = compileRule(env, rule.Expression); err != nil {
+				return nil, fmt.Errorf("%s: rule %q: expression: %w", file, rule.Name, err)
+			}
+			if rule.Match != "" {
+				if rule.match, err = compileRule(env, rule.Match); err != nil {
+					return nil, fmt.Errorf("%s: rule %q: match: %w", file, rule.Name, err)
+				}
+			}
+			if rule.Message == "" {
+				rule.Message = "failed " + rule.Expression
+			}
+			set.rules = append(set.rules, rule)
+		}
+	}
+	return set, nil
+}
+
+// compileRule compiles a CEL expression that must evaluate to a bool
+func compileRule(env *cel.Env, expr string) (cel.Program, error) {
+	ast, issues := env.Compile(expr)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("must evaluate to a bool, not %s", ast.OutputType())
+	}
+	return env.Program(ast)
+}
+
+// check evaluates every rule matching the manifest, returning a
+// *guardrailError listing the ones it fails. A rule that can't be
+// evaluated, e.g. because it reads a field the manifest lacks, counts as
+// failed.
+func (g *guardrailSet) check(ctx context.Context, manifest map[string]interface{}) (err error) {
+	if len(g.rules) == 0 {
+		return nil
+	}
+
+	kind, _ := manifest["kind"].(string)
+	_, span := tracer.Start(ctx, "manifest.guardrails", trace.WithAttributes(attribute.String("k8s.resource.kind", kind)))
+	defer func() { endSpan(span, err) }()
+
+	// evaluate the manifest as it will be rendered, with plain JSON types
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	vars := map[string]interface{}{"object": object}
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+
+	var violations []guardrailViolation
+	for _, rule := range g.rules {
+		if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, kind) {
+			continue
+		}
+		if rule.match != nil {
+			// a match that can't be evaluated applies the rule
+			if matched, err := evalRule(rule.match, vars); err == nil && !matched {
+				continue
+			}
+		}
+
+		message := rule.Message
+		ok, err := evalRule(rule.expression, vars)
+		if err != nil {
+			message = fmt.Sprintf("%s (could not evaluate: %v)", message, err)
+		}
+		if !ok {
+			violations = append(violations, guardrailViolation{Rule: rule.Name, Kind: kind, Name: name, Namespace: namespace, Message: message})
+			metrics.guardrailViolations.inc(rule.Name)
+		}
+	}
+	if len(violations) > 0 {
+		span.SetAttributes(attribute.Int("guardrails.violations", len(violations)))
+		return &guardrailError{Violations: violations}
+	}
+	return nil
+}
+
+func evalRule(prg cel.Program, vars map[string]interface{}) (bool, error) {
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := out.Value().(bool)
+	if !isBool {
+		return false, fmt.Errorf("evaluated to %v, not a bool", out.Value())
+	}
+	return ok, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const testGuardrails = `rules:
+  - name: team-label
+    expression: "has(object.metadata.labels) && 'team' in object.metadata.labels"
+    message: every object needs a team label
+  - name: example-hostnames
+    kinds: [HTTPRoute]
+    match: "object.metadata.namespace == 'shop'"
+    expression: "object.spec.hostnames.all(h, h.endsWith('.example.com'))"
+  - name: gateway-class
+    kinds: [Gateway]
+    expression: "object.spec.gatewayClassName == 'istio'"
+`
+
+// useGuardrails loads rules from content as the server's guardrails
+// until the test ends
+func useGuardrails(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "guardrails.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := loadGuardrails(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := guardrails
+	guardrails = set
+	t.Cleanup(func() { guardrails = previous })
+}
+
+func TestLoadGuardrails(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		rules  []string
+		errMsg string
+	}{
+		{
+			name:  "file",
+			files: map[string]string{"a.yaml": testGuardrails},
+			rules: []string{"team-label", "example-hostnames", "gateway-class"},
+		},
+		{
+			name: "directory in name order",
+			files: map[string]string{
+				"b.yml":     "rules:\n  - name: second\n    expression: 'true'\n",
+				"a.yaml":    "rules:\n  - name: first\n    expression: 'true'\n",
+				"notes.txt": "rules:\n  - name: ignored\n",
+			},
+			rules: []string{"first", "second"},
+		},
+		{
+			name:   "no name",
+			files:  map[string]string{"a.yaml": "rules:\n  - expression: 'true'\n"},
+			errMsg: "rules[0]: name is required",
+		},
+		{
+			name: "duplicate name",
+			files: map[string]string{
+				"a.yaml": "rules:\n  - name: same\n    expression: 'true'\n",
+				"b.yaml": "rules:\n  - name: same\n    expression: 'false'\n",
+			},
+			errMsg: `rule "same" is already defined in`,
+		},
+		{
+			name:   "no expression",
+			files:  map[string]string{"a.yaml": "rules:\n  - name: empty\n"},
+			errMsg: `rule "empty": expression is required`,
+		},
+		{
+			name:   "not a bool",
+			files:  map[string]string{"a.yaml": "rules:\n  - name: count\n    expression: '1 + 1'\n"},
+			errMsg: `rule "count": expression: must evaluate to a bool, not int`,
+		},
+		{
+			name:   "invalid match",
+			files:  map[string]string{"a.yaml": "rules:\n  - name: broken\n    match: 'object.'\n    expression: 'true'\n"},
+			errMsg: `rule "broken": match: `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := dir
+			if len(tt.files) == 1 {
+				path = filepath.Join(dir, "a.yaml")
+			}
+			set, err := loadGuardrails(path)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rules []string
+			for _, rule := range set.rules {
+				rules = append(rules, rule.Name)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("rules = %v, want %v", rules, tt.rules)
+			}
+		})
+	}
+}
+
+func TestGuardrailCheck(t *testing.T) {
+	useGuardrails(t, testGuardrails)
+	route := func(namespace string, labels map[string]interface{}, hostnames ...interface{}) map[string]interface{} {
+		metadata := map[string]interface{}{"name": "store", "namespace": namespace}
+		if labels != nil {
+			metadata["labels"] = labels
+		}
+		return map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "HTTPRoute",
+			"metadata":   metadata,
+			"spec":       map[string]interface{}{"hostnames": hostnames},
+		}
+	}
+	team := map[string]interface{}{"team": "shop"}
+
+	tests := []struct {
+		name     string
+		manifest map[string]interface{}
+		// violations lists the failed rules, with the message of the last
+		violations []string
+		message    string
+	}{
+		{
+			name:     "passes",
+			manifest: route("shop", team, "api.example.com"),
+		},
+		{
+			name:       "missing label",
+			manifest:   route("shop", nil, "api.example.com"),
+			violations: []string{"team-label"},
+			message:    "every object needs a team label",
+		},
+		{
+			name:       "default message",
+			manifest:   route("shop", team, "api.example.org"),
+			violations: []string{"example-hostnames"},
+			message:    "failed object.spec.hostnames.all(h, h.endsWith('.example.com'))",
+		},
+		{
+			name:     "not matched",
+			manifest: route("other", team, "api.example.org"),
+		},
+		{
+			name: "field missing",
+			manifest: map[string]interface{}{
+				"kind":     "Gateway",
+				"metadata": map[string]interface{}{"name": "external", "labels": team},
+			},
+			violations: []string{"gateway-class"},
+			message:    "failed object.spec.gatewayClassName == 'istio' (could not evaluate: no such key: spec)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := guardrails.check(context.Background(), tt.manifest)
+			if tt.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			var ge *guardrailError
+			if !errors.As(err, &ge) {
+				t.Fatalf("error %v, want a guardrailError", err)
+			}
+			var rules []string
+			for _, v := range ge.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.violations) {
+				t.Errorf("violations = %v, want %v", rules, tt.violations)
+			}
+			if last := ge.Violations[len(ge.Violations)-1]; last.Message != tt.message {
+				t.Errorf("message = %q, want %q", last.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestGuardrailToolError(t *testing.T) {
+	useGuardrails(t, testGuardrails)
+	handler := textTool(createGatewayHandler)
+
+	result, _, err := handler(context.Background(), nil, CreateGatewayParams{Name: "external", Namespace: "gateways", GatewayClassName: "envoy-gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatalf("want a tool error, got %+v", result)
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	if !strings.HasPrefix(text, "Error: manifest violates 2 organisation guardrail(s):\n- team-label: ") {
+		t.Errorf("text = %q", text)
+	}
+	violations, ok := result.StructuredContent.(*guardrailError)
+	if !ok || len(violations.Violations) != 2 || violations.Violations[1].Name != "external" || violations.Violations[1].Namespace != "gateways" {
+		t.Errorf("structured content = %+v", result.StructuredContent)
+	}
+
+	result, _, err = handler(context.Background(), nil, CreateGatewayParams{Name: "external", Namespace: "gateways", GatewayClassName: "istio", Labels: map[string]string{"team": "platform"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Errorf("unexpected tool error %+v", result.Content[0])
+	}
+}
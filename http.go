@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// httpOptions configures how the SSE and StreamableHTTP transports are served
+type httpOptions struct {
+	addr        string
+	auth        authConfig
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string // clients must present a certificate signed by this CA
+
+	// admin, if set, serves /healthz, /readyz and /metrics alongside the
+	// MCP endpoint, without authentication so probes and scrapers can reach it
+	admin http.Handler
+
+	// shutdownTimeout bounds how long in-flight requests get to finish
+	shutdownTimeout time.Duration
+
+	// tenants, if set, routes authenticated requests to their tenant's server
+	tenants *tenantRouter
+}
+
+// serveHTTP serves an MCP transport handler behind the configured
+// authentication, over TLS when a certificate is set, until ctx is cancelled
+func serveHTTP(ctx context.Context, opts httpOptions, handler http.Handler) error {
+	if opts.auth.mode == authMTLS && opts.auth.clientCA == "" {
+		opts.auth.clientCA = opts.tlsClientCA
+	}
+
+	// tenants are resolved after authentication, which establishes identity
+	if opts.tenants != nil {
+		handler = opts.tenants.middleware(handler)
+	}
+
+	mux := http.NewServeMux()
+	if opts.admin != nil {
+		for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+			mux.Handle(path, opts.admin)
+		}
+	}
+	if err := opts.auth.install(mux, handler); err != nil {
+		return err
+	}
+	if opts.auth.mode == "" || opts.auth.mode == authNone {
+		slog.Warn("No authentication configured, anyone who can reach the server can use it", "addr", opts.addr)
+	}
+
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	srv := &http.Server{Addr: opts.addr, Handler: mux}
+	if opts.tlsCert == "" {
+		if opts.tlsClientCA != "" || opts.auth.mode == authMTLS {
+			return fmt.Errorf("client certificates require -tls-cert and -tls-key")
+		}
+		return runHTTPServer(ctx, srv, opts, srv.ListenAndServe)
+	}
+
+	// -tls-client-ca rejects clients without a certificate during the
+	// handshake. -auth mtls on its own only verifies certificates that are
+	// offered, so clients without one get an HTTP 401 instead of a TLS alert.
+	caFile, clientAuth := opts.tlsClientCA, tls.RequireAndVerifyClientCert
+	switch {
+	case caFile == "" && opts.auth.mode == authMTLS:
+		caFile, clientAuth = opts.auth.clientCA, tls.VerifyClientCertIfGiven
+	case caFile == "":
+		clientAuth = tls.NoClientCert
+	case opts.auth.mode == authMTLS && opts.auth.clientCA != caFile:
+		return fmt.Errorf("-auth-client-ca and -tls-client-ca must match when both are set")
+	}
+
+	certs, err := newCertReloader(opts.tlsCert, opts.tlsKey, caFile, clientAuth)
+	if err != nil {
+		return err
+	}
+	go certs.watch(ctx, 30*time.Second)
+
+	srv.TLSConfig = certs.tlsConfig()
+	slog.Info("Serving TLS", "cert", opts.tlsCert)
+	return runHTTPServer(ctx, srv, opts, func() error {
+		return srv.ListenAndServeTLS("", "")
+	})
+}
+
+// runHTTPServer runs listen until it fails or ctx is cancelled, then drains
+// the server: new connections are refused, in-flight requests get up to
+// the shutdown timeout to finish, and sessions are closed so SSE streams
+// end. Whatever is left when the timeout expires is cut off.
+func runHTTPServer(ctx context.Context, srv *http.Server, opts httpOptions, listen func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listen()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Draining HTTP sessions", "timeout", opts.shutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), opts.shutdownTimeout)
+	defer cancel()
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(drainCtx)
+	}()
+	if err := activeRequests.wait(drainCtx); err != nil {
+		slog.Warn("Shutdown timeout reached with requests still in flight")
+	}
+	servers.closeSessions()
+
+	if err := <-shutdown; err != nil {
+		slog.Warn("Closing remaining HTTP connections", "error", err)
+		srv.Close()
+	}
+	return nil
+}
+
+// serverReady reports the server ready once prefetched docs are cached, so
+// traffic doesn't wait on GitHub, and not ready once ctx is done, so no new
+// clients are routed to a draining server
+func serverReady(ctx context.Context, prefetch bool, c *docCache) func() error {
+	return func() error {
+		if ctx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		if prefetch && !c.warmed.Load() {
+			return errors.New("docs cache is warming")
+		}
+		return nil
+	}
+}
+
+// newAdminHandler serves the endpoints used by Kubernetes probes and
+// Prometheus. ready reports why the server can't take traffic yet, if so.
+func newAdminHandler(ready func() error) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/metrics", metrics)
+	return mux
+}
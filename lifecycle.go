@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// requestTracker counts the MCP requests being handled so shutdown can let
+// them finish before closing sessions
+type requestTracker struct {
+	active atomic.Int64
+}
+
+var activeRequests = &requestTracker{}
+
+func (t *requestTracker) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		t.active.Add(1)
+		defer t.active.Add(-1)
+		return next(ctx, method, req)
+	}
+}
+
+// wait blocks until no requests are being handled or ctx is done
+func (t *requestTracker) wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for t.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// serverRegistry tracks every server instance, one per tenant, so metrics
+// and shutdown cover all of their sessions
+type serverRegistry struct {
+	mu      sync.Mutex
+	servers []*mcp.Server
+}
+
+var servers = &serverRegistry{}
+
+func (r *serverRegistry) add(server *mcp.Server) {
+	r.mu.Lock()
+	r.servers = append(r.servers, server)
+	r.mu.Unlock()
+}
+
+func (r *serverRegistry) all() []*mcp.Server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.servers)
+}
+
+// sessionCount returns the number of connected sessions across all servers
+func (r *serverRegistry) sessionCount() int {
+	n := 0
+	for _, server := range r.all() {
+		for range server.Sessions() {
+			n++
+		}
+	}
+	return n
+}
+
+// closeSessions disconnects every client, ending their streams
+func (r *serverRegistry) closeSessions() {
+	for _, server := range r.all() {
+		for session := range server.Sessions() {
+			session.Close()
+		}
+	}
+}
+
+// serveStdio runs server over stdin/stdout until the client disconnects or
+// ctx is cancelled, in which case requests already being handled get up to
+// timeout to finish
+func serveStdio(ctx context.Context, server *mcp.Server, timeout time.Duration) error {
+	return serveTransport(ctx, server, &mcp.StdioTransport{}, timeout)
+}
+
+// serveTransport runs server over a single transport, draining like
+// serveStdio
+func serveTransport(ctx context.Context, server *mcp.Server, transport mcp.Transport, timeout time.Duration) error {
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-runCtx.Done():
+			return
+		}
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), timeout)
+		defer drainCancel()
+		activeRequests.wait(drainCtx)
+		cancel()
+	}()
+
+	err := server.Run(runCtx, transport)
+	if ctx.Err() != nil {
+		// stopped by a signal rather than failing
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newSlowServer returns a server whose "slow" tool blocks until release is
+// closed, with its requests tracked by the global activeRequests, which is
+// replaced for the test
+func newSlowServer(t *testing.T) (*mcp.Server, chan struct{}) {
+	t.Helper()
+	old := activeRequests
+	activeRequests = &requestTracker{}
+	t.Cleanup(func() { activeRequests = old })
+
+	release := make(chan struct{})
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "slow"}, func(context.Context, *mcp.CallToolRequest, struct{}) (*mcp.CallToolResult, any, error) {
+		<-release
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	server.AddReceivingMiddleware(activeRequests.middleware)
+	return server, release
+}
+
+// callSlow calls the slow tool in the background, sending its text result,
+// or the error, once it returns
+func callSlow(session *mcp.ClientSession) <-chan string {
+	result := make(chan string, 1)
+	go func() {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "slow"})
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		result <- res.Content[0].(*mcp.TextContent).Text
+	}()
+	return result
+}
+
+func TestRequestTracker(t *testing.T) {
+	tracker := &requestTracker{}
+	release := make(chan struct{})
+	handler := tracker.middleware(func(context.Context, string, mcp.Request) (mcp.Result, error) {
+		<-release
+		return nil, nil
+	})
+	done := make(chan struct{})
+	go func() {
+		handler(context.Background(), "tools/call", nil)
+		close(done)
+	}()
+	waitFor(t, func() bool { return tracker.active.Load() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	if err := tracker.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait with a request in flight returned %v", err)
+	}
+
+	close(release)
+	<-done
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Errorf("wait with no requests in flight returned %v", err)
+	}
+}
+
+func TestServerRegistry(t *testing.T) {
+	registry := &serverRegistry{}
+	var sessions []*mcp.ClientSession
+	for range 2 {
+		server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, nil)
+		registry.add(server)
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		if _, err := server.Connect(context.Background(), serverTransport, nil); err != nil {
+			t.Fatal(err)
+		}
+		session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), clientTransport, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+	if n := registry.sessionCount(); n != 2 {
+		t.Errorf("got %d sessions, want 2", n)
+	}
+
+	registry.closeSessions()
+	for _, session := range sessions {
+		done := make(chan struct{})
+		go func() {
+			session.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("client session still open after closeSessions")
+		}
+	}
+	waitFor(t, func() bool { return registry.sessionCount() == 0 })
+}
+
+func TestServeTransportDrains(t *testing.T) {
+	server, release := newSlowServer(t)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- serveTransport(ctx, server, serverTransport, time.Second)
+	}()
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	result := callSlow(session)
+	waitFor(t, func() bool { return activeRequests.active.Load() == 1 })
+	// a signal arrives with the call still running
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-served:
+		t.Fatalf("stopped serving with a request in flight: %v", err)
+	default:
+	}
+
+	close(release)
+	select {
+	case text := <-result:
+		if text != "done" {
+			t.Errorf("in-flight call returned %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight call didn't complete")
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serveTransport returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still serving after draining")
+	}
+}
+
+func TestRunHTTPServerDrains(t *testing.T) {
+	server, release := newSlowServer(t)
+	old := servers
+	servers = &serverRegistry{}
+	t.Cleanup(func() { servers = old })
+	servers.add(server)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- runHTTPServer(ctx, srv, httpOptions{shutdownTimeout: time.Second}, func() error {
+			return srv.Serve(ln)
+		})
+	}()
+
+	transport := &mcp.StreamableClientTransport{Endpoint: "http://" + ln.Addr().String()}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), transport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	result := callSlow(session)
+	waitFor(t, func() bool { return activeRequests.active.Load() == 1 })
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// new connections are refused while the call finishes
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Error("a new connection was accepted while draining")
+	}
+	close(release)
+	select {
+	case text := <-result:
+		if text != "done" {
+			t.Errorf("in-flight call returned %q", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight call didn't complete")
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("runHTTPServer returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("still serving after draining")
+	}
+}
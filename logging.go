@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// setupLogging installs the default slog logger. Everything is written to
+// stderr, since stdout carries the stdio transport.
+func setupLogging(w io.Writer, format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type logAttrsKey struct{}
+
+// withLogAttrs returns a context whose log lines carry attrs, in addition to
+// any already attached
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// contextHandler adds the attributes attached with withLogAttrs to every
+// record logged with a context, e.g. slog.InfoContext
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// loggingMiddleware gives every MCP request an ID, attaches it and the
+// session ID to the request context so handlers' log lines can be
+// correlated, and logs the outcome of the request
+func loggingMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		attrs := []slog.Attr{slog.String("request_id", newRequestID())}
+		if session := req.GetSession(); session != nil && session.ID() != "" {
+			attrs = append(attrs, slog.String("session_id", session.ID()))
+		}
+		attrs = append(attrs, traceLogAttrs(ctx)...)
+		ctx = withLogAttrs(ctx, attrs...)
+
+		start := time.Now()
+		result, err := next(ctx, method, req)
+
+		args := []any{"method", method}
+		switch params := req.GetParams().(type) {
+		case *mcp.CallToolParamsRaw:
+			args = append(args, "tool", params.Name, "outcome", toolOutcome(result, err))
+		case *mcp.ReadResourceParams:
+			args = append(args, "uri", params.URI)
+		case *mcp.SubscribeParams:
+			args = append(args, "uri", params.URI)
+		case *mcp.UnsubscribeParams:
+			args = append(args, "uri", params.URI)
+		}
+		args = append(args, "duration_ms", float64(time.Since(start).Microseconds())/1000)
+
+		level := slog.LevelInfo
+		if method == "ping" || strings.HasPrefix(method, "notifications/") {
+			level = slog.LevelDebug
+		}
+		if err != nil {
+			level = slog.LevelWarn
+			args = append(args, "error", err)
+		}
+		slog.Log(ctx, level, "Handled MCP request", args...)
+		return result, err
+	}
+}
+
+// tenantLogMiddleware adds the tenant a server instance belongs to to the
+// log lines of its requests
+func tenantLogMiddleware(tenant string) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			return next(withLogAttrs(ctx, slog.String("tenant", tenant)), method, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// logBuffer collects log output written from several goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the JSON log lines written so far
+func (b *logBuffer) records(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// useJSONLogs sends the default logger's output, as JSON, to the returned
+// buffer for the duration of the test
+func useJSONLogs(t *testing.T, level string) *logBuffer {
+	t.Helper()
+	old := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(old) })
+	buf := &logBuffer{}
+	if err := setupLogging(buf, "json", level); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestSetupLogging(t *testing.T) {
+	tests := []struct {
+		name          string
+		format, level string
+		errMsg        string
+	}{
+		{name: "json", format: "json", level: "info"},
+		{name: "text", format: "text", level: "debug"},
+		{name: "unknown format", format: "xml", level: "info", errMsg: `invalid log format "xml" (want text or json)`},
+		{name: "unknown level", format: "json", level: "verbose", errMsg: `invalid log level "verbose" (want debug, info, warn or error)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := slog.Default()
+			t.Cleanup(func() { slog.SetDefault(old) })
+			err := setupLogging(&bytes.Buffer{}, tt.format, tt.level)
+			if tt.errMsg == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" && (err == nil || err.Error() != tt.errMsg) {
+				t.Errorf("error %v, want %s", err, tt.errMsg)
+			}
+		})
+	}
+
+	buf := useJSONLogs(t, "warn")
+	slog.Info("dropped")
+	slog.Warn("kept")
+	records := buf.records(t)
+	if len(records) != 1 || records[0]["msg"] != "kept" || records[0]["level"] != "WARN" {
+		t.Errorf("got %v, want only the warning", records)
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	buf := useJSONLogs(t, "info")
+	ctx := withLogAttrs(context.Background(), slog.String("request_id", "r1"))
+	ctx = withLogAttrs(ctx, slog.String("tenant", "team-a"))
+	// attaching to a derived context leaves the parent's attributes alone
+	withLogAttrs(ctx, slog.String("session_id", "s1"))
+
+	slog.With("component", "cache").InfoContext(ctx, "fetched")
+	slog.Info("no context")
+
+	records := buf.records(t)
+	if len(records) != 2 {
+		t.Fatalf("got %d records", len(records))
+	}
+	got := records[0]
+	if got["request_id"] != "r1" || got["tenant"] != "team-a" || got["component"] != "cache" {
+		t.Errorf("got %v", got)
+	}
+	if _, ok := got["session_id"]; ok {
+		t.Error("a derived context's attribute was logged")
+	}
+	if _, ok := records[1]["request_id"]; ok {
+		t.Error("a record without a context has a request_id")
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	buf := useJSONLogs(t, "info")
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "lookup"}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		slog.InfoContext(ctx, "Looking up gateway")
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Error: no gateway named api"}}}, nil, nil
+	})
+	server.AddReceivingMiddleware(tenantLogMiddleware("team-a"), loggingMiddleware)
+	ts := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	defer ts.Close()
+
+	ctx := context.Background()
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, &mcp.StreamableClientTransport{Endpoint: ts.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "lookup"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var inTool, handled map[string]any
+	requestIDs := map[any]bool{}
+	for _, r := range buf.records(t) {
+		if r["msg"] == "Handled MCP request" {
+			requestIDs[r["request_id"]] = true
+		}
+		switch {
+		case r["msg"] == "Looking up gateway":
+			inTool = r
+		case r["msg"] == "Handled MCP request" && r["method"] == "tools/call":
+			handled = r
+		}
+	}
+	if inTool == nil || handled == nil {
+		t.Fatalf("missing log lines in %v", buf.records(t))
+	}
+	for _, r := range []map[string]any{inTool, handled} {
+		if r["session_id"] != session.ID() {
+			t.Errorf("%s: session_id = %v, want %s", r["msg"], r["session_id"], session.ID())
+		}
+		if r["tenant"] != "team-a" {
+			t.Errorf("%s: tenant = %v", r["msg"], r["tenant"])
+		}
+	}
+	if id, _ := inTool["request_id"].(string); id == "" || id != handled["request_id"] {
+		t.Errorf("request_id %v in the tool, %v when handled", inTool["request_id"], handled["request_id"])
+	}
+	if handled["tool"] != "lookup" || handled["outcome"] != "error" || handled["level"] != "INFO" {
+		t.Errorf("got %v", handled)
+	}
+	// initialize, and tools/call at least, each get their own ID
+	if len(requestIDs) < 2 {
+		t.Errorf("request IDs %v aren't unique per request", requestIDs)
+	}
+}
@@ -2,107 +2,125 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
+const serverVersion = "1.0.0"
+
 // Input parameter types for tools
 type CreateGatewayParams struct {
-	Name             string                   `json:"name" jsonschema:"required,description=Name of the Gateway resource"`
-	Namespace        string                   `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the Gateway"`
-	GatewayClassName string                   `json:"gatewayClassName,omitempty" jsonschema:"description=Gateway implementation to use (default: istio)"`
-	Listeners        []map[string]interface{} `json:"listeners,omitempty" jsonschema:"description=Gateway listeners configuration"`
-	KuadrantEnabled  bool                     `json:"kuadrantEnabled,omitempty" jsonschema:"description=Enable Kuadrant policy attachment (default: true)"`
+	Name             string                   `json:"name" jsonschema:"Name of the Gateway resource"`
+	Namespace        string                   `json:"namespace" jsonschema:"Kubernetes namespace for the Gateway"`
+	Labels           map[string]string        `json:"labels,omitempty" jsonschema:"Labels to add to the Gateway"`
+	Annotations      map[string]string        `json:"annotations,omitempty" jsonschema:"Annotations to add to the Gateway"`
+	GatewayClassName string                   `json:"gatewayClassName,omitempty" jsonschema:"Gateway implementation to use"`
+	Listeners        []map[string]interface{} `json:"listeners,omitempty" jsonschema:"Gateway listeners configuration"`
+	KuadrantEnabled  bool                     `json:"kuadrantEnabled,omitempty" jsonschema:"Enable Kuadrant policy attachment (default: true)"`
 }
 
 type CreateHTTPRouteParams struct {
-	Name       string                   `json:"name" jsonschema:"required,description=Name of the HTTPRoute resource"`
-	Namespace  string                   `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the HTTPRoute"`
-	ParentRefs []interface{}            `json:"parentRefs" jsonschema:"required,description=References to Gateway resources"`
-	Hostnames  []interface{}            `json:"hostnames,omitempty" jsonschema:"description=Hostnames this route handles"`
-	Rules      []interface{}            `json:"rules,omitempty" jsonschema:"description=Routing rules configuration"`
+	Name        string            `json:"name" jsonschema:"Name of the HTTPRoute resource"`
+	Namespace   string            `json:"namespace" jsonschema:"Kubernetes namespace for the HTTPRoute"`
+	Labels      map[string]string `json:"labels,omitempty" jsonschema:"Labels to add to the HTTPRoute"`
+	Annotations map[string]string `json:"annotations,omitempty" jsonschema:"Annotations to add to the HTTPRoute"`
+	ParentRefs  []interface{}     `json:"parentRefs" jsonschema:"References to Gateway resources"`
+	Hostnames   []interface{}     `json:"hostnames,omitempty" jsonschema:"Hostnames this route handles"`
+	Rules       []interface{}     `json:"rules,omitempty" jsonschema:"Routing rules configuration"`
 }
 
 type CreateDNSPolicyParams struct {
-	Name           string                 `json:"name" jsonschema:"required,description=Name of the DNSPolicy resource"`
-	Namespace      string                 `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the DNSPolicy"`
-	TargetRef      map[string]interface{} `json:"targetRef" jsonschema:"required,description=Reference to the target Gateway"`
-	ProviderRefs   []interface{}          `json:"providerRefs,omitempty" jsonschema:"description=DNS provider configurations"`
-	ProviderRef    map[string]interface{} `json:"providerRef,omitempty" jsonschema:"description=Legacy single provider reference"`
-	LoadBalancing  map[string]interface{} `json:"loadBalancing,omitempty" jsonschema:"description=Load balancing configuration"`
-	HealthCheck    map[string]interface{} `json:"healthCheck,omitempty" jsonschema:"description=Health check configuration"`
+	Name            string                 `json:"name" jsonschema:"Name of the DNSPolicy resource"`
+	Namespace       string                 `json:"namespace" jsonschema:"Kubernetes namespace for the DNSPolicy"`
+	Labels          map[string]string      `json:"labels,omitempty" jsonschema:"Labels to add to the DNSPolicy"`
+	Annotations     map[string]string      `json:"annotations,omitempty" jsonschema:"Annotations to add to the DNSPolicy"`
+	TargetRef       map[string]interface{} `json:"targetRef" jsonschema:"Reference to the target Gateway"`
+	ProviderRefs    []interface{}          `json:"providerRefs,omitempty" jsonschema:"DNS provider configurations"`
+	ProviderRef     map[string]interface{} `json:"providerRef,omitempty" jsonschema:"Legacy single provider reference"`
+	LoadBalancing   map[string]interface{} `json:"loadBalancing,omitempty" jsonschema:"Load balancing configuration"`
+	HealthCheck     map[string]interface{} `json:"healthCheck,omitempty" jsonschema:"Health check configuration"`
+	KuadrantVersion string                 `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release to target (e.g. v1.2); selects API version and supported fields (default: latest)"`
 }
 
 type CreateTLSPolicyParams struct {
-	Name        string                 `json:"name" jsonschema:"required,description=Name of the TLSPolicy resource"`
-	Namespace   string                 `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the TLSPolicy"`
-	TargetRef   map[string]interface{} `json:"targetRef" jsonschema:"required,description=Reference to the target Gateway"`
-	IssuerRef   map[string]interface{} `json:"issuerRef" jsonschema:"required,description=Reference to the cert-manager issuer"`
-	CommonName  string                 `json:"commonName,omitempty" jsonschema:"description=Common name for the certificate"`
-	Duration    string                 `json:"duration,omitempty" jsonschema:"description=Certificate duration (e.g. 90d)"`
-	RenewBefore string                 `json:"renewBefore,omitempty" jsonschema:"description=When to renew before expiry (e.g. 30d)"`
+	Name            string                 `json:"name" jsonschema:"Name of the TLSPolicy resource"`
+	Namespace       string                 `json:"namespace" jsonschema:"Kubernetes namespace for the TLSPolicy"`
+	Labels          map[string]string      `json:"labels,omitempty" jsonschema:"Labels to add to the TLSPolicy"`
+	Annotations     map[string]string      `json:"annotations,omitempty" jsonschema:"Annotations to add to the TLSPolicy"`
+	TargetRef       map[string]interface{} `json:"targetRef" jsonschema:"Reference to the target Gateway"`
+	IssuerRef       map[string]interface{} `json:"issuerRef" jsonschema:"Reference to the cert-manager issuer"`
+	CommonName      string                 `json:"commonName,omitempty" jsonschema:"Common name for the certificate"`
+	Duration        string                 `json:"duration,omitempty" jsonschema:"Certificate duration (e.g. 90d)"`
+	RenewBefore     string                 `json:"renewBefore,omitempty" jsonschema:"When to renew before expiry (e.g. 30d)"`
+	KuadrantVersion string                 `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release to target (e.g. v1.2); selects API version and supported fields (default: latest)"`
 }
 
 // RateLimit represents a single rate limit configuration
 type RateLimit struct {
-	Limit  int    `json:"limit" jsonschema:"required,description=Number of requests allowed"`
-	Window string `json:"window" jsonschema:"required,description=Time window (e.g. 10s, 5m, 1h)"`
+	Limit  int    `json:"limit" jsonschema:"Number of requests allowed"`
+	Window string `json:"window" jsonschema:"Time window (e.g. 10s, 5m, 1h)"`
 }
 
 // LimitDefinition represents a named limit with rates and optional conditions
 type LimitDefinition struct {
-	Rates []RateLimit              `json:"rates" jsonschema:"required,description=Array of rate limit rules"`
-	When  []map[string]interface{} `json:"when,omitempty" jsonschema:"description=Optional conditions for applying this limit"`
+	Rates []RateLimit              `json:"rates" jsonschema:"Array of rate limit rules"`
+	When  []map[string]interface{} `json:"when,omitempty" jsonschema:"Optional conditions for applying this limit"`
+	// Counters split the limit into one counter per distinct value
+	Counters []map[string]interface{} `json:"counters,omitempty" jsonschema:"Optional expressions whose values each get their own counter (e.g. {expression: auth.identity.userid}, or {selector: ...} before Kuadrant v1.0)"`
 }
 
 type CreateRateLimitPolicyParams struct {
-	Name      string                         `json:"name" jsonschema:"required,description=Name of the RateLimitPolicy resource"`
-	Namespace string                         `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the RateLimitPolicy"`
-	TargetRef map[string]interface{}         `json:"targetRef" jsonschema:"required,description=Reference to the target Gateway or HTTPRoute"`
-	Limits    map[string]LimitDefinition     `json:"limits,omitempty" jsonschema:"description=Named rate limit configurations"`
-	Defaults  map[string]interface{}         `json:"defaults,omitempty" jsonschema:"description=Default rate limit rules"`
-	Overrides map[string]interface{}         `json:"overrides,omitempty" jsonschema:"description=Override rate limit rules"`
+	Name            string                     `json:"name" jsonschema:"Name of the RateLimitPolicy resource"`
+	Namespace       string                     `json:"namespace" jsonschema:"Kubernetes namespace for the RateLimitPolicy"`
+	Labels          map[string]string          `json:"labels,omitempty" jsonschema:"Labels to add to the RateLimitPolicy"`
+	Annotations     map[string]string          `json:"annotations,omitempty" jsonschema:"Annotations to add to the RateLimitPolicy"`
+	TargetRef       map[string]interface{}     `json:"targetRef" jsonschema:"Reference to the target Gateway or HTTPRoute"`
+	Limits          map[string]LimitDefinition `json:"limits,omitempty" jsonschema:"Named rate limit configurations"`
+	Defaults        map[string]interface{}     `json:"defaults,omitempty" jsonschema:"Default rate limit rules"`
+	Overrides       map[string]interface{}     `json:"overrides,omitempty" jsonschema:"Override rate limit rules"`
+	KuadrantVersion string                     `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release to target (e.g. v1.2); selects API version and supported fields (default: latest)"`
 }
 
 type CreateAuthPolicyParams struct {
-	Name      string                 `json:"name" jsonschema:"required,description=Name of the AuthPolicy resource"`
-	Namespace string                 `json:"namespace" jsonschema:"required,description=Kubernetes namespace for the AuthPolicy"`
-	TargetRef map[string]interface{} `json:"targetRef" jsonschema:"required,description=Reference to the target Gateway or HTTPRoute"`
-	Rules     map[string]interface{} `json:"rules,omitempty" jsonschema:"description=Authentication and authorization rules"`
-	Defaults  map[string]interface{} `json:"defaults,omitempty" jsonschema:"description=Default auth rules"`
-	Overrides map[string]interface{} `json:"overrides,omitempty" jsonschema:"description=Override auth rules"`
+	Name            string                 `json:"name" jsonschema:"Name of the AuthPolicy resource"`
+	Namespace       string                 `json:"namespace" jsonschema:"Kubernetes namespace for the AuthPolicy"`
+	Labels          map[string]string      `json:"labels,omitempty" jsonschema:"Labels to add to the AuthPolicy"`
+	Annotations     map[string]string      `json:"annotations,omitempty" jsonschema:"Annotations to add to the AuthPolicy"`
+	TargetRef       map[string]interface{} `json:"targetRef" jsonschema:"Reference to the target Gateway or HTTPRoute"`
+	Rules           map[string]interface{} `json:"rules,omitempty" jsonschema:"Authentication and authorization rules"`
+	Defaults        map[string]interface{} `json:"defaults,omitempty" jsonschema:"Default auth rules"`
+	Overrides       map[string]interface{} `json:"overrides,omitempty" jsonschema:"Override auth rules"`
+	KuadrantVersion string                 `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release to target (e.g. v1.2); selects API version and supported fields (default: latest)"`
 }
 
-// Tool handlers
+// Tool handlers. Each fills in the parameters the caller omits from the
+// tenant's defaults, or the organisation's when called directly.
 func createGatewayHandler(ctx context.Context, params CreateGatewayParams) (string, error) {
+	toolDefaultsFrom(ctx).gateway(&params)
 	name := params.Name
 	namespace := params.Namespace
 	
-	log.Printf("[KUADRANT MCP] create_gateway called with name=%s, namespace=%s", name, namespace)
+	slog.DebugContext(ctx, "Creating Gateway", "name", name, "namespace", namespace)
 	if name == "" || namespace == "" {
 		return "Error: name and namespace are required", nil
 	}
 
-	gatewayClassName := params.GatewayClassName
-	if gatewayClassName == "" {
-		gatewayClassName = "istio"
-	}
-
-	listeners := params.Listeners
-	if len(listeners) == 0 {
-		listeners = []map[string]interface{}{
-			{
-				"name":     "http",
-				"port":     80,
-				"protocol": "HTTP",
-			},
-		}
+	if params.GatewayClassName == "" || len(params.Listeners) == 0 {
+		return "Error: gatewayClassName and listeners are required", nil
 	}
 
 	kuadrantEnabled := params.KuadrantEnabled
@@ -112,27 +130,28 @@ func createGatewayHandler(ctx context.Context, params CreateGatewayParams) (stri
 		kuadrantEnabled = true
 	}
 
+	annotations := params.Annotations
+	if kuadrantEnabled {
+		annotations = mergeStrings(annotations, map[string]string{
+			"kuadrant.io/policy": "enabled",
+		})
+	}
+
 	gateway := map[string]interface{}{
 		"apiVersion": "gateway.networking.k8s.io/v1",
 		"kind":       "Gateway",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, annotations),
 		"spec": map[string]interface{}{
-			"gatewayClassName": gatewayClassName,
-			"listeners":        listeners,
+			"gatewayClassName": params.GatewayClassName,
+			"listeners":        params.Listeners,
 		},
 	}
 
-	if kuadrantEnabled {
-		metadata := gateway["metadata"].(map[string]interface{})
-		metadata["annotations"] = map[string]string{
-			"kuadrant.io/policy": "enabled",
-		}
+	if err := guardrails.check(ctx, gateway); err != nil {
+		return "", err
 	}
 
-	content, err := yaml.Marshal(gateway)
+	content, err := marshalManifest(ctx, gateway)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -141,6 +160,7 @@ func createGatewayHandler(ctx context.Context, params CreateGatewayParams) (stri
 }
 
 func createHTTPRouteHandler(ctx context.Context, params CreateHTTPRouteParams) (string, error) {
+	toolDefaultsFrom(ctx).httpRoute(&params)
 	name := params.Name
 	namespace := params.Namespace
 	if name == "" || namespace == "" {
@@ -158,10 +178,7 @@ func createHTTPRouteHandler(ctx context.Context, params CreateHTTPRouteParams) (
 	httproute := map[string]interface{}{
 		"apiVersion": "gateway.networking.k8s.io/v1",
 		"kind":       "HTTPRoute",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, params.Annotations),
 		"spec": map[string]interface{}{
 			"parentRefs": parentRefs,
 		},
@@ -175,7 +192,11 @@ func createHTTPRouteHandler(ctx context.Context, params CreateHTTPRouteParams) (
 		spec["rules"] = rules
 	}
 
-	content, err := yaml.Marshal(httproute)
+	if err := guardrails.check(ctx, httproute); err != nil {
+		return "", err
+	}
+
+	content, err := marshalManifest(ctx, httproute)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -184,6 +205,7 @@ func createHTTPRouteHandler(ctx context.Context, params CreateHTTPRouteParams) (
 }
 
 func createDNSPolicyHandler(ctx context.Context, params CreateDNSPolicyParams) (string, error) {
+	toolDefaultsFrom(ctx).dnsPolicy(&params)
 	name := params.Name
 	namespace := params.Namespace
 	targetRef := params.TargetRef
@@ -201,13 +223,15 @@ func createDNSPolicyHandler(ctx context.Context, params CreateDNSPolicyParams) (
 		targetRef["group"] = "gateway.networking.k8s.io"
 	}
 
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
 	dnsPolicy := map[string]interface{}{
-		"apiVersion": "kuadrant.io/v1",
+		"apiVersion": release.apis["DNSPolicy"].apiVersion,
 		"kind":       "DNSPolicy",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, params.Annotations),
 		"spec": map[string]interface{}{
 			"targetRef": targetRef,
 		},
@@ -232,7 +256,15 @@ func createDNSPolicyHandler(ctx context.Context, params CreateDNSPolicyParams) (
 		dnsPolicy["spec"].(map[string]interface{})["healthCheck"] = params.HealthCheck
 	}
 
-	content, err := yaml.Marshal(dnsPolicy)
+	if err := release.checkSpec(ctx, "DNSPolicy", dnsPolicy["spec"].(map[string]interface{})); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	if err := guardrails.check(ctx, dnsPolicy); err != nil {
+		return "", err
+	}
+
+	content, err := marshalManifest(ctx, dnsPolicy)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -241,6 +273,7 @@ func createDNSPolicyHandler(ctx context.Context, params CreateDNSPolicyParams) (
 }
 
 func createTLSPolicyHandler(ctx context.Context, params CreateTLSPolicyParams) (string, error) {
+	toolDefaultsFrom(ctx).tlsPolicy(&params)
 	name := params.Name
 	namespace := params.Namespace
 	targetRef := params.TargetRef
@@ -265,13 +298,15 @@ func createTLSPolicyHandler(ctx context.Context, params CreateTLSPolicyParams) (
 		issuerRef["group"] = "cert-manager.io"
 	}
 
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
 	tlsPolicy := map[string]interface{}{
-		"apiVersion": "kuadrant.io/v1alpha1", // Note: v1alpha1
+		"apiVersion": release.apis["TLSPolicy"].apiVersion,
 		"kind":       "TLSPolicy",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, params.Annotations),
 		"spec": map[string]interface{}{
 			"targetRef": targetRef,
 			"issuerRef": issuerRef,
@@ -289,7 +324,15 @@ func createTLSPolicyHandler(ctx context.Context, params CreateTLSPolicyParams) (
 		spec["renewBefore"] = params.RenewBefore
 	}
 
-	content, err := yaml.Marshal(tlsPolicy)
+	if err := release.checkSpec(ctx, "TLSPolicy", spec); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	if err := guardrails.check(ctx, tlsPolicy); err != nil {
+		return "", err
+	}
+
+	content, err := marshalManifest(ctx, tlsPolicy)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -315,7 +358,20 @@ func validateWindow(window string) error {
 	return nil
 }
 
+// renderRates returns rates in the form the release's RateLimitPolicy API expects
+func renderRates(release kuadrantRelease, rates []RateLimit) interface{} {
+	if !release.apis["RateLimitPolicy"].legacyRates {
+		return rates
+	}
+	legacy := make([]map[string]interface{}, 0, len(rates))
+	for _, rate := range rates {
+		legacy = append(legacy, legacyRate(rate))
+	}
+	return legacy
+}
+
 func createRateLimitPolicyHandler(ctx context.Context, params CreateRateLimitPolicyParams) (string, error) {
+	toolDefaultsFrom(ctx).rateLimitPolicy(&params)
 	name := params.Name
 	namespace := params.Namespace
 	targetRef := params.TargetRef
@@ -342,13 +398,15 @@ func createRateLimitPolicyHandler(ctx context.Context, params CreateRateLimitPol
 		}
 	}
 
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
 	rateLimitPolicy := map[string]interface{}{
-		"apiVersion": "kuadrant.io/v1",
+		"apiVersion": release.apis["RateLimitPolicy"].apiVersion,
 		"kind":       "RateLimitPolicy",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, params.Annotations),
 		"spec": map[string]interface{}{
 			"targetRef": targetRef,
 		},
@@ -361,26 +419,17 @@ func createRateLimitPolicyHandler(ctx context.Context, params CreateRateLimitPol
 		limitsMap := make(map[string]interface{})
 		for name, limitDef := range params.Limits {
 			limitMap := map[string]interface{}{
-				"rates": limitDef.Rates,
+				"rates": renderRates(release, limitDef.Rates),
 			}
 			if len(limitDef.When) > 0 {
 				limitMap["when"] = limitDef.When
 			}
+			if len(limitDef.Counters) > 0 {
+				limitMap["counters"] = renderCounters(release, limitDef.Counters)
+			}
 			limitsMap[name] = limitMap
 		}
 		spec["limits"] = limitsMap
-	} else {
-		// If no limits provided, add a default global limit
-		spec["limits"] = map[string]interface{}{
-			"global": map[string]interface{}{
-				"rates": []RateLimit{
-					{
-						Limit:  10,
-						Window: "60s",
-					},
-				},
-			},
-		}
 	}
 	
 	if params.Defaults != nil && len(params.Defaults) > 0 {
@@ -390,7 +439,15 @@ func createRateLimitPolicyHandler(ctx context.Context, params CreateRateLimitPol
 		spec["overrides"] = params.Overrides
 	}
 
-	content, err := yaml.Marshal(rateLimitPolicy)
+	if err := release.checkSpec(ctx, "RateLimitPolicy", spec); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	if err := guardrails.check(ctx, rateLimitPolicy); err != nil {
+		return "", err
+	}
+
+	content, err := marshalManifest(ctx, rateLimitPolicy)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -399,6 +456,7 @@ func createRateLimitPolicyHandler(ctx context.Context, params CreateRateLimitPol
 }
 
 func createAuthPolicyHandler(ctx context.Context, params CreateAuthPolicyParams) (string, error) {
+	toolDefaultsFrom(ctx).authPolicy(&params)
 	name := params.Name
 	namespace := params.Namespace
 	targetRef := params.TargetRef
@@ -416,13 +474,15 @@ func createAuthPolicyHandler(ctx context.Context, params CreateAuthPolicyParams)
 		targetRef["group"] = "gateway.networking.k8s.io"
 	}
 
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
 	authPolicy := map[string]interface{}{
-		"apiVersion": "kuadrant.io/v1",
+		"apiVersion": release.apis["AuthPolicy"].apiVersion,
 		"kind":       "AuthPolicy",
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
+		"metadata":   objectMeta(name, namespace, params.Labels, params.Annotations),
 		"spec": map[string]interface{}{
 			"targetRef": targetRef,
 		},
@@ -439,7 +499,15 @@ func createAuthPolicyHandler(ctx context.Context, params CreateAuthPolicyParams)
 		spec["overrides"] = params.Overrides
 	}
 
-	content, err := yaml.Marshal(authPolicy)
+	if err := release.checkSpec(ctx, "AuthPolicy", spec); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	if err := guardrails.check(ctx, authPolicy); err != nil {
+		return "", err
+	}
+
+	content, err := marshalManifest(ctx, authPolicy)
 	if err != nil {
 		return fmt.Sprintf("Error: Failed to generate YAML: %v", err), nil
 	}
@@ -447,135 +515,328 @@ func createAuthPolicyHandler(ctx context.Context, params CreateAuthPolicyParams)
 	return string(content), nil
 }
 
+// objectMeta returns manifest metadata, with labels and annotations if any
+func objectMeta(name, namespace string, labels, annotations map[string]string) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return metadata
+}
+
+// textTool adapts a handler returning text (manifests, reports or
+// "Error: ..." messages) into an MCP tool handler. Guardrail violations
+// are returned as a tool error with structured content.
+func textTool[P any](handler func(context.Context, P) (string, error)) mcp.ToolHandlerFor[P, any] {
+	return func(ctx context.Context, _ *mcp.CallToolRequest, params P) (*mcp.CallToolResult, any, error) {
+		ctx, span := tracer.Start(ctx, "tool.execute")
+		result, err := handler(ctx, params)
+		endSpan(span, err)
+		var violations *guardrailError
+		if errors.As(err, &violations) {
+			return &mcp.CallToolResult{
+				IsError:           true,
+				Content:           []mcp.Content{&mcp.TextContent{Text: "Error: " + violations.Error()}},
+				StructuredContent: violations,
+			}, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: result}},
+		}, nil, nil
+	}
+}
+
+// marshalManifest renders a manifest as YAML
+func marshalManifest(ctx context.Context, manifest map[string]interface{}) ([]byte, error) {
+	kind, _ := manifest["kind"].(string)
+	_, span := tracer.Start(ctx, "manifest.marshal", trace.WithAttributes(attribute.String("k8s.resource.kind", kind)))
+	content, err := yaml.Marshal(manifest)
+	endSpan(span, err)
+	return content, err
+}
+
+// envOr returns the value of an environment variable, or def if it's unset
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// defaultCacheDir returns the doc cache directory from KUADRANT_MCP_CACHE_DIR,
+// or a directory under the user cache dir
+func defaultCacheDir() string {
+	if dir, ok := os.LookupEnv("KUADRANT_MCP_CACHE_DIR"); ok {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kuadrant-mcp-server")
+}
+
+// toolNames lists every tool newServer can register
+var toolNames = []string{
+	"create_gateway", "create_httproute", "create_dnspolicy", "create_tlspolicy",
+	"create_ratelimitpolicy", "create_authpolicy", "search_docs",
+	"list_policies", "get_policy_status", "describe_gateway", "list_dnsrecords", "get_kuadrant_status",
+	"apply_manifest", "diff_manifest", "explain_status", "analyze_snapshot",
+	"explain_enforcement", "explain_authconfig", "analyze_envoy_config", "generate_from_openapi",
+}
+
+// newServer builds a server instance with the tenant's tools, and the
+// organisation defaults overridden by the tenant's
+func newServer(tenant *tenantConfig) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp", Version: serverVersion}, &mcp.ServerOptions{
+		SubscribeHandler:   notifier.subscribe,
+		UnsubscribeHandler: notifier.unsubscribe,
+	})
+
+	middleware := []mcp.Middleware{tracingMiddleware, loggingMiddleware, metrics.middleware, activeRequests.middleware}
+	if tenant.Name != "" {
+		middleware = append([]mcp.Middleware{tenantLogMiddleware(tenant.Name)}, middleware...)
+	}
+	server.AddReceivingMiddleware(middleware...)
+
+	// Register tools
+	defaults := orgDefaults.merge(tenant.toolDefaults)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_gateway", Description: "Generate a Gateway manifest with Kuadrant annotations"}, createGatewayHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_httproute", Description: "Generate an HTTPRoute manifest"}, createHTTPRouteHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_dnspolicy", Description: "Generate a Kuadrant DNSPolicy manifest"}, createDNSPolicyHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_tlspolicy", Description: "Generate a Kuadrant TLSPolicy manifest"}, createTLSPolicyHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_ratelimitpolicy", Description: "Generate a Kuadrant RateLimitPolicy manifest"}, createRateLimitPolicyHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "create_authpolicy", Description: "Generate a Kuadrant AuthPolicy manifest"}, createAuthPolicyHandler, true)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "search_docs", Description: "Search all Kuadrant documentation resources and return the best matching sections"}, searchDocsHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "diff_manifest", Description: "Diff manifests field by field against the live objects in the cluster or a supplied snapshot, ignoring status and server-managed fields"}, diffManifestHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "explain_status", Description: "Explain a Kuadrant policy's status conditions: what each reason means, its likely root cause and the next diagnostic steps"}, explainStatusHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "analyze_snapshot", Description: "Diagnose a kubectl get -o yaml dump or support bundle offline: orphaned targets, unenforced policies, failed certificates, crashlooping components, ranked by severity"}, analyzeSnapshotHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "explain_enforcement", Description: "Map RateLimitPolicy limits to the Limitador limits and wasm-shim action sets rendered for them, flagging limits that never reached Limitador and actions that can never match"}, explainEnforcementHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "explain_authconfig", Description: "Show how an AuthPolicy's rules were translated into Authorino AuthConfigs, flagging untranslated rules, missing identity sources, hostname mismatches and duplicated AuthConfigs"}, explainAuthConfigHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "analyze_envoy_config", Description: "Check an Envoy config dump from a gateway pod for the Kuadrant wasm filter on each listener, the clusters its services call and the routes for a Gateway or HTTPRoute"}, analyzeEnvoyConfigHandler, false)
+	addTool(server, tenant, defaults, &mcp.Tool{Name: "generate_from_openapi", Description: "Generate an HTTPRoute, AuthPolicy and RateLimitPolicy from an OpenAPI 3 document: path and method matches, authentication from securitySchemes and limits from x-kuadrant rate_limit extensions"}, generateFromOpenAPIHandler, true)
+
+	// Read-only cluster tools (from cluster.go)
+	if cluster != nil {
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "list_policies", Description: "List Kuadrant policies in the cluster with their targets and whether they are enforced"}, cluster.listPoliciesHandler, false)
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "get_policy_status", Description: "Get a Kuadrant policy's status conditions and the state of the objects it targets"}, cluster.getPolicyStatusHandler, false)
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "describe_gateway", Description: "Describe a Gateway's listeners, status, attached HTTPRoutes and the policies targeting them"}, cluster.describeGatewayHandler, false)
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "list_dnsrecords", Description: "List DNSRecords created for DNSPolicies with their endpoints and readiness"}, cluster.listDNSRecordsHandler, false)
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "get_kuadrant_status", Description: "Get the status of the Kuadrant, Limitador and Authorino instances and operator deployments"}, cluster.getKuadrantStatusHandler, false)
+		addTool(server, tenant, defaults, &mcp.Tool{Name: "apply_manifest", Description: "Server-side apply a manifest as a dry run and report the admission result and field manager conflicts; applies for real only with confirm on a server that allows writes"}, cluster.applyManifestHandler, false)
+	}
+
+	// Add resources for Kuadrant documentation (from resources.go)
+	addKuadrantResources(server)
+
+	servers.add(server)
+	return server
+}
+
 func main() {
 	// Parse command line flags
 	var (
-		transport = flag.String("transport", "stdio", "Transport type: stdio, sse, http")
-		addr      = flag.String("addr", ":8080", "Address to listen on (for sse/http transports)")
+		transport      = flag.String("transport", "stdio", "Transport type: stdio, sse, http")
+		addr           = flag.String("addr", ":8080", "Address to listen on (for sse/http transports)")
+		cacheDir       = flag.String("cache-dir", defaultCacheDir(), "Directory to persist fetched docs in, empty to cache in memory only (env: KUADRANT_MCP_CACHE_DIR)")
+		prefetch       = flag.Bool("prefetch", false, "Fetch all docs in the background at startup")
+		refresh        = flag.Duration("refresh-interval", 5*time.Minute, "How often to refresh cached docs before they expire, 0 to disable")
+		docsFile       = flag.String("docs-config", os.Getenv("KUADRANT_MCP_DOCS_CONFIG"), "YAML/JSON file adding or replacing documentation sources (env: KUADRANT_MCP_DOCS_CONFIG)")
+		adminAddr      = flag.String("admin-addr", "", "Separate address for /healthz, /readyz and /metrics (default: served on -addr for sse/http transports)")
+		logFormat      = flag.String("log-format", envOr("KUADRANT_MCP_LOG_FORMAT", "text"), "Log format: text, json (env: KUADRANT_MCP_LOG_FORMAT)")
+		logLevel       = flag.String("log-level", envOr("KUADRANT_MCP_LOG_LEVEL", "info"), "Log level: debug, info, warn, error (env: KUADRANT_MCP_LOG_LEVEL)")
+		traces         = flag.String("trace-exporter", envOr("OTEL_TRACES_EXPORTER", "none"), "Trace exporter: otlp, console, none (env: OTEL_TRACES_EXPORTER; OTLP endpoint from OTEL_EXPORTER_OTLP_ENDPOINT)")
+		defaultsFile   = flag.String("defaults-config", os.Getenv("KUADRANT_MCP_DEFAULTS_CONFIG"), "YAML file of organisation defaults for generated manifests (env: KUADRANT_MCP_DEFAULTS_CONFIG)")
+		guardrailsPath = flag.String("guardrails", os.Getenv("KUADRANT_MCP_GUARDRAILS"), "YAML file, or directory of files, of CEL rules generated manifests must pass (env: KUADRANT_MCP_GUARDRAILS)")
+		tenantsFile    = flag.String("tenants-config", os.Getenv("KUADRANT_MCP_TENANTS_CONFIG"), "YAML file of tenants with their own defaults and allowed tools (env: KUADRANT_MCP_TENANTS_CONFIG)")
+		kubernetes     = flag.Bool("kubernetes", false, "Add read-only tools that inspect Kuadrant state in the cluster")
+		kubeconfig     = flag.String("kubeconfig", "", "Kubeconfig for -kubernetes (default: $KUBECONFIG, ~/.kube/config or in-cluster config)")
+		kubeContext    = flag.String("kube-context", "", "Kubeconfig context for -kubernetes (default: current context)")
+		allowWrites    = flag.Bool("allow-writes", false, "Let apply_manifest apply manifests for real when called with confirm (for -kubernetes)")
+		snapshots      = flag.String("snapshot-dir", os.Getenv("KUADRANT_MCP_SNAPSHOT_DIR"), "Directory the analyze_snapshot, explain_enforcement, explain_authconfig, analyze_envoy_config and generate_from_openapi tools may read files from with path, empty to only accept pasted input (env: KUADRANT_MCP_SNAPSHOT_DIR)")
+		httpOpts       httpOptions
 	)
+	flag.DurationVar(&httpOpts.shutdownTimeout, "shutdown-timeout", 20*time.Second, "How long to let in-flight requests finish on SIGTERM before closing sessions")
+	flag.StringVar(&httpOpts.tlsCert, "tls-cert", "", "TLS certificate file, reloaded when it changes (for sse/http transports)")
+	flag.StringVar(&httpOpts.tlsKey, "tls-key", "", "TLS private key file (for sse/http transports)")
+	flag.StringVar(&httpOpts.tlsClientCA, "tls-client-ca", "", "Require client certificates signed by this PEM bundle (for sse/http transports)")
+	flag.StringVar(&httpOpts.auth.mode, "auth", authNone, "Authentication for sse/http transports: none, token, mtls, oauth")
+	flag.StringVar(&httpOpts.auth.tokensFile, "auth-tokens-file", os.Getenv("KUADRANT_MCP_AUTH_TOKENS_FILE"), "File of accepted bearer tokens, one per line (for -auth token, env: KUADRANT_MCP_AUTH_TOKENS_FILE)")
+	flag.StringVar(&httpOpts.auth.clientCA, "auth-client-ca", "", "PEM bundle client certificates must chain to (for -auth mtls)")
+	flag.StringVar(&httpOpts.auth.jwksFile, "auth-jwks", "", "JWKS file with the authorization server's signing keys (for -auth oauth)")
+	flag.StringVar(&httpOpts.auth.issuer, "auth-issuer", "", "Expected token issuer, advertised as the authorization server (for -auth oauth)")
+	flag.StringVar(&httpOpts.auth.audience, "auth-audience", "", "Canonical URL of this server, expected in the token audience (for -auth oauth)")
+	flag.StringVar(&httpOpts.auth.scopes, "auth-scopes", "", "Comma separated scopes every token must carry (for -auth oauth)")
 	flag.Parse()
+	httpOpts.addr = *addr
 
-	log.Printf("[KUADRANT MCP] Starting server with transport=%s", *transport)
-
-	// Create server
-	server := mcp.NewServer("kuadrant-mcp", "1.0.0", nil)
-
-	// Register tools using NewServerTool with type inference
-	server.AddTools(
-		mcp.NewServerTool(
-			"create_gateway",
-			"Generate a Gateway manifest with Kuadrant annotations",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateGatewayParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createGatewayHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-		mcp.NewServerTool(
-			"create_httproute",
-			"Generate an HTTPRoute manifest",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateHTTPRouteParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createHTTPRouteHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-		mcp.NewServerTool(
-			"create_dnspolicy",
-			"Generate a Kuadrant DNSPolicy manifest",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateDNSPolicyParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createDNSPolicyHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-		mcp.NewServerTool(
-			"create_tlspolicy",
-			"Generate a Kuadrant TLSPolicy manifest",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateTLSPolicyParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createTLSPolicyHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-		mcp.NewServerTool(
-			"create_ratelimitpolicy",
-			"Generate a Kuadrant RateLimitPolicy manifest",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateRateLimitPolicyParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createRateLimitPolicyHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-		mcp.NewServerTool(
-			"create_authpolicy",
-			"Generate a Kuadrant AuthPolicy manifest",
-			func(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[CreateAuthPolicyParams]) (*mcp.CallToolResultFor[string], error) {
-				result, err := createAuthPolicyHandler(ctx, params.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				return &mcp.CallToolResultFor[string]{
-					Content: []mcp.Content{&mcp.TextContent{Text: result}},
-				}, nil
-			},
-		),
-	)
+	if err := setupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Add resources for Kuadrant documentation (from resources.go)
-	addKuadrantResources(server)
+	slog.Info("Starting server", "transport", *transport)
+
+	cache.dir = *cacheDir
+	cache.onChange = notifier.docChanged
+
+	if *docsFile != "" {
+		docs, err := loadDocsConfig(*docsFile)
+		if err != nil {
+			fatal("Failed to load docs config", "path", *docsFile, "error", err)
+		}
+		sources.set(docs)
+		slog.Info("Loaded docs config", "path", *docsFile, "docs", len(docs))
+	}
+	if cache.dir != "" {
+		slog.Info("Caching docs on disk", "dir", cache.dir)
+	}
+
+	if *defaultsFile != "" {
+		defaults, err := loadDefaultsConfig(*defaultsFile)
+		if err != nil {
+			fatal("Failed to load defaults config", "path", *defaultsFile, "error", err)
+		}
+		orgDefaults = defaults
+		slog.Info("Loaded defaults config", "path", *defaultsFile)
+	}
 
-	ctx := context.Background()
+	if *guardrailsPath != "" {
+		set, err := loadGuardrails(*guardrailsPath)
+		if err != nil {
+			fatal("Failed to load guardrails", "path", *guardrailsPath, "error", err)
+		}
+		guardrails = set
+		slog.Info("Loaded guardrails", "path", *guardrailsPath, "rules", len(set.rules))
+	}
+
+	if *kubernetes {
+		client, err := newClusterClient(*kubeconfig, *kubeContext)
+		if err != nil {
+			fatal("Failed to set up Kubernetes client", "error", err)
+		}
+		client.allowWrites = *allowWrites
+		cluster = client
+		slog.Info("Enabled cluster tools", "allowWrites", *allowWrites)
+	}
+
+	if *snapshots != "" {
+		snapshotDir = *snapshots
+		slog.Info("Reading snapshots from disk", "dir", snapshotDir)
+	}
+
+	var tenants *tenantsConfig
+	if *tenantsFile != "" {
+		cfg, err := loadTenantsConfig(*tenantsFile)
+		if err != nil {
+			fatal("Failed to load tenants config", "path", *tenantsFile, "error", err)
+		}
+		tenants = cfg
+		slog.Info("Loaded tenants config", "path", *tenantsFile, "tenants", len(cfg.Tenants))
+	}
+	metrics.sessions = servers.sessionCount
+
+	var defaultServer *mcp.Server
+	if tenants == nil {
+		defaultServer = newServer(&tenantConfig{})
+	}
+
+	// SIGTERM/SIGINT cancel ctx, which drains the transport before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx, *traces)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+
+	if *prefetch {
+		cache.goBackground(func() { cache.warm(ctx) })
+	}
+	if *refresh > 0 {
+		cache.goBackground(func() { cache.refreshLoop(ctx, *refresh) })
+	}
+	if *docsFile != "" {
+		go watchDocsConfig(ctx, *docsFile, 30*time.Second)
+	}
+
+	admin := newAdminHandler(serverReady(ctx, *prefetch, cache))
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		slog.Info("Serving health and metrics", "addr", *adminAddr)
+		adminServer = &http.Server{Addr: *adminAddr, Handler: admin}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Admin server failed", "error", err)
+			}
+		}()
+	} else {
+		httpOpts.admin = admin
+	}
+	// without a tenants config every client shares one server instance
+	getServer := func(*http.Request) *mcp.Server { return defaultServer }
+	var router *tenantRouter
+	if tenants != nil {
+		router = newTenantRouter(tenants, newServer)
+		getServer = router.server
+		httpOpts.tenants = router
+	}
 
 	switch *transport {
 	case "stdio":
 		// Run with stdio transport (default)
-		if err := server.Run(ctx, mcp.NewStdioTransport()); err != nil {
-			log.Fatal(err)
+		server := defaultServer
+		if router != nil {
+			if tenants.Default == "" {
+				fatal("The stdio transport needs a default tenant in the tenants config")
+			}
+			server = router.get(tenants.byName(tenants.Default))
 		}
+		err = serveStdio(ctx, server, httpOpts.shutdownTimeout)
 
 	case "sse":
 		// Run with SSE transport
-		log.Printf("Starting SSE server on %s", *addr)
-		handler := mcp.NewSSEHandler(func(r *http.Request) *mcp.Server {
-			return server
-		})
-		if err := http.ListenAndServe(*addr, handler); err != nil {
-			log.Fatal(err)
-		}
+		slog.Info("Starting SSE server", "addr", *addr)
+		handler := mcp.NewSSEHandler(getServer, nil)
+		err = serveHTTP(ctx, httpOpts, handler)
 
 	case "http":
 		// Run with StreamableHTTP transport
-		log.Printf("Starting StreamableHTTP server on %s", *addr)
-		handler := mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
-			return server
-		}, nil)
-		if err := http.ListenAndServe(*addr, handler); err != nil {
-			log.Fatal(err)
-		}
+		slog.Info("Starting StreamableHTTP server", "addr", *addr)
+		handler := mcp.NewStreamableHTTPHandler(getServer, nil)
+		err = serveHTTP(ctx, httpOpts, handler)
 
 	default:
-		log.Fatalf("Unknown transport: %s", *transport)
+		fatal("Unknown transport", "transport", *transport)
+	}
+	if err != nil {
+		fatal("Server failed", "error", err)
+	}
+
+	// the transport has stopped; stop background work and let in-progress
+	// cache writes finish so the disk cache isn't left half updated
+	slog.Info("Shutting down")
+	stop()
+	flushCtx, cancel := context.WithTimeout(context.Background(), httpOpts.shutdownTimeout)
+	defer cancel()
+	if err := cache.close(flushCtx); err != nil {
+		slog.Warn("Gave up waiting for doc cache refreshes", "error", err)
+	}
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	if adminServer != nil {
+		adminServer.Shutdown(flushCtx)
 	}
+	slog.Info("Shutdown complete")
 }
 
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// docSection is a markdown document split at a heading
+type docSection struct {
+	heading string // heading text, empty for content before the first heading
+	anchor  string // GitHub style anchor of the heading
+	level   int    // heading level (1-6), 0 for content before the first heading
+	body    string // section content including the heading line
+}
+
+// splitSections splits markdown into sections at ATX headings, ignoring
+// anything that looks like a heading inside fenced code blocks
+func splitSections(content string) []docSection {
+	var sections []docSection
+	var current docSection
+	var body strings.Builder
+	seen := make(map[string]int)
+	fence := ""
+
+	flush := func() {
+		current.body = strings.TrimSpace(body.String())
+		if current.body != "" || current.heading != "" {
+			sections = append(sections, current)
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		// track fenced code blocks
+		if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fence = trimmed[:3]
+		} else if fence != "" && strings.HasPrefix(trimmed, fence) {
+			fence = ""
+		} else if fence == "" {
+			if level, heading, ok := parseHeading(line); ok {
+				flush()
+				anchor := headingAnchor(heading)
+				if n := seen[anchor]; n > 0 {
+					seen[anchor] = n + 1
+					anchor = anchor + "-" + strconv.Itoa(n)
+				} else {
+					seen[anchor] = 1
+				}
+				current = docSection{heading: heading, anchor: anchor, level: level}
+			}
+		}
+
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+
+	return sections
+}
+
+// parseHeading reports whether line is an ATX heading, returning its level and text
+func parseHeading(line string) (int, string, bool) {
+	if !strings.HasPrefix(line, "#") {
+		return 0, "", false
+	}
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, "", false
+	}
+	heading := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if heading == "" {
+		return 0, "", false
+	}
+	return level, heading, true
+}
+
+// headingAnchor returns the anchor GitHub generates for a heading
+func headingAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// findSection returns the section with the given anchor together with its
+// subsections, i.e. everything up to the next heading of the same or a
+// higher level
+func findSection(sections []docSection, anchor string) (string, bool) {
+	for i, section := range sections {
+		if section.anchor != anchor || section.level == 0 {
+			continue
+		}
+		parts := []string{section.body}
+		for _, sub := range sections[i+1:] {
+			if sub.level <= section.level {
+				break
+			}
+			parts = append(parts, sub.body)
+		}
+		return strings.Join(parts, "\n\n"), true
+	}
+	return "", false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const testMarkdown = "Intro text.\n" +
+	"\n" +
+	"# RateLimitPolicy\n" +
+	"\n" +
+	"Overview.\n" +
+	"\n" +
+	"## Limits\n" +
+	"\n" +
+	"```yaml\n" +
+	"# not a heading\n" +
+	"limits: {}\n" +
+	"```\n" +
+	"\n" +
+	"### Rates ###\n" +
+	"\n" +
+	"Rates.\n" +
+	"\n" +
+	"## Limits\n" +
+	"\n" +
+	"Again.\n" +
+	"\n" +
+	"# Troubleshooting\n"
+
+func TestSplitSections(t *testing.T) {
+	var got []string
+	for _, s := range splitSections(testMarkdown) {
+		got = append(got, fmt.Sprintf("%d %s (%s)", s.level, s.heading, s.anchor))
+	}
+	want := []string{
+		"0  ()",
+		"1 RateLimitPolicy (ratelimitpolicy)",
+		"2 Limits (limits)",
+		"3 Rates (rates)",
+		"2 Limits (limits-1)",
+		"1 Troubleshooting (troubleshooting)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseHeading(t *testing.T) {
+	tests := []struct {
+		line    string
+		level   int
+		heading string
+		ok      bool
+	}{
+		{"# Title", 1, "Title", true},
+		{"###\tTabbed", 3, "Tabbed", true},
+		{"## Closed ##", 2, "Closed", true},
+		{"#hashtag", 0, "", false},
+		{"####### Seven", 0, "", false},
+		{"#", 0, "", false},
+		{" # Indented", 0, "", false},
+	}
+	for _, tt := range tests {
+		level, heading, ok := parseHeading(tt.line)
+		if level != tt.level || heading != tt.heading || ok != tt.ok {
+			t.Errorf("parseHeading(%q) = %d, %q, %v, want %d, %q, %v", tt.line, level, heading, ok, tt.level, tt.heading, tt.ok)
+		}
+	}
+}
+
+func TestHeadingAnchor(t *testing.T) {
+	tests := []struct{ heading, want string }{
+		{"Rate Limiting", "rate-limiting"},
+		{"spec.limits[].rates", "speclimitsrates"},
+		{"Using `when` conditions", "using-when-conditions"},
+		{"snake_case and kebab-case", "snake_case-and-kebab-case"},
+		{"Übersicht", "übersicht"},
+	}
+	for _, tt := range tests {
+		if got := headingAnchor(tt.heading); got != tt.want {
+			t.Errorf("headingAnchor(%q) = %q, want %q", tt.heading, got, tt.want)
+		}
+	}
+}
+
+func TestFindSection(t *testing.T) {
+	sections := splitSections(testMarkdown)
+	tests := []struct {
+		anchor string
+		want   []string
+		ok     bool
+	}{
+		// subsections are included up to the next heading of the same level
+		{"limits", []string{"## Limits", "# not a heading", "### Rates ###", "Rates."}, true},
+		{"limits-1", []string{"## Limits", "Again."}, true},
+		{"ratelimitpolicy", []string{"# RateLimitPolicy", "### Rates ###", "Again."}, true},
+		{"troubleshooting", []string{"# Troubleshooting"}, true},
+		{"", nil, false},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := findSection(sections, tt.anchor)
+		if ok != tt.ok {
+			t.Errorf("findSection(%q) ok = %v, want %v", tt.anchor, ok, tt.ok)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("findSection(%q) is missing %q:\n%s", tt.anchor, want, got)
+			}
+		}
+		if tt.anchor == "limits" && strings.Contains(got, "Again.") {
+			t.Errorf("findSection(%q) runs into the next section:\n%s", tt.anchor, got)
+		}
+	}
+}
+
+func TestSectionResources(t *testing.T) {
+	useDocs(t, map[string]string{"kuadrant://docs/ratelimitpolicy": testMarkdown})
+	read := func(handler mcp.ResourceHandler, uri string) (string, error) {
+		result, err := handler(context.Background(), &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: uri}})
+		if err != nil {
+			return "", err
+		}
+		return result.Contents[0].Text, nil
+	}
+
+	section, err := read(sectionResourceHandler, "kuadrant://docs/v1.2/ratelimitpolicy#rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(section, "### Rates ###\n\nRates.") {
+		t.Errorf("section:\n%s", section)
+	}
+	if _, err := read(sectionResourceHandler, "kuadrant://docs/ratelimitpolicy#missing"); err == nil {
+		t.Error("missing section was found")
+	}
+
+	toc, err := read(tocResourceHandler, "kuadrant://toc/v1.2/ratelimitpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"- RateLimitPolicy (kuadrant://docs/v1.2/ratelimitpolicy#ratelimitpolicy,",
+		"    - Rates (kuadrant://docs/v1.2/ratelimitpolicy#rates,",
+		"  - Limits (kuadrant://docs/v1.2/ratelimitpolicy#limits-1,",
+	} {
+		if !strings.Contains(toc, want) {
+			t.Errorf("missing %q in:\n%s", want, toc)
+		}
+	}
+}
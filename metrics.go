@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// latencyBuckets are the histogram bucket upper bounds in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// serverMetrics holds the metrics exposed on /metrics in the Prometheus
+// text format
+type serverMetrics struct {
+	toolCalls           *counterVec
+	toolDuration        *histogramVec
+	resourceReads       *counterVec
+	resourceDuration    *histogramVec
+	docCache            *counterVec
+	guardrailViolations *counterVec
+
+	// sessions, if set, reports the number of connected MCP sessions
+	sessions func() int
+}
+
+var metrics = newServerMetrics()
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		toolCalls: newCounterVec("kuadrant_mcp_tool_calls_total",
+			"Tool calls by tool and outcome (success, error, invalid).", "tool", "outcome"),
+		toolDuration: newHistogramVec("kuadrant_mcp_tool_call_duration_seconds",
+			"Tool call latency.", "tool"),
+		resourceReads: newCounterVec("kuadrant_mcp_resource_reads_total",
+			"Resource reads by kind (doc, section, toc) and outcome (success, error).", "kind", "outcome"),
+		resourceDuration: newHistogramVec("kuadrant_mcp_resource_read_duration_seconds",
+			"Resource read latency.", "kind"),
+		docCache: newCounterVec("kuadrant_mcp_doc_cache_requests_total",
+			"Doc cache lookups by result (hit, miss, fallback, error).", "result"),
+		guardrailViolations: newCounterVec("kuadrant_mcp_guardrail_violations_total",
+			"Generated manifests rejected by each guardrail rule.", "rule"),
+	}
+}
+
+// middleware records tool call and resource read metrics for an MCP server
+func (m *serverMetrics) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		start := time.Now()
+		result, err := next(ctx, method, req)
+		elapsed := time.Since(start).Seconds()
+
+		switch params := req.GetParams().(type) {
+		case *mcp.CallToolParamsRaw:
+			// requests the SDK rejects may name tools that don't exist, so
+			// they aren't labelled by tool to keep cardinality bounded
+			tool, outcome := params.Name, toolOutcome(result, err)
+			if outcome == "invalid" {
+				tool = ""
+			}
+			m.toolCalls.inc(tool, outcome)
+			m.toolDuration.observe(elapsed, tool)
+
+		case *mcp.ReadResourceParams:
+			kind, outcome := resourceKind(params.URI), "success"
+			if err != nil {
+				outcome = "error"
+			}
+			m.resourceReads.inc(kind, outcome)
+			m.resourceDuration.observe(elapsed, kind)
+		}
+		return result, err
+	}
+}
+
+// toolOutcome classifies a tool call. Tools report user errors as text
+// starting with "Error:" rather than failing the call.
+func toolOutcome(result mcp.Result, err error) string {
+	if err != nil {
+		return "invalid"
+	}
+	res, ok := result.(*mcp.CallToolResult)
+	if !ok || res.IsError {
+		return "error"
+	}
+	for _, content := range res.Content {
+		if text, ok := content.(*mcp.TextContent); ok && strings.HasPrefix(text.Text, "Error:") {
+			return "error"
+		}
+	}
+	return "success"
+}
+
+// resourceKind labels a resource URI without its unbounded parts
+func resourceKind(uri string) string {
+	switch {
+	case strings.HasPrefix(uri, "kuadrant://toc/"):
+		return "toc"
+	case strings.HasPrefix(uri, "kuadrant://docs/") && strings.Contains(uri, "#"):
+		return "section"
+	case strings.HasPrefix(uri, "kuadrant://docs/"):
+		return "doc"
+	}
+	return "other"
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.toolCalls.write(w)
+	m.toolDuration.write(w)
+	m.resourceReads.write(w)
+	m.resourceDuration.write(w)
+	m.docCache.write(w)
+	m.guardrailViolations.write(w)
+	if m.sessions != nil {
+		fmt.Fprintf(w, "# HELP kuadrant_mcp_active_sessions Connected MCP sessions.\n")
+		fmt.Fprintf(w, "# TYPE kuadrant_mcp_active_sessions gauge\n")
+		fmt.Fprintf(w, "kuadrant_mcp_active_sessions %d\n", m.sessions())
+	}
+}
+
+// counterVec is a counter partitioned by label values
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by formatted label pairs
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	key := formatLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram partitioned by label values
+type histogramVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	key := formatLabels(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		h.series[key] = s
+	}
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", h.name, key, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, key, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, key, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, key, s.count)
+	}
+}
+
+// formatLabels renders label pairs as they appear between braces
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%s", name, strconv.Quote(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := newCounterVec("calls_total", "Calls.", "tool", "outcome")
+	c.inc("search_docs", "success")
+	c.inc("search_docs", "success")
+	c.inc("create_gateway", "error")
+	c.inc(`say "hi"`, "success")
+
+	var b strings.Builder
+	c.write(&b)
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{tool="create_gateway",outcome="error"} 1
+calls_total{tool="say \"hi\"",outcome="success"} 1
+calls_total{tool="search_docs",outcome="success"} 2
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := newHistogramVec("latency_seconds", "Latency.", "tool")
+	h.observe(0.003, "search_docs")
+	h.observe(0.2, "search_docs")
+	h.observe(20, "search_docs")
+
+	var b strings.Builder
+	h.write(&b)
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{tool="search_docs",le="0.005"} 1
+latency_seconds_bucket{tool="search_docs",le="0.01"} 1
+latency_seconds_bucket{tool="search_docs",le="0.025"} 1
+latency_seconds_bucket{tool="search_docs",le="0.05"} 1
+latency_seconds_bucket{tool="search_docs",le="0.1"} 1
+latency_seconds_bucket{tool="search_docs",le="0.25"} 2
+latency_seconds_bucket{tool="search_docs",le="0.5"} 2
+latency_seconds_bucket{tool="search_docs",le="1"} 2
+latency_seconds_bucket{tool="search_docs",le="2.5"} 2
+latency_seconds_bucket{tool="search_docs",le="5"} 2
+latency_seconds_bucket{tool="search_docs",le="10"} 2
+latency_seconds_bucket{tool="search_docs",le="+Inf"} 3
+latency_seconds_sum{tool="search_docs"} 20.203
+latency_seconds_count{tool="search_docs"} 3
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	m := newServerMetrics()
+	m.sessions = func() int { return 1 }
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, nil)
+	type echoParams struct {
+		Text string `json:"text"`
+	}
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, func(_ context.Context, _ *mcp.CallToolRequest, p echoParams) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: p.Text}}}, nil, nil
+	})
+	server.AddResource(&mcp.Resource{URI: "kuadrant://docs/authpolicy", Name: "authpolicy"},
+		func(context.Context, *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: "kuadrant://docs/authpolicy", Text: "# AuthPolicy"}}}, nil
+		})
+	server.AddReceivingMiddleware(m.middleware)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	for _, text := range []string{"hello", "Error: no gateway named api"} {
+		if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": text}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "no_such_tool"}); err == nil {
+		t.Error("calling an unknown tool succeeded")
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "kuadrant://docs/authpolicy"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "kuadrant://toc/runbook"}); err == nil {
+		t.Error("reading an unknown resource succeeded")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	scraped := rec.Body.String()
+	for _, want := range []string{
+		`kuadrant_mcp_tool_calls_total{tool="echo",outcome="success"} 1`,
+		`kuadrant_mcp_tool_calls_total{tool="echo",outcome="error"} 1`,
+		`kuadrant_mcp_tool_calls_total{tool="",outcome="invalid"} 1`,
+		`kuadrant_mcp_tool_call_duration_seconds_count{tool="echo"} 2`,
+		`kuadrant_mcp_resource_reads_total{kind="doc",outcome="success"} 1`,
+		`kuadrant_mcp_resource_reads_total{kind="toc",outcome="error"} 1`,
+		`kuadrant_mcp_resource_read_duration_seconds_count{kind="doc"} 1`,
+		"kuadrant_mcp_active_sessions 1",
+	} {
+		if !strings.Contains(scraped, want+"\n") {
+			t.Errorf("scrape is missing %s", want)
+		}
+	}
+	if strings.Contains(scraped, "no_such_tool") {
+		t.Error("an unknown tool name is used as a label")
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := newTestCache("")
+	handler := newAdminHandler(serverReady(ctx, true, cache))
+
+	readyz := func() (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, strings.TrimSpace(string(body))
+	}
+
+	if code, body := readyz(); code != http.StatusServiceUnavailable || body != "docs cache is warming" {
+		t.Errorf("before warming: %d %q", code, body)
+	}
+	cache.warmed.Store(true)
+	if code, body := readyz(); code != http.StatusOK || body != "ok" {
+		t.Errorf("after warming: %d %q", code, body)
+	}
+	cancel()
+	if code, body := readyz(); code != http.StatusServiceUnavailable || body != "shutting down" {
+		t.Errorf("while shutting down: %d %q", code, body)
+	}
+
+	// without prefetching the server is ready straight away
+	if err := serverReady(context.Background(), false, newTestCache(""))(); err != nil {
+		t.Errorf("not ready without prefetch: %v", err)
+	}
+}
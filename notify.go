@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// resourceNotifier keeps clients current with upstream docs: it sends
+// notifications/resources/updated to sessions subscribed to a document when
+// the doc cache sees its content change, and re-registers resources (which
+// sends resources/list_changed) when the configured document set changes.
+type resourceNotifier struct {
+	mu         sync.Mutex
+	servers    map[*mcp.Server]map[string]docSource // registered documents per server
+	subscribed map[string]int                       // subscribed URI -> subscription count
+}
+
+var notifier = &resourceNotifier{
+	servers:    make(map[*mcp.Server]map[string]docSource),
+	subscribed: make(map[string]int),
+}
+
+// register records the documents registered on a server
+func (n *resourceNotifier) register(server *mcp.Server) {
+	docs := make(map[string]docSource)
+	for uri, source := range sources.all() {
+		docs[uri] = source
+	}
+
+	n.mu.Lock()
+	n.servers[server] = docs
+	n.mu.Unlock()
+}
+
+// subscribe accepts subscriptions to any document, section or table of contents URI
+func (n *resourceNotifier) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	ref, ok := parseDocURI(req.Params.URI)
+	if !ok {
+		return mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	if _, ok := sources.get(ref.uri); !ok {
+		return mcp.ResourceNotFoundError(req.Params.URI)
+	}
+
+	n.mu.Lock()
+	n.subscribed[req.Params.URI]++
+	n.mu.Unlock()
+
+	slog.DebugContext(ctx, "Subscribed to resource", "uri", req.Params.URI)
+	return nil
+}
+
+func (n *resourceNotifier) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	n.mu.Lock()
+	if n.subscribed[req.Params.URI] > 1 {
+		n.subscribed[req.Params.URI]--
+	} else {
+		delete(n.subscribed, req.Params.URI)
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// docChanged notifies subscribers of every URI served from the given upstream URL
+func (n *resourceNotifier) docChanged(url string) {
+	n.mu.Lock()
+	var uris []string
+	for uri := range n.subscribed {
+		ref, ok := parseDocURI(uri)
+		if !ok {
+			continue
+		}
+		source, ok := sources.get(ref.uri)
+		if !ok {
+			continue
+		}
+		release, err := lookupRelease(ref.version)
+		if err != nil {
+			continue
+		}
+		if source.rawURL(release) == url {
+			uris = append(uris, uri)
+		}
+	}
+	servers := make([]*mcp.Server, 0, len(n.servers))
+	for server := range n.servers {
+		servers = append(servers, server)
+	}
+	n.mu.Unlock()
+
+	for _, uri := range uris {
+		slog.Info("Resource updated", "uri", uri)
+		for _, server := range servers {
+			// the server only notifies sessions subscribed to uri
+			server.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{URI: uri})
+		}
+	}
+}
+
+// syncResources re-registers documents on every server after the configured
+// documents have changed, so clients receive resources/list_changed
+func (n *resourceNotifier) syncResources() {
+	docs := sources.all()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for server, registered := range n.servers {
+		for uri := range registered {
+			if _, ok := docs[uri]; !ok {
+				removeDocResources(server, uri)
+				delete(registered, uri)
+			}
+		}
+		for uri, source := range docs {
+			if old, ok := registered[uri]; ok && old == source {
+				continue
+			}
+			addDocResources(server, uri, source)
+			registered[uri] = source
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newTestNotifier returns a notifier with a server serving the current
+// documents, and a client session connected to it whose resource
+// notifications are sent to the returned channels
+func newTestNotifier(t *testing.T) (*resourceNotifier, *mcp.ClientSession, <-chan string, <-chan struct{}) {
+	t.Helper()
+	n := &resourceNotifier{
+		servers:    make(map[*mcp.Server]map[string]docSource),
+		subscribed: make(map[string]int),
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, &mcp.ServerOptions{
+		SubscribeHandler:   n.subscribe,
+		UnsubscribeHandler: n.unsubscribe,
+	})
+	addKuadrantResources(server)
+	n.register(server)
+
+	updated := make(chan string, 10)
+	listChanged := make(chan struct{}, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+		ResourceListChangedHandler: func(context.Context, *mcp.ResourceListChangedRequest) {
+			listChanged <- struct{}{}
+		},
+	})
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return n, session, updated, listChanged
+}
+
+func TestResourceNotifierDocChanged(t *testing.T) {
+	useDocs(t, map[string]string{
+		"kuadrant://docs/authpolicy": "# AuthPolicy",
+		"kuadrant://docs/dnspolicy":  "# DNSPolicy",
+	})
+	n, session, updated, _ := newTestNotifier(t)
+	ctx := context.Background()
+	authURL := sources.all()["kuadrant://docs/authpolicy"].url
+	dnsURL := sources.all()["kuadrant://docs/dnspolicy"].url
+
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "kuadrant://docs/runbook"}); err == nil {
+		t.Error("subscribing to an unknown document succeeded")
+	}
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "kuadrant://docs/authpolicy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the subscribed document's updates are sent
+	n.docChanged(dnsURL)
+	n.docChanged(authURL)
+	select {
+	case uri := <-updated:
+		if uri != "kuadrant://docs/authpolicy" {
+			t.Errorf("got an update for %s, want kuadrant://docs/authpolicy", uri)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no update for the subscribed document")
+	}
+	expectNone(t, updated)
+
+	if err := session.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: "kuadrant://docs/authpolicy"}); err != nil {
+		t.Fatal(err)
+	}
+	n.docChanged(authURL)
+	expectNone(t, updated)
+}
+
+func TestResourceNotifierSyncResources(t *testing.T) {
+	useDocs(t, map[string]string{
+		"kuadrant://docs/authpolicy": "# AuthPolicy",
+		"kuadrant://docs/dnspolicy":  "# DNSPolicy",
+	})
+	n, session, _, listChanged := newTestNotifier(t)
+	ctx := context.Background()
+
+	// the configuration drops dnspolicy and adds a runbook
+	docs := sources.all()
+	delete(docs, "kuadrant://docs/dnspolicy")
+	docs["kuadrant://docs/runbook"] = docSource{url: "file:///srv/runbook.md", name: "Runbook"}
+	sources.set(docs)
+	n.syncResources()
+
+	select {
+	case <-listChanged:
+	case <-time.After(time.Second):
+		t.Fatal("no resources/list_changed notification")
+	}
+	result, err := session.ListResources(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, r := range result.Resources {
+		uris = append(uris, r.URI)
+	}
+	for _, want := range []string{"kuadrant://docs/authpolicy", "kuadrant://docs/runbook", "kuadrant://toc/runbook"} {
+		if !slices.Contains(uris, want) {
+			t.Errorf("%s is not listed in %v", want, uris)
+		}
+	}
+	for _, removed := range []string{"kuadrant://docs/dnspolicy", "kuadrant://toc/dnspolicy"} {
+		if slices.Contains(uris, removed) {
+			t.Errorf("%s is still listed", removed)
+		}
+	}
+}
+
+// expectNone fails if anything is received on ch shortly
+func expectNone(t *testing.T, ch <-chan string) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		t.Errorf("unexpected %s", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
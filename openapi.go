@@ -0,0 +1,643 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// openAPIMethods are the operations a path item can have, in the order
+// their rules are generated
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// pathParameter matches a templated segment such as {petId}
+var pathParameter = regexp.MustCompile(`\{[^{}/]+\}`)
+
+type GenerateFromOpenAPIParams struct {
+	OpenAPI         string `json:"openapi,omitempty" jsonschema:"OpenAPI 3 document, YAML or JSON, with x-kuadrant extensions"`
+	Path            string `json:"path,omitempty" jsonschema:"OpenAPI document file, relative to the server's -snapshot-dir, to read instead of openapi"`
+	Name            string `json:"name,omitempty" jsonschema:"Name of the HTTPRoute and policies, overriding the x-kuadrant route name"`
+	Namespace       string `json:"namespace,omitempty" jsonschema:"Kubernetes namespace for the HTTPRoute and policies, overriding the x-kuadrant route namespace"`
+	KuadrantVersion string `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release to target (e.g. v1.2); selects API version and supported fields (default: latest)"`
+}
+
+// openAPIDoc is the parts of an OpenAPI 3 document the generator reads
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title     string               `json:"title"`
+		XKuadrant *openAPIKuadrantInfo `json:"x-kuadrant"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+	} `json:"components"`
+	Security  []map[string][]string `json:"security"`
+	XKuadrant *openAPIKuadrantInfo  `json:"x-kuadrant"`
+}
+
+// openAPIKuadrantInfo is the top level x-kuadrant extension, which
+// kuadrantctl also accepts under info
+type openAPIKuadrantInfo struct {
+	Route struct {
+		Name       string            `json:"name"`
+		Namespace  string            `json:"namespace"`
+		Hostnames  []interface{}     `json:"hostnames"`
+		ParentRefs []interface{}     `json:"parentRefs"`
+		Labels     map[string]string `json:"labels"`
+	} `json:"route"`
+}
+
+// openAPIKuadrantOperation is the x-kuadrant extension of a path item or
+// operation. Fields set on an operation override the path item's.
+type openAPIKuadrantOperation struct {
+	Disable       *bool             `json:"disable"`
+	PathMatchType string            `json:"pathMatchType"`
+	BackendRefs   []interface{}     `json:"backendRefs"`
+	RateLimit     *openAPIRateLimit `json:"rate_limit"`
+}
+
+type openAPIRateLimit struct {
+	Rates []struct {
+		Limit  int    `json:"limit"`
+		Window string `json:"window"`
+		// Duration and Unit are the form kuadrantctl used before window
+		Duration int    `json:"duration"`
+		Unit     string `json:"unit"`
+	} `json:"rates"`
+	Counters []interface{}            `json:"counters"`
+	When     []map[string]interface{} `json:"when"`
+}
+
+type openAPIOperation struct {
+	OperationID string `json:"operationId"`
+	// Security is nil when the operation inherits the document's
+	// requirements, and empty when it has none
+	Security  *[]map[string][]string    `json:"security"`
+	XKuadrant *openAPIKuadrantOperation `json:"x-kuadrant"`
+}
+
+type openAPISecurityScheme struct {
+	Type             string `json:"type"`
+	Scheme           string `json:"scheme"`
+	Name             string `json:"name"`
+	In               string `json:"in"`
+	OpenIDConnectURL string `json:"openIdConnectUrl"`
+	// XKuadrant gives the issuer for oauth2 and bearer schemes, which
+	// OpenAPI has no field for
+	XKuadrant struct {
+		IssuerURL string `json:"issuerUrl"`
+	} `json:"x-kuadrant"`
+}
+
+// openAPIRoute is an operation routed by the HTTPRoute
+type openAPIRoute struct {
+	name      string
+	path      string
+	method    string
+	predicate string
+	security  []map[string][]string
+}
+
+// openAPIGenerator accumulates the objects generated for a document
+type openAPIGenerator struct {
+	doc      openAPIDoc
+	basePath string
+	rules    []interface{}
+	routes   []openAPIRoute
+	limits   map[string]LimitDefinition
+	// operations are the operations by the name their limit and rules
+	// are generated with, e.g. GET /pets
+	operations map[string]string
+	notes      []string
+}
+
+func generateFromOpenAPIHandler(ctx context.Context, params GenerateFromOpenAPIParams) (string, error) {
+	data := []byte(params.OpenAPI)
+	if params.Path != "" {
+		var err error
+		data, err = readSnapshotFile(params.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+	}
+	if len(data) == 0 {
+		return "Error: openapi or path is required", nil
+	}
+
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	// the rules are scoped to operations with CEL predicates, which
+	// kuadrant.io/v1 introduced
+	if release.apis["RateLimitPolicy"].apiVersion != "kuadrant.io/v1" {
+		return fmt.Sprintf("Error: generate_from_openapi writes kuadrant.io/v1 policies, which Kuadrant %s does not support", release.version), nil
+	}
+
+	var doc openAPIDoc
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Sprintf("Error: invalid OpenAPI document: %v", err), nil
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return "Error: only OpenAPI 3 documents are supported", nil
+	}
+	info := doc.XKuadrant
+	if info == nil {
+		info = doc.Info.XKuadrant
+	}
+	if info == nil {
+		info = &openAPIKuadrantInfo{}
+	}
+	name := params.Name
+	setDefault(&name, info.Route.Name)
+	namespace := params.Namespace
+	setDefault(&namespace, info.Route.Namespace)
+	setDefault(&namespace, toolDefaultsFrom(ctx).Namespace)
+	if name == "" {
+		return "Error: name is required, or set x-kuadrant route name in the document", nil
+	}
+	if len(info.Route.ParentRefs) == 0 {
+		return "Error: the document has no x-kuadrant route parentRefs", nil
+	}
+
+	g := &openAPIGenerator{
+		doc:        doc,
+		basePath:   serverBasePath(doc),
+		limits:     make(map[string]LimitDefinition),
+		operations: make(map[string]string),
+	}
+	if err := g.addPaths(); err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	if len(g.rules) == 0 {
+		return "Error: the document has no enabled operations to route", nil
+	}
+	authRules, err := g.authRules()
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	route := CreateHTTPRouteParams{
+		Name:       name,
+		Namespace:  namespace,
+		Labels:     info.Route.Labels,
+		ParentRefs: info.Route.ParentRefs,
+		Hostnames:  info.Route.Hostnames,
+		Rules:      g.rules,
+	}
+	if namespace == "" {
+		return "Error: namespace is required, or set x-kuadrant route namespace in the document", nil
+	}
+	documents := []func() (string, error){
+		func() (string, error) { return createHTTPRouteHandler(ctx, route) },
+	}
+	targetRef := map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "name": name}
+	if len(authRules) > 0 {
+		policy := CreateAuthPolicyParams{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          info.Route.Labels,
+			TargetRef:       targetRef,
+			Rules:           authRules,
+			KuadrantVersion: params.KuadrantVersion,
+		}
+		documents = append(documents, func() (string, error) { return createAuthPolicyHandler(ctx, policy) })
+	}
+	if len(g.limits) > 0 {
+		policy := CreateRateLimitPolicyParams{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          info.Route.Labels,
+			TargetRef:       targetRef,
+			Limits:          g.limits,
+			KuadrantVersion: params.KuadrantVersion,
+		}
+		documents = append(documents, func() (string, error) { return createRateLimitPolicyHandler(ctx, policy) })
+	}
+
+	var out strings.Builder
+	for _, note := range g.notes {
+		fmt.Fprintf(&out, "# %s\n", note)
+	}
+	for i, document := range documents {
+		manifest, err := document()
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(manifest, "Error:") {
+			return manifest, nil
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.WriteString(manifest)
+	}
+	return out.String(), nil
+}
+
+// serverBasePath returns the path of the first server URL, which prefixes
+// every path in the document
+func serverBasePath(doc openAPIDoc) string {
+	if len(doc.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(doc.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// addPaths adds a route rule, and a limit if it has one, for every
+// operation not disabled with x-kuadrant
+func (g *openAPIGenerator) addPaths() error {
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := g.doc.Paths[path]
+		var pathExtension openAPIKuadrantOperation
+		if raw, ok := item["x-kuadrant"]; ok {
+			if err := json.Unmarshal(raw, &pathExtension); err != nil {
+				return fmt.Errorf("paths %s x-kuadrant: %v", path, err)
+			}
+		}
+		for _, method := range openAPIMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return fmt.Errorf("paths %s %s: %v", path, method, err)
+			}
+			extension := pathExtension
+			if op.XKuadrant != nil {
+				extension = mergeOperationExtension(pathExtension, *op.XKuadrant)
+			}
+			if extension.Disable != nil && *extension.Disable {
+				continue
+			}
+			if err := g.addOperation(path, method, op, extension); err != nil {
+				return fmt.Errorf("paths %s %s: %v", path, method, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeOperationExtension returns the path item's extension with the
+// fields the operation sets taking precedence
+func mergeOperationExtension(path, op openAPIKuadrantOperation) openAPIKuadrantOperation {
+	merged := path
+	if op.Disable != nil {
+		merged.Disable = op.Disable
+	}
+	if op.PathMatchType != "" {
+		merged.PathMatchType = op.PathMatchType
+	}
+	if op.BackendRefs != nil {
+		merged.BackendRefs = op.BackendRefs
+	}
+	if op.RateLimit != nil {
+		merged.RateLimit = op.RateLimit
+	}
+	return merged
+}
+
+func (g *openAPIGenerator) addOperation(path, method string, op openAPIOperation, extension openAPIKuadrantOperation) error {
+	name := operationName(method, path, op)
+	upper := strings.ToUpper(method)
+	if name == "" {
+		return fmt.Errorf("operationId %q has no letters or digits to name its rules after", op.OperationID)
+	}
+	// names are slugs, so e.g. get_user and get-user, or GET /a/b and
+	// GET /a-b, would share a limit
+	if other, ok := g.operations[name]; ok {
+		return fmt.Errorf("%s and %s would both be named %s; give them distinct operationIds", other, upper+" "+path, name)
+	}
+	g.operations[name] = upper + " " + path
+	fullPath := g.basePath + path
+
+	var match map[string]interface{}
+	var predicate string
+	switch {
+	case pathParameter.MatchString(fullPath):
+		// templated paths need a regular expression in both the route and
+		// the policies
+		pattern := pathPattern(fullPath)
+		if extension.PathMatchType == "PathPrefix" {
+			pattern += "(/.*)?"
+		}
+		match = map[string]interface{}{"type": "RegularExpression", "value": pattern}
+		predicate = fmt.Sprintf("request.url_path.matches(%s)", celString("^"+pattern+"$"))
+	case extension.PathMatchType == "PathPrefix":
+		match = map[string]interface{}{"type": "PathPrefix", "value": fullPath}
+		predicate = fmt.Sprintf("request.url_path.startsWith(%s)", celString(fullPath))
+	case extension.PathMatchType == "" || extension.PathMatchType == "Exact":
+		match = map[string]interface{}{"type": "Exact", "value": fullPath}
+		predicate = fmt.Sprintf("request.url_path == %s", celString(fullPath))
+	default:
+		return fmt.Errorf("unsupported pathMatchType %q (supported: Exact, PathPrefix)", extension.PathMatchType)
+	}
+	predicate = fmt.Sprintf("request.method == %s && %s", celString(upper), predicate)
+
+	rule := map[string]interface{}{
+		"matches": []interface{}{
+			map[string]interface{}{"path": match, "method": upper},
+		},
+	}
+	if len(extension.BackendRefs) > 0 {
+		rule["backendRefs"] = extension.BackendRefs
+	} else {
+		g.notes = append(g.notes, fmt.Sprintf("%s %s has no x-kuadrant backendRefs; requests to it will fail until one is added", upper, path))
+	}
+	g.rules = append(g.rules, rule)
+
+	security := g.doc.Security
+	if op.Security != nil {
+		security = *op.Security
+	}
+	g.routes = append(g.routes, openAPIRoute{name: name, path: path, method: upper, predicate: predicate, security: security})
+
+	if extension.RateLimit != nil {
+		limit, err := openAPILimit(*extension.RateLimit, predicate)
+		if err != nil {
+			return fmt.Errorf("x-kuadrant rate_limit: %v", err)
+		}
+		g.limits[name] = limit
+	}
+	return nil
+}
+
+// operationName names the limit and rules generated for an operation
+func operationName(method, path string, op openAPIOperation) string {
+	if op.OperationID != "" {
+		return slug(op.OperationID)
+	}
+	return slug(method + "-" + path)
+}
+
+// slug lowercases s and replaces each run of other characters with a dash
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// pathPattern returns a regular expression matching a templated path, with
+// each parameter matching one segment
+func pathPattern(path string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range pathParameter.FindAllStringIndex(path, -1) {
+		b.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		b.WriteString("[^/]+")
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	return b.String()
+}
+
+// celString quotes s as a CEL string literal
+func celString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// openAPILimit converts an x-kuadrant rate_limit into a limit scoped to the
+// operation by its predicate
+func openAPILimit(rateLimit openAPIRateLimit, predicate string) (LimitDefinition, error) {
+	if len(rateLimit.Rates) == 0 {
+		return LimitDefinition{}, fmt.Errorf("rates is required")
+	}
+	units := map[string]string{"second": "s", "minute": "m", "hour": "h"}
+	var limit LimitDefinition
+	for i, rate := range rateLimit.Rates {
+		window := rate.Window
+		if window == "" {
+			unit := strings.TrimSuffix(rate.Unit, "s")
+			duration := rate.Duration
+			if unit == "day" {
+				unit, duration = "hour", duration*24
+			}
+			if units[unit] == "" || duration <= 0 {
+				return LimitDefinition{}, fmt.Errorf("rates[%d] needs a window, or a duration and a unit of second, minute, hour or day", i)
+			}
+			window = fmt.Sprintf("%d%s", duration, units[unit])
+		}
+		if err := validateWindow(window); err != nil {
+			return LimitDefinition{}, fmt.Errorf("rates[%d]: %v", i, err)
+		}
+		limit.Rates = append(limit.Rates, RateLimit{Limit: rate.Limit, Window: window})
+	}
+	for i, counter := range rateLimit.Counters {
+		switch c := counter.(type) {
+		case string:
+			limit.Counters = append(limit.Counters, map[string]interface{}{"expression": c})
+		case map[string]interface{}:
+			// kuadrantctl used selectors before counters were expressions
+			if selector, ok := c["selector"].(string); ok {
+				limit.Counters = append(limit.Counters, map[string]interface{}{"expression": selector})
+			} else if c["expression"] != nil {
+				limit.Counters = append(limit.Counters, c)
+			} else {
+				return LimitDefinition{}, fmt.Errorf("counters[%d] needs an expression", i)
+			}
+		default:
+			return LimitDefinition{}, fmt.Errorf("counters[%d] must be an expression", i)
+		}
+	}
+	for i, when := range rateLimit.When {
+		if when["predicate"] == nil {
+			return LimitDefinition{}, fmt.Errorf("when[%d] must be a CEL predicate, e.g. {predicate: \"auth.identity.group == 'admin'\"}", i)
+		}
+		limit.When = append(limit.When, when)
+	}
+	limit.When = append(limit.When, map[string]interface{}{"predicate": predicate})
+	return limit, nil
+}
+
+// authRules returns AuthPolicy rules authenticating each operation with its
+// security schemes. Operations without security requirements are let
+// through anonymously when others have them. A scheme that can't be
+// translated is an error rather than skipped, so a secured operation is
+// never generated without authentication.
+func (g *openAPIGenerator) authRules() (map[string]interface{}, error) {
+	type scopesRule struct {
+		scheme, predicate string
+		patterns          []interface{}
+	}
+	var (
+		schemeRoutes = make(map[string][]string)
+		public       []string
+		scopesRules  = make(map[string]scopesRule)
+	)
+	for _, route := range g.routes {
+		if len(route.security) == 0 {
+			public = append(public, route.predicate)
+			continue
+		}
+		for _, requirement := range route.security {
+			if len(requirement) == 0 {
+				// an empty requirement makes authentication optional
+				public = append(public, route.predicate)
+				continue
+			}
+			// AuthPolicy authentication rules are alternatives, any one
+			// of which identifies the request
+			if len(requirement) > 1 {
+				return nil, fmt.Errorf("paths %s %s: security requirement needs all of %s together, which an AuthPolicy can't express; list them as separate requirements or use one scheme", route.path, strings.ToLower(route.method), strings.Join(sortedKeys(requirement), ", "))
+			}
+			for scheme, scopes := range requirement {
+				if !slices.Contains(schemeRoutes[scheme], route.predicate) {
+					schemeRoutes[scheme] = append(schemeRoutes[scheme], route.predicate)
+				}
+				if len(scopes) == 0 {
+					continue
+				}
+				patterns := make([]interface{}, 0, len(scopes))
+				for _, scope := range scopes {
+					patterns = append(patterns, map[string]interface{}{
+						"selector": "auth.identity.scope",
+						"operator": "matches",
+						"value":    "(^| )" + regexp.QuoteMeta(scope) + "( |$)",
+					})
+				}
+				key := route.name + "-" + slug(scheme) + "-scopes"
+				if _, ok := scopesRules[key]; ok {
+					return nil, fmt.Errorf("paths %s %s: the scopes rule for security scheme %s would be named %s, as another operation's is; rename the scheme or set distinct operationIds", route.path, strings.ToLower(route.method), scheme, key)
+				}
+				scopesRules[key] = scopesRule{scheme: scheme, predicate: route.predicate, patterns: patterns}
+			}
+		}
+	}
+	if len(schemeRoutes) == 0 {
+		return nil, nil
+	}
+
+	authentication := make(map[string]interface{})
+	identities := make(map[string]string)
+	for _, scheme := range sortedKeys(schemeRoutes) {
+		definition, ok := g.doc.Components.SecuritySchemes[scheme]
+		if !ok {
+			return nil, fmt.Errorf("security scheme %q is not defined in components.securitySchemes", scheme)
+		}
+		rule, err := g.authentication(scheme, definition)
+		if err != nil {
+			return nil, err
+		}
+		if len(schemeRoutes[scheme]) < len(g.routes) {
+			rule["when"] = []interface{}{map[string]interface{}{"predicate": anyOf(schemeRoutes[scheme])}}
+		}
+		identities[scheme] = identityPredicate(scheme, rule)
+		authentication[scheme] = rule
+	}
+	if len(public) > 0 {
+		if _, ok := authentication["public"]; ok {
+			return nil, fmt.Errorf("security scheme \"public\" has the name of the rule letting operations without security through; rename it")
+		}
+		authentication["public"] = map[string]interface{}{
+			"anonymous": map[string]interface{}{},
+			"when":      []interface{}{map[string]interface{}{"predicate": anyOf(public)}},
+		}
+	}
+
+	rules := map[string]interface{}{"authentication": authentication}
+	if len(scopesRules) > 0 {
+		// a request authenticated by another of the operation's schemes
+		// has no scopes to check
+		authorization := make(map[string]interface{})
+		for key, scopes := range scopesRules {
+			authorization[key] = map[string]interface{}{
+				"patternMatching": map[string]interface{}{"patterns": scopes.patterns},
+				"when": []interface{}{
+					map[string]interface{}{"predicate": scopes.predicate},
+					map[string]interface{}{"predicate": identities[scopes.scheme]},
+				},
+			}
+		}
+		rules["authorization"] = authorization
+	}
+	return rules, nil
+}
+
+// identityPredicate returns a predicate matching requests whose identity
+// came from the authentication rule for scheme: a JWT from its issuer or
+// one of its API key Secrets
+func identityPredicate(scheme string, rule map[string]interface{}) string {
+	if jwt, ok := rule["jwt"].(map[string]interface{}); ok {
+		return fmt.Sprintf("has(auth.identity.iss) && auth.identity.iss == %s", celString(jwt["issuerUrl"].(string)))
+	}
+	return fmt.Sprintf("has(auth.identity.metadata) && auth.identity.metadata.labels[%s] == %s", celString("kuadrant.io/apikeys-by"), celString(scheme))
+}
+
+// authentication returns the AuthPolicy authentication rule for a security
+// scheme, or an error if it has no equivalent
+func (g *openAPIGenerator) authentication(name string, scheme openAPISecurityScheme) (map[string]interface{}, error) {
+	switch {
+	case scheme.Type == "apiKey":
+		credentials := map[string]string{"header": "customHeader", "query": "queryString", "cookie": "cookie"}[scheme.In]
+		if credentials == "" || scheme.Name == "" {
+			return nil, fmt.Errorf("apiKey security scheme %q needs a name and in of header, query or cookie", name)
+		}
+		g.notes = append(g.notes, fmt.Sprintf("API keys for %s are Secrets labelled kuadrant.io/apikeys-by: %s", name, name))
+		return map[string]interface{}{
+			"apiKey": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"kuadrant.io/apikeys-by": name},
+				},
+			},
+			"credentials": map[string]interface{}{
+				credentials: map[string]interface{}{"name": scheme.Name},
+			},
+		}, nil
+	case scheme.Type == "openIdConnect":
+		if scheme.OpenIDConnectURL == "" {
+			return nil, fmt.Errorf("openIdConnect security scheme %q has no openIdConnectUrl", name)
+		}
+		issuer := strings.TrimSuffix(strings.TrimSuffix(scheme.OpenIDConnectURL, "/.well-known/openid-configuration"), "/")
+		return map[string]interface{}{"jwt": map[string]interface{}{"issuerUrl": issuer}}, nil
+	case scheme.Type == "oauth2", scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "bearer"):
+		if scheme.XKuadrant.IssuerURL == "" {
+			return nil, fmt.Errorf("%s security scheme %q has no x-kuadrant issuerUrl; set it so the AuthPolicy can validate its tokens", scheme.Type, name)
+		}
+		return map[string]interface{}{"jwt": map[string]interface{}{"issuerUrl": scheme.XKuadrant.IssuerURL}}, nil
+	default:
+		return nil, fmt.Errorf("%s security scheme %q has no Kuadrant equivalent; use an apiKey, openIdConnect, oauth2 or bearer scheme, or disable its operations with x-kuadrant", scheme.Type, name)
+	}
+}
+
+// anyOf joins predicates so that any of them matching is enough
+func anyOf(predicates []string) string {
+	if len(predicates) == 1 {
+		return predicates[0]
+	}
+	parts := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		parts[i] = "(" + predicate + ")"
+	}
+	return strings.Join(parts, " || ")
+}
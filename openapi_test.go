@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testOpenAPI returns an OpenAPI document routed by x-kuadrant with the
+// given paths, indented under paths:
+func testOpenAPI(paths string) string {
+	return `openapi: 3.0.3
+info:
+  title: Pets
+servers:
+  - url: https://api.example.com/v1
+x-kuadrant:
+  route:
+    name: pets
+    namespace: shop
+    hostnames: [api.example.com]
+    parentRefs:
+      - name: external
+        namespace: gateways
+components:
+  securitySchemes:
+    keys: {type: apiKey, name: X-API-Key, in: header}
+    oidc: {type: openIdConnect, openIdConnectUrl: https://sso.example.com/.well-known/openid-configuration}
+    oauth: {type: oauth2, flows: {}}
+    tokens: {type: http, scheme: bearer, x-kuadrant: {issuerUrl: https://tokens.example.com}}
+    basic: {type: http, scheme: basic}
+    public: {type: apiKey, name: key, in: query}
+    b-c: {type: apiKey, name: X-B, in: header}
+    c: {type: apiKey, name: X-C, in: header}
+paths:
+` + paths
+}
+
+func TestGenerateFromOpenAPIHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   string
+		want    []string
+		notWant []string
+		errMsg  string
+	}{
+		{
+			name: "routes, limits and authentication",
+			paths: `  /pets:
+    x-kuadrant:
+      backendRefs: [{name: pets, port: 8080}]
+    get:
+      operationId: listPets
+      security: [{keys: []}]
+      x-kuadrant:
+        rate_limit:
+          rates: [{limit: 10, window: 1m}]
+  /pets/{petId}:
+    get:
+      security: [{oidc: [read]}, {tokens: []}]
+  /health:
+    get:
+      security: []
+`,
+			want: []string{
+				"kind: HTTPRoute", "type: RegularExpression", "value: /v1/pets/[^/]+", "type: Exact", "value: /v1/pets",
+				"kind: AuthPolicy", "issuerUrl: https://sso.example.com", "issuerUrl: https://tokens.example.com",
+				"kuadrant.io/apikeys-by: keys", "public:", "get-pets-petid-oidc-scopes:", "value: (^| )read( |$)",
+				"kind: RateLimitPolicy", "listpets:", "limit: 10",
+				"# GET /pets/{petId} has no x-kuadrant backendRefs",
+			},
+			notWant: []string{"# GET /pets has no x-kuadrant backendRefs", "basic"},
+		},
+		{
+			name: "no security",
+			paths: `  /pets:
+    get: {}
+`,
+			want:    []string{"kind: HTTPRoute"},
+			notWant: []string{"kind: AuthPolicy"},
+		},
+		{
+			name: "document security applies to operations without their own",
+			paths: `  /pets:
+    get: {}
+  /health:
+    get:
+      security: []
+security: [{keys: []}]
+`,
+			want: []string{"kind: AuthPolicy", "kuadrant.io/apikeys-by: keys", "public:", "predicate: request.method == 'GET' && request.url_path == '/v1/health'"},
+		},
+		{
+			name: "disabled operations are left out",
+			paths: `  /pets:
+    get:
+      x-kuadrant: {disable: true}
+`,
+			errMsg: "Error: the document has no enabled operations to route",
+		},
+		{
+			name: "oauth2 without an issuer",
+			paths: `  /pets:
+    get:
+      security: [{oauth: [read]}]
+`,
+			errMsg: `Error: oauth2 security scheme "oauth" has no x-kuadrant issuerUrl`,
+		},
+		{
+			name: "scheme without a Kuadrant equivalent",
+			paths: `  /pets:
+    get:
+      security: [{keys: []}, {basic: []}]
+`,
+			errMsg: `Error: http security scheme "basic" has no Kuadrant equivalent`,
+		},
+		{
+			name: "requirement combining schemes",
+			paths: `  /pets:
+    get:
+      security: [{keys: [], oidc: []}]
+`,
+			errMsg: "Error: paths /pets get: security requirement needs all of keys, oidc together",
+		},
+		{
+			name: "undefined scheme",
+			paths: `  /pets:
+    get:
+      security: [{missing: []}]
+`,
+			errMsg: `Error: security scheme "missing" is not defined`,
+		},
+		{
+			name: "paths with the same name",
+			paths: `  /a/b:
+    get: {}
+  /a-b:
+    get: {}
+`,
+			errMsg: "Error: paths /a/b get: GET /a-b and GET /a/b would both be named get-a-b",
+		},
+		{
+			name: "operationIds with the same name",
+			paths: `  /users:
+    get:
+      operationId: get_user
+  /user:
+    get:
+      operationId: get-user
+`,
+			errMsg: "Error: paths /users get: GET /user and GET /users would both be named get-user",
+		},
+		{
+			name: "scope rules with the same name",
+			paths: `  /x:
+    get:
+      operationId: a
+      security: [{b-c: [read]}]
+  /y:
+    get:
+      operationId: a-b
+      security: [{c: [read]}]
+`,
+			errMsg: "Error: paths /y get: the scopes rule for security scheme c would be named a-b-c-scopes",
+		},
+		{
+			name: "scheme named public with public operations",
+			paths: `  /pets:
+    get:
+      security: [{public: []}]
+  /health:
+    get:
+      security: []
+`,
+			errMsg: `Error: security scheme "public" has the name of the rule`,
+		},
+		{
+			name: "unsupported pathMatchType",
+			paths: `  /pets:
+    get:
+      x-kuadrant: {pathMatchType: RegularExpression}
+`,
+			errMsg: `Error: paths /pets get: unsupported pathMatchType "RegularExpression"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := generateFromOpenAPIHandler(context.Background(), GenerateFromOpenAPIParams{OpenAPI: testOpenAPI(tt.paths)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			if strings.HasPrefix(out, "Error:") {
+				t.Fatal(out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIScopesWithAlternatives(t *testing.T) {
+	route := "request.method == 'GET' && request.url_path == '/v1/pets'"
+	tests := []struct {
+		name     string
+		security string
+		// want maps each scopes rule to its when predicates
+		want map[string][]interface{}
+	}{
+		{
+			name:     "oauth scopes with an API key alternative",
+			security: "[{tokens: [read]}, {keys: []}]",
+			want: map[string][]interface{}{
+				"get-pets-tokens-scopes": {route, "has(auth.identity.iss) && auth.identity.iss == 'https://tokens.example.com'"},
+			},
+		},
+		{
+			name:     "scopes on both alternatives",
+			security: "[{oidc: [read]}, {keys: [admin]}]",
+			want: map[string][]interface{}{
+				"get-pets-oidc-scopes": {route, "has(auth.identity.iss) && auth.identity.iss == 'https://sso.example.com'"},
+				"get-pets-keys-scopes": {route, "has(auth.identity.metadata) && auth.identity.metadata.labels['kuadrant.io/apikeys-by'] == 'keys'"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := generateFromOpenAPIHandler(context.Background(), GenerateFromOpenAPIParams{
+				OpenAPI: testOpenAPI("  /pets:\n    get:\n      security: " + tt.security + "\n"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects, err := parseManifests(out)
+			if err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			var authorization map[string]interface{}
+			for _, obj := range objects {
+				if obj.GetKind() == "AuthPolicy" {
+					authorization, _, _ = unstructured.NestedMap(obj.Object, "spec", "rules", "authorization")
+				}
+			}
+			got := make(map[string][]interface{})
+			for key, rule := range authorization {
+				when, _, _ := unstructured.NestedSlice(rule.(map[string]interface{}), "when")
+				for _, w := range when {
+					got[key] = append(got[key], w.(map[string]interface{})["predicate"])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v\n%s", got, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestGenerateFromOpenAPIHandlerDocument(t *testing.T) {
+	tests := []struct {
+		name   string
+		params GenerateFromOpenAPIParams
+		errMsg string
+	}{
+		{"nothing given", GenerateFromOpenAPIParams{}, "Error: openapi or path is required"},
+		{"swagger 2", GenerateFromOpenAPIParams{OpenAPI: "swagger: '2.0'\n"}, "Error: only OpenAPI 3 documents are supported"},
+		{"no route name", GenerateFromOpenAPIParams{OpenAPI: "openapi: 3.0.3\npaths: {}\n"}, "Error: name is required"},
+		{"no parentRefs", GenerateFromOpenAPIParams{OpenAPI: "openapi: 3.0.3\npaths: {}\n", Name: "pets"}, "Error: the document has no x-kuadrant route parentRefs"},
+		{"pre-v1 Kuadrant", GenerateFromOpenAPIParams{OpenAPI: testOpenAPI(""), KuadrantVersion: "v0.11"}, "Error: generate_from_openapi writes kuadrant.io/v1 policies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := generateFromOpenAPIHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(out, tt.errMsg) {
+				t.Errorf("got %q, want prefix %q", out, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"listPets", "listpets"},
+		{"get-/pets/{petId}", "get-pets-petid"},
+		{"get_user", "get-user"},
+		{"  Create Pet!! ", "create-pet"},
+		{"v2.1", "v2-1"},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := slug(tt.in); got != tt.want {
+			t.Errorf("slug(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPathPattern(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/pets", "/pets"},
+		{"/pets/{petId}", "/pets/[^/]+"},
+		{"/v1.0/pets/{petId}/photos/{photoId}.jpg", `/v1\.0/pets/[^/]+/photos/[^/]+\.jpg`},
+		{"/files/{name}+", `/files/[^/]+\+`},
+	}
+	for _, tt := range tests {
+		if got := pathPattern(tt.in); got != tt.want {
+			t.Errorf("pathPattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCelString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/pets", `'/pets'`},
+		{"it's", `'it\'s'`},
+		{`^/a\.b$`, `'^/a\\.b$'`},
+	}
+	for _, tt := range tests {
+		if got := celString(tt.in); got != tt.want {
+			t.Errorf("celString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAPILimit(t *testing.T) {
+	const predicate = "request.method == 'GET'"
+	type rate = struct {
+		Limit    int    `json:"limit"`
+		Window   string `json:"window"`
+		Duration int    `json:"duration"`
+		Unit     string `json:"unit"`
+	}
+	tests := []struct {
+		name      string
+		rateLimit openAPIRateLimit
+		want      LimitDefinition
+		errMsg    string
+	}{
+		{
+			name:      "window",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 10, Window: "1m"}}},
+			want: LimitDefinition{
+				Rates: []RateLimit{{Limit: 10, Window: "1m"}},
+				When:  []map[string]interface{}{{"predicate": predicate}},
+			},
+		},
+		{
+			name:      "duration and unit",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 5, Duration: 10, Unit: "seconds"}, {Limit: 1000, Duration: 1, Unit: "day"}}},
+			want: LimitDefinition{
+				Rates: []RateLimit{{Limit: 5, Window: "10s"}, {Limit: 1000, Window: "24h"}},
+				When:  []map[string]interface{}{{"predicate": predicate}},
+			},
+		},
+		{
+			name: "counters and when",
+			rateLimit: openAPIRateLimit{
+				Rates:    []rate{{Limit: 1, Window: "1s"}},
+				Counters: []interface{}{"auth.identity.sub", map[string]interface{}{"selector": "request.host"}, map[string]interface{}{"expression": "request.path"}},
+				When:     []map[string]interface{}{{"predicate": "auth.identity.group == 'free'"}},
+			},
+			want: LimitDefinition{
+				Rates:    []RateLimit{{Limit: 1, Window: "1s"}},
+				Counters: []map[string]interface{}{{"expression": "auth.identity.sub"}, {"expression": "request.host"}, {"expression": "request.path"}},
+				When:     []map[string]interface{}{{"predicate": "auth.identity.group == 'free'"}, {"predicate": predicate}},
+			},
+		},
+		{
+			name:   "no rates",
+			errMsg: "rates is required",
+		},
+		{
+			name:      "unknown unit",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 1, Duration: 1, Unit: "week"}}},
+			errMsg:    "rates[0] needs a window, or a duration and a unit",
+		},
+		{
+			name:      "bad window",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 1, Window: "1d"}}},
+			errMsg:    "rates[0]: window must end with",
+		},
+		{
+			name:      "counter without an expression",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 1, Window: "1s"}}, Counters: []interface{}{map[string]interface{}{"key": "x"}}},
+			errMsg:    "counters[0] needs an expression",
+		},
+		{
+			name:      "when without a predicate",
+			rateLimit: openAPIRateLimit{Rates: []rate{{Limit: 1, Window: "1s"}}, When: []map[string]interface{}{{"selector": "x"}}},
+			errMsg:    "when[0] must be a CEL predicate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openAPILimit(tt.rateLimit, predicate)
+			switch {
+			case tt.errMsg != "":
+				if err == nil || !strings.HasPrefix(err.Error(), tt.errMsg) {
+					t.Errorf("error %v, want prefix %q", err, tt.errMsg)
+				}
+			case err != nil:
+				t.Errorf("unexpected error %v", err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
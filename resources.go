@@ -3,233 +3,362 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"sync"
-	"time"
+	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// docSource defines where to fetch a document from
+// defaultRawBaseURL is where built-in docs are fetched from, laid out as
+// {repo}/{ref}/{path}
+const defaultRawBaseURL = "https://raw.githubusercontent.com/Kuadrant"
+
+// docSource defines where to fetch a document from. Built-in docs are
+// located by repo and path so they can be served for any release; docs added
+// through a config file set url (and optionally docsUrl) instead.
 type docSource struct {
-	url         string // raw GitHub URL
+	repo        string // Kuadrant GitHub repository
+	path        string // file path within the repository
+	baseURL     string // mirror of defaultRawBaseURL, empty for GitHub
+	url         string // fixed document URL (http, https or file), served for every release
 	name        string
 	description string
 	fallback    string // minimal fallback content if fetch fails
-	docsUrl     string // canonical docs.kuadrant.io URL
+	docsPath    string // path under the versioned docs.kuadrant.io site
+	docsUrl     string // fixed canonical docs URL, used with url
+}
+
+// rawURL returns the URL to fetch the document from for a release
+func (s docSource) rawURL(release kuadrantRelease) string {
+	if s.url != "" {
+		return s.url
+	}
+	ref := release.operatorRef
+	if s.repo == "authorino" {
+		ref = release.authorinoRef
+	}
+	base := s.baseURL
+	if base == "" {
+		base = defaultRawBaseURL
+	}
+	return base + "/" + s.repo + "/" + ref + "/" + s.path
 }
 
-// resourceMapping maps URI paths to document sources
+// docsURL returns the canonical docs URL of the document for a release
+func (s docSource) docsURL(release kuadrantRelease) string {
+	if s.docsUrl != "" {
+		return s.docsUrl
+	}
+	if s.docsPath == "" {
+		return ""
+	}
+	return "https://docs.kuadrant.io/" + release.docsVersion + "/" + s.docsPath
+}
+
+// resourceMapping maps URI paths to the built-in document sources
 var resourceMapping = map[string]docSource{
 	"kuadrant://docs/gateway-api": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/overviews/gateway-api.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/overviews/gateway-api.md",
 		name:        "Gateway API Overview",
 		description: "Overview of Gateway API and Kuadrant integration",
-		fallback:    "# Gateway API\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/overviews/gateway-api/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/overviews/gateway-api/",
+		fallback:    "# Gateway API",
+		docsPath:    "kuadrant-operator/doc/overviews/gateway-api/",
 	},
 	"kuadrant://docs/dnspolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/dnspolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/dnspolicy.md",
 		name:        "DNSPolicy Reference",
 		description: "Complete DNSPolicy specification and examples",
-		fallback:    "# DNSPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/dnspolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/dnspolicy/",
+		fallback:    "# DNSPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/dnspolicy/",
 	},
 	"kuadrant://docs/ratelimitpolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/ratelimitpolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/ratelimitpolicy.md",
 		name:        "RateLimitPolicy Reference",
 		description: "Complete RateLimitPolicy specification and examples",
-		fallback:    "# RateLimitPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/ratelimitpolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/ratelimitpolicy/",
+		fallback:    "# RateLimitPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/ratelimitpolicy/",
 	},
 	"kuadrant://docs/authpolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/authpolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/authpolicy.md",
 		name:        "AuthPolicy Reference",
 		description: "Complete AuthPolicy specification and examples",
-		fallback:    "# AuthPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/authpolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/authpolicy/",
+		fallback:    "# AuthPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/authpolicy/",
 	},
 	"kuadrant://docs/tlspolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/tlspolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/tlspolicy.md",
 		name:        "TLSPolicy Reference",
 		description: "Complete TLSPolicy specification and examples",
-		fallback:    "# TLSPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/tlspolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/tlspolicy/",
+		fallback:    "# TLSPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/tlspolicy/",
 	},
 	"kuadrant://docs/tokenratelimitpolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/tokenratelimitpolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/tokenratelimitpolicy.md",
 		name:        "TokenRateLimitPolicy Reference",
 		description: "Token-based rate limiting for AI/LLM services",
-		fallback:    "# TokenRateLimitPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/tokenratelimitpolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/tokenratelimitpolicy/",
+		fallback:    "# TokenRateLimitPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/tokenratelimitpolicy/",
 	},
 	"kuadrant://docs/kuadrant": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/kuadrant.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/kuadrant.md",
 		name:        "Kuadrant CR Reference",
 		description: "Main Kuadrant custom resource configuration",
-		fallback:    "# Kuadrant CR\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/kuadrant/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/kuadrant/",
+		fallback:    "# Kuadrant CR",
+		docsPath:    "kuadrant-operator/doc/reference/kuadrant/",
 	},
 	"kuadrant://docs/authorino-features": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/authorino/main/docs/features.md",
+		repo:        "authorino",
+		path:        "docs/features.md",
 		name:        "Authorino Features",
 		description: "Complete guide to Authorino authentication and authorization features",
-		fallback:    "# Authorino Features\n\nSee: https://docs.kuadrant.io/latest/authorino/docs/features/",
-		docsUrl:     "https://docs.kuadrant.io/latest/authorino/docs/features/",
+		fallback:    "# Authorino Features",
+		docsPath:    "authorino/docs/features/",
 	},
 	"kuadrant://docs/telemetrypolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/telemetrypolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/reference/telemetrypolicy.md",
 		name:        "TelemetryPolicy Reference",
 		description: "Custom metrics labels for Gateway API resources",
-		fallback:    "# TelemetryPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/telemetrypolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/telemetrypolicy/",
+		fallback:    "# TelemetryPolicy",
+		docsPath:    "kuadrant-operator/doc/reference/telemetrypolicy/",
 	},
 	"kuadrant://docs/planpolicy": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/extensions/planpolicy.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/extensions/planpolicy.md",
 		name:        "PlanPolicy Extension",
 		description: "Plan-based rate limiting for tiered service offerings",
-		fallback:    "# PlanPolicy\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/extensions/planpolicy/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/extensions/planpolicy/",
+		fallback:    "# PlanPolicy",
+		docsPath:    "kuadrant-operator/doc/extensions/planpolicy/",
 	},
 	"kuadrant://docs/secure-protect-connect": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/user-guides/full-walkthrough/secure-protect-connect.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/user-guides/full-walkthrough/secure-protect-connect.md",
 		name:        "Secure, Protect and Connect",
 		description: "Full walkthrough: securing, protecting and connecting services with Kuadrant",
-		fallback:    "# Secure, Protect and Connect\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/full-walkthrough/secure-protect-connect/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/full-walkthrough/secure-protect-connect/",
+		fallback:    "# Secure, Protect and Connect",
+		docsPath:    "kuadrant-operator/doc/user-guides/full-walkthrough/secure-protect-connect/",
 	},
 	"kuadrant://docs/simple-ratelimiting": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/user-guides/ratelimiting/simple-rl-for-app-developers.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/user-guides/ratelimiting/simple-rl-for-app-developers.md",
 		name:        "Simple Rate Limiting Guide",
 		description: "Getting started with rate limiting for application developers",
-		fallback:    "# Simple Rate Limiting\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/ratelimiting/simple-rl-for-app-developers/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/ratelimiting/simple-rl-for-app-developers/",
+		fallback:    "# Simple Rate Limiting",
+		docsPath:    "kuadrant-operator/doc/user-guides/ratelimiting/simple-rl-for-app-developers/",
 	},
 	"kuadrant://docs/auth-for-developers": {
-		url:         "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/user-guides/auth/auth-for-app-devs-and-platform-engineers.md",
+		repo:        "kuadrant-operator",
+		path:        "doc/user-guides/auth/auth-for-app-devs-and-platform-engineers.md",
 		name:        "Auth for Developers",
 		description: "Authentication and authorization guide for app developers and platform engineers",
-		fallback:    "# Auth for Developers\n\nSee: https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/auth/auth-for-app-devs-and-platform-engineers/",
-		docsUrl:     "https://docs.kuadrant.io/latest/kuadrant-operator/doc/user-guides/auth/auth-for-app-devs-and-platform-engineers/",
+		fallback:    "# Auth for Developers",
+		docsPath:    "kuadrant-operator/doc/user-guides/auth/auth-for-app-devs-and-platform-engineers/",
 	},
 }
 
-// docCache stores fetched documents with TTL
-type docCache struct {
-	mu     sync.RWMutex
-	docs   map[string]cachedDoc
-	ttl    time.Duration
-	client *http.Client
+// docRef identifies a document, and optionally a section of it, addressed by
+// kuadrant://docs/[{version}/]{doc}[#{section}] or kuadrant://toc/[{version}/]{doc}
+type docRef struct {
+	uri     string // unversioned URI of the document
+	version string
+	section string
 }
 
-type cachedDoc struct {
-	content   string
-	fetchedAt time.Time
-}
+// parseDocURI splits a documentation URI into its parts
+func parseDocURI(uri string) (docRef, bool) {
+	var rest string
+	switch {
+	case strings.HasPrefix(uri, "kuadrant://docs/"):
+		rest = strings.TrimPrefix(uri, "kuadrant://docs/")
+	case strings.HasPrefix(uri, "kuadrant://toc/"):
+		rest = strings.TrimPrefix(uri, "kuadrant://toc/")
+	default:
+		return docRef{}, false
+	}
 
-var cache = &docCache{
-	docs: make(map[string]cachedDoc),
-	ttl:  15 * time.Minute,
-	client: &http.Client{
-		Timeout: 30 * time.Second,
-	},
+	var ref docRef
+	rest, ref.section, _ = strings.Cut(rest, "#")
+	if version, doc, ok := strings.Cut(rest, "/"); ok {
+		ref.version = version
+		rest = doc
+	}
+	ref.uri = "kuadrant://docs/" + rest
+	return ref, true
 }
 
-// fetch retrieves a document, using cache if available and fresh
-func (c *docCache) fetch(ctx context.Context, url, fallback string) (string, error) {
-	c.mu.RLock()
-	if doc, ok := c.docs[url]; ok && time.Since(doc.fetchedAt) < c.ttl {
-		c.mu.RUnlock()
-		return doc.content, nil
+// loadDoc fetches the document a URI refers to, at the release it names
+func loadDoc(ctx context.Context, uri string) (docSource, kuadrantRelease, string, error) {
+	ref, ok := parseDocURI(uri)
+	if !ok {
+		return docSource{}, kuadrantRelease{}, "", mcp.ResourceNotFoundError(uri)
+	}
+	source, ok := sources.get(ref.uri)
+	if !ok {
+		return docSource{}, kuadrantRelease{}, "", mcp.ResourceNotFoundError(uri)
+	}
+	release, err := lookupRelease(ref.version)
+	if err != nil {
+		return docSource{}, kuadrantRelease{}, "", mcp.ResourceNotFoundError(uri)
 	}
-	c.mu.RUnlock()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	content, err := cache.fetch(ctx, source.rawURL(release), source.fallback)
 	if err != nil {
-		return c.fallbackOrError(url, fallback, err)
+		return docSource{}, kuadrantRelease{}, "", err
+	}
+	return source, release, content, nil
+}
+
+// markdownResult wraps markdown content in a resource read result
+func markdownResult(uri, content string) *mcp.ReadResourceResult {
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{
+				URI:      uri,
+				MIMEType: "text/markdown",
+				Text:     content,
+			},
+		},
 	}
+}
 
-	resp, err := c.client.Do(req)
+// docResourceHandler serves a whole document. For versioned URIs
+// (kuadrant://docs/{version}/...) the release is taken from the URI,
+// otherwise the default release is served.
+func docResourceHandler(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	source, release, content, err := loadDoc(ctx, req.Params.URI)
 	if err != nil {
-		return c.fallbackOrError(url, fallback, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return c.fallbackOrError(url, fallback, fmt.Errorf("HTTP %d", resp.StatusCode))
+	// append canonical docs link
+	if docsURL := source.docsURL(release); docsURL != "" {
+		content = content + "\n\n---\n\nFull documentation: " + docsURL + "\n"
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return markdownResult(req.Params.URI, content), nil
+}
+
+// sectionResourceHandler serves a single section of a document, including
+// its subsections
+func sectionResourceHandler(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	source, release, content, err := loadDoc(ctx, req.Params.URI)
 	if err != nil {
-		return c.fallbackOrError(url, fallback, err)
+		return nil, err
 	}
+	ref, _ := parseDocURI(req.Params.URI)
 
-	content := string(body)
+	section, ok := findSection(splitSections(content), ref.section)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
 
-	c.mu.Lock()
-	c.docs[url] = cachedDoc{
-		content:   content,
-		fetchedAt: time.Now(),
+	if docsURL := source.docsURL(release); docsURL != "" {
+		section = section + "\n\n---\n\nFull documentation: " + docsURL + "#" + ref.section + "\n"
 	}
-	c.mu.Unlock()
 
-	return content, nil
+	return markdownResult(req.Params.URI, section), nil
 }
 
-func (c *docCache) fallbackOrError(url, fallback string, err error) (string, error) {
-	if fallback != "" {
-		log.Printf("[KUADRANT MCP] Failed to fetch %s: %v, using fallback", url, err)
-		return fallback, nil
+// tocResourceHandler serves the table of contents of a document, linking
+// each heading to its section resource
+func tocResourceHandler(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	source, _, content, err := loadDoc(ctx, req.Params.URI)
+	if err != nil {
+		return nil, err
 	}
-	return "", fmt.Errorf("failed to fetch %s: %w", url, err)
-}
+	ref, _ := parseDocURI(req.Params.URI)
 
-// createResourceHandler creates a handler that fetches from upstream
-func createResourceHandler(source docSource) func(context.Context, *mcp.ServerSession, *mcp.ReadResourceParams) (*mcp.ReadResourceResult, error) {
-	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.ReadResourceParams) (*mcp.ReadResourceResult, error) {
-		log.Printf("[KUADRANT MCP] Resource requested: %s", params.URI)
+	docURI := ref.uri
+	if ref.version != "" {
+		docURI = versionedURI(docURI, ref.version)
+	}
 
-		content, err := cache.fetch(ctx, source.url, source.fallback)
-		if err != nil {
-			return nil, err
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s: Contents\n\n", source.name)
+	fmt.Fprintf(&b, "Read a section with its URI below, or the whole document at %s\n\n", docURI)
+	for _, section := range splitSections(content) {
+		if section.level == 0 {
+			continue
 		}
+		fmt.Fprintf(&b, "%s- %s (%s#%s, %d bytes)\n",
+			strings.Repeat("  ", section.level-1), section.heading, docURI, section.anchor, len(section.body))
+	}
 
-		// append canonical docs link
-		if source.docsUrl != "" {
-			content = content + "\n\n---\n\nFull documentation: " + source.docsUrl + "\n"
-		}
+	return markdownResult(req.Params.URI, b.String()), nil
+}
 
-		return &mcp.ReadResourceResult{
-			Contents: []*mcp.ResourceContents{
-				{
-					URI:      params.URI,
-					MIMEType: "text/markdown",
-					Text:     content,
-				},
-			},
-		}, nil
-	}
+// versionedURI turns kuadrant://docs/{doc} into kuadrant://docs/{version}/{doc}
+func versionedURI(uri, version string) string {
+	return strings.Replace(uri, "kuadrant://docs/", "kuadrant://docs/"+version+"/", 1)
 }
 
-// addKuadrantResources registers all MCP resources
-func addKuadrantResources(server *mcp.Server) {
-	var resources []*mcp.ServerResource
+// tocURI returns the table of contents URI of a document
+func tocURI(uri string) string {
+	return strings.Replace(uri, "kuadrant://docs/", "kuadrant://toc/", 1)
+}
 
-	for uri, source := range resourceMapping {
-		src := source // capture for closure
+// addDocResources registers a document and its table of contents
+func addDocResources(server *mcp.Server, uri string, source docSource) {
+	server.AddResource(&mcp.Resource{
+		URI:         uri,
+		Name:        source.name,
+		Description: source.description,
+		MIMEType:    "text/markdown",
+	}, docResourceHandler)
+	server.AddResource(&mcp.Resource{
+		URI:         tocURI(uri),
+		Name:        source.name + " Contents",
+		Description: "Table of contents of " + source.name + " with a URI for each section",
+		MIMEType:    "text/markdown",
+	}, tocResourceHandler)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: versionedURI(uri, "{version}"),
+		Name:        source.name + " (versioned)",
+		Description: source.description + ". Version is a Kuadrant release: " + strings.Join(releaseVersions(), ", "),
+		MIMEType:    "text/markdown",
+	}, docResourceHandler)
+}
 
-		resources = append(resources, &mcp.ServerResource{
-			Resource: &mcp.Resource{
-				URI:         uri,
-				Name:        src.name,
-				Description: src.description,
-				MIMEType:    "text/markdown",
-			},
-			Handler: createResourceHandler(src),
-		})
+// removeDocResources unregisters a document added by addDocResources
+func removeDocResources(server *mcp.Server, uri string) {
+	server.RemoveResources(uri, tocURI(uri))
+	server.RemoveResourceTemplates(versionedURI(uri, "{version}"))
+}
+
+// addKuadrantResources registers all MCP resources: each document and its
+// table of contents, a template per document for reading it at a pinned
+// Kuadrant release, and templates addressing individual sections
+func addKuadrantResources(server *mcp.Server) {
+	versions := strings.Join(releaseVersions(), ", ")
+
+	for uri, source := range sources.all() {
+		addDocResources(server, uri, source)
 	}
 
-	server.AddResources(resources...)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: "kuadrant://docs/{doc}#{section}",
+		Name:        "Documentation Section",
+		Description: "A single section of a document and its subsections, addressed by heading anchor as listed in kuadrant://toc/{doc}",
+		MIMEType:    "text/markdown",
+	}, sectionResourceHandler)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: "kuadrant://docs/{version}/{doc}#{section}",
+		Name:        "Documentation Section (versioned)",
+		Description: "A single section of a document at a Kuadrant release: " + versions,
+		MIMEType:    "text/markdown",
+	}, sectionResourceHandler)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: "kuadrant://toc/{version}/{doc}",
+		Name:        "Documentation Contents (versioned)",
+		Description: "Table of contents of a document at a Kuadrant release: " + versions,
+		MIMEType:    "text/markdown",
+	}, tocResourceHandler)
+
+	notifier.register(server)
 }
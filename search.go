@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// BM25 tuning parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// headingBoost counts heading terms this many times so matches in
+	// headings outrank passing mentions in section bodies
+	headingBoost = 3
+)
+
+type SearchDocsParams struct {
+	Query           string `json:"query" jsonschema:"Search terms or a natural language question"`
+	Limit           int    `json:"limit,omitempty" jsonschema:"Maximum number of sections to return (default: 5)"`
+	KuadrantVersion string `json:"kuadrantVersion,omitempty" jsonschema:"Kuadrant release whose docs to search (e.g. v1.2, default: latest)"`
+}
+
+// indexedSection is a searchable section of a documentation resource
+type indexedSection struct {
+	uri     string // resource URI the section belongs to
+	docName string
+	docSection
+	length int // number of terms, including heading boost
+}
+
+type posting struct {
+	section int // index into searchIndex.sections
+	freq    int
+}
+
+// searchIndex is an inverted index over the sections of every resource
+type searchIndex struct {
+	sections  []indexedSection
+	postings  map[string][]posting
+	avgLength float64
+	builtAt   time.Time
+}
+
+// searchIndexes holds one lazily built index per Kuadrant release
+type searchIndexes struct {
+	mu      sync.Mutex
+	indexes map[string]*searchIndex
+	// generation counts resets, so an index built from the documents
+	// before a reset isn't stored after it
+	generation int
+
+	// building collapses concurrent builds of a release's index
+	building singleflight.Group
+	build    func(context.Context, kuadrantRelease) *searchIndex
+}
+
+var docIndexes = &searchIndexes{
+	indexes: make(map[string]*searchIndex),
+	build:   buildSearchIndex,
+}
+
+// reset drops all indexes so they are rebuilt from the current documents
+func (s *searchIndexes) reset() {
+	s.mu.Lock()
+	s.indexes = make(map[string]*searchIndex)
+	s.generation++
+	s.mu.Unlock()
+}
+
+// get returns the index for a release, rebuilding it once the doc cache
+// entries it was built from have expired. The lock is only held to look
+// the index up and store it, so a slow build doesn't hold up searches of
+// other releases.
+func (s *searchIndexes) get(ctx context.Context, release kuadrantRelease) *searchIndex {
+	s.mu.Lock()
+	idx, ok := s.indexes[release.version]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && time.Since(idx.builtAt) < cache.ttl {
+		return idx
+	}
+
+	v, _, _ := s.building.Do(release.version, func() (interface{}, error) {
+		// detach from the caller so one cancelled search doesn't cut the
+		// build short for the others
+		idx := s.build(context.WithoutCancel(ctx), release)
+		s.mu.Lock()
+		if s.generation == generation {
+			s.indexes[release.version] = idx
+		}
+		s.mu.Unlock()
+		return idx, nil
+	})
+	return v.(*searchIndex)
+}
+
+// buildSearchIndex fetches every resource for a release and indexes its sections
+func buildSearchIndex(ctx context.Context, release kuadrantRelease) *searchIndex {
+	type fetched struct {
+		uri     string
+		source  docSource
+		content string
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []fetched
+	)
+	for uri, source := range sources.all() {
+		wg.Add(1)
+		go func(uri string, source docSource) {
+			defer wg.Done()
+			content, err := cache.fetch(ctx, source.rawURL(release), source.fallback)
+			if err != nil {
+				slog.WarnContext(ctx, "Skipping doc in search index", "uri", uri, "error", err)
+				return
+			}
+			mu.Lock()
+			results = append(results, fetched{uri: uri, source: source, content: content})
+			mu.Unlock()
+		}(uri, source)
+	}
+	wg.Wait()
+
+	// stable section order regardless of fetch completion order
+	sort.Slice(results, func(i, j int) bool { return results[i].uri < results[j].uri })
+
+	idx := &searchIndex{
+		postings: make(map[string][]posting),
+		builtAt:  time.Now(),
+	}
+	totalLength := 0
+	for _, r := range results {
+		uri := r.uri
+		if release.version != defaultKuadrantVersion {
+			uri = versionedURI(uri, release.version)
+		}
+		for _, section := range splitSections(r.content) {
+			freqs := make(map[string]int)
+			length := 0
+			for _, term := range tokenize(section.heading) {
+				freqs[term] += headingBoost
+				length += headingBoost
+			}
+			for _, term := range tokenize(section.body) {
+				freqs[term]++
+				length++
+			}
+			if length == 0 {
+				continue
+			}
+
+			id := len(idx.sections)
+			idx.sections = append(idx.sections, indexedSection{
+				uri:        uri,
+				docName:    r.source.name,
+				docSection: section,
+				length:     length,
+			})
+			for term, freq := range freqs {
+				idx.postings[term] = append(idx.postings[term], posting{section: id, freq: freq})
+			}
+			totalLength += length
+		}
+	}
+	if len(idx.sections) > 0 {
+		idx.avgLength = float64(totalLength) / float64(len(idx.sections))
+	}
+
+	slog.InfoContext(ctx, "Built search index", "sections", len(idx.sections), "docs", len(results), "kuadrant_version", release.version)
+	return idx
+}
+
+// searchResult is a scored section
+type searchResult struct {
+	section *indexedSection
+	score   float64
+}
+
+// search ranks sections against query using BM25
+func (idx *searchIndex) search(query string, limit int) []searchResult {
+	n := float64(len(idx.sections))
+	scores := make(map[int]float64)
+
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := 1 - bm25B + bm25B*float64(idx.sections[p.section].length)/idx.avgLength
+			scores[p.section] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	results := make([]searchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, searchResult{section: &idx.sections[id], score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].section.uri+results[i].section.anchor < results[j].section.uri+results[j].section.anchor
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// stopWords are common English words left out of the index
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "can": true, "do": true, "does": true, "for": true, "from": true, "how": true,
+	"i": true, "if": true, "in": true, "is": true, "it": true, "my": true, "of": true,
+	"on": true, "or": true, "so": true, "that": true, "the": true, "this": true, "to": true,
+	"use": true, "what": true, "when": true, "which": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize lowercases text and splits it into index terms
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
+
+// stem strips a plural "s" so "limits" matches "limit"
+func stem(term string) string {
+	if len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") {
+		return term[:len(term)-1]
+	}
+	return term
+}
+
+// snippet returns a short excerpt of body around the first query term it contains
+func snippet(body, query string, width int) string {
+	text := strings.Join(strings.Fields(body), " ")
+	lower := strings.ToLower(text)
+
+	start := 0
+	for _, term := range tokenize(query) {
+		if i := strings.Index(lower, term); i >= 0 {
+			start = i
+			break
+		}
+	}
+
+	start -= width / 4
+	if start < 0 || start >= len(text) {
+		start = 0
+	}
+	end := start + width
+	if end > len(text) {
+		end = len(text)
+	}
+	// avoid cutting multi-byte characters
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	excerpt := text[start:end]
+	if start > 0 {
+		excerpt = "..." + excerpt
+	}
+	if end < len(text) {
+		excerpt = excerpt + "..."
+	}
+	return excerpt
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func searchDocsHandler(ctx context.Context, params SearchDocsParams) (string, error) {
+	query := strings.TrimSpace(params.Query)
+	if query == "" {
+		return "Error: query is required", nil
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+
+	release, err := lookupRelease(params.KuadrantVersion)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	results := docIndexes.get(ctx, release).search(query, limit)
+	if len(results) == 0 {
+		return fmt.Sprintf("No documentation sections matched %q.", query), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d sections matching %q:\n", len(results), query)
+	for i, r := range results {
+		heading := r.section.heading
+		if heading == "" {
+			heading = "(introduction)"
+		}
+		uri := r.section.uri
+		if r.section.anchor != "" {
+			uri = uri + "#" + r.section.anchor
+		}
+		fmt.Fprintf(&b, "\n%d. %s > %s (score %.2f)\n", i+1, r.section.docName, heading, r.score)
+		fmt.Fprintf(&b, "   URI: %s\n", uri)
+		fmt.Fprintf(&b, "   %s\n", snippet(r.section.body, query, 240))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useDocs replaces the documentation sources with local files holding
+// docs, by URI, restoring them and the search indexes when the test ends
+func useDocs(t *testing.T, docs map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	mapping := make(map[string]docSource)
+	for uri, content := range docs {
+		name := strings.TrimPrefix(uri, "kuadrant://docs/")
+		path := filepath.Join(dir, name+".md")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		mapping[uri] = docSource{url: "file://" + path, name: name}
+	}
+	previous := sources.all()
+	sources.set(mapping)
+	docIndexes.reset()
+	t.Cleanup(func() {
+		sources.set(previous)
+		docIndexes.reset()
+	})
+}
+
+var testDocs = map[string]string{
+	"kuadrant://docs/rate-limiting": `# Rate limiting
+
+RateLimitPolicy protects APIs.
+
+## Limits
+
+Each limit has rates, a limit and a window. Limits are counted by Limitador.
+
+## Counters
+
+Counters split a limit per user, e.g. by auth.identity.sub.
+`,
+	"kuadrant://docs/auth": `# Authentication
+
+AuthPolicy authenticates requests with API keys or JWTs.
+
+## API keys
+
+API keys are Secrets selected by labels. A limit on failed logins is not supported.
+`,
+}
+
+func TestSearchIndexesBuildOutsideLock(t *testing.T) {
+	var builds atomic.Int32
+	release := make(chan struct{})
+	s := &searchIndexes{
+		indexes: make(map[string]*searchIndex),
+		build: func(_ context.Context, r kuadrantRelease) *searchIndex {
+			builds.Add(1)
+			if r.version == "v1.2" {
+				<-release
+			}
+			return &searchIndex{builtAt: time.Now()}
+		},
+	}
+
+	// a slow v1.2 build, with a second search waiting on it
+	var wg sync.WaitGroup
+	slow := make([]*searchIndex, 2)
+	for i := range slow {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slow[i] = s.get(context.Background(), kuadrantReleases["v1.2"])
+		}()
+	}
+
+	done := make(chan *searchIndex)
+	go func() { done <- s.get(context.Background(), kuadrantReleases["latest"]) }()
+	select {
+	case idx := <-done:
+		if idx == nil {
+			t.Fatal("no index for latest")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("searching latest waited for the v1.2 build")
+	}
+
+	close(release)
+	wg.Wait()
+	if slow[0] != slow[1] {
+		t.Error("concurrent searches of v1.2 built separate indexes")
+	}
+	if got := builds.Load(); got != 2 {
+		t.Errorf("got %d builds, want 2", got)
+	}
+
+	// stored and reused while fresh
+	if s.get(context.Background(), kuadrantReleases["v1.2"]) != slow[0] {
+		t.Error("v1.2 index was rebuilt while fresh")
+	}
+}
+
+func TestSearchIndexesResetDuringBuild(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := &searchIndexes{
+		indexes: make(map[string]*searchIndex),
+		build: func(context.Context, kuadrantRelease) *searchIndex {
+			close(started)
+			<-release
+			return &searchIndex{builtAt: time.Now()}
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		s.get(context.Background(), kuadrantReleases["latest"])
+		close(done)
+	}()
+	<-started
+	s.reset()
+	close(release)
+	<-done
+	if len(s.indexes) != 0 {
+		t.Error("index built before a reset was stored after it")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"How do I configure Rate Limits?", []string{"configure", "rate", "limit"}},
+		{"auth.identity.sub", []string{"auth", "identity", "sub"}},
+		{"GatewayClass gas bus", []string{"gatewayclass", "gas", "bus"}},
+		{"Limitador's v1.2 CRDs", []string{"limitador", "s", "v1", "2", "crd"}},
+		{"the and of", nil},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("padding ", 20) + "the window of a limit" + strings.Repeat(" padding", 20)
+	tests := []struct {
+		name, body, query string
+		width             int
+		want              string
+	}{
+		{"short body", "Limits have  rates\nand windows.", "window", 100, "Limits have rates and windows."},
+		{"around the first term", long, "window", 40, "...dding the window of a limit padding padd..."},
+		{"no term found", long, "gateway", 16, "padding padding ..."},
+		{"multi-byte characters", "éééé limit", "limit", 8, "...é limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.body, tt.query, tt.width); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	useDocs(t, testDocs)
+	idx := buildSearchIndex(context.Background(), kuadrantReleases["latest"])
+	if len(idx.sections) != 5 {
+		t.Fatalf("got %d sections, want 5", len(idx.sections))
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		// want is the URI and anchor of each result, best first
+		want []string
+	}{
+		// the heading boost ranks the Limits section above others
+		// mentioning limits
+		{"limits", 5, []string{"kuadrant://docs/rate-limiting#limits", "kuadrant://docs/rate-limiting#counters", "kuadrant://docs/auth#api-keys"}},
+		{"limits", 1, []string{"kuadrant://docs/rate-limiting#limits"}},
+		// "APIs" stems to "api"
+		{"API keys", 5, []string{"kuadrant://docs/auth#api-keys", "kuadrant://docs/auth#authentication", "kuadrant://docs/rate-limiting#rate-limiting"}},
+		{"counters per user", 5, []string{"kuadrant://docs/rate-limiting#counters"}},
+		{"what is the", 5, nil},
+		{"gateway", 5, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range idx.search(tt.query, tt.limit) {
+			got = append(got, r.section.uri+"#"+r.section.anchor)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q, %d) = %v, want %v", tt.query, tt.limit, got, tt.want)
+		}
+	}
+
+	versioned := buildSearchIndex(context.Background(), kuadrantReleases["v1.3"])
+	if results := versioned.search("limits", 1); len(results) != 1 || results[0].section.uri != "kuadrant://docs/v1.3/rate-limiting" {
+		t.Errorf("v1.3 results %v aren't under the versioned URI", results)
+	}
+}
+
+func TestSearchDocsHandler(t *testing.T) {
+	useDocs(t, testDocs)
+	tests := []struct {
+		params SearchDocsParams
+		want   []string
+	}{
+		{SearchDocsParams{Query: "window"}, []string{"Found 1 sections matching \"window\"", "1. rate-limiting > Limits", "URI: kuadrant://docs/rate-limiting#limits"}},
+		{SearchDocsParams{Query: "gateway"}, []string{"No documentation sections matched \"gateway\"."}},
+		{SearchDocsParams{Query: " "}, []string{"Error: query is required"}},
+		{SearchDocsParams{Query: "limits", KuadrantVersion: "v9"}, []string{"Error: unknown Kuadrant version \"v9\""}},
+	}
+	for _, tt := range tests {
+		out, err := searchDocsHandler(context.Background(), tt.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%+v: missing %q in:\n%s", tt.params, want, out)
+			}
+		}
+	}
+}
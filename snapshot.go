@@ -0,0 +1,713 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// snapshotMaxBytes caps how much of a snapshot is read, so a large or
+// malicious archive can't exhaust memory
+const snapshotMaxBytes = 256 << 20
+
+// snapshotDir is the directory tools taking a path, e.g. analyze_snapshot,
+// may read snapshots and other files from, set with -snapshot-dir. Reading
+// from disk is disabled when it's empty.
+var snapshotDir string
+
+var (
+	certificateKind = schema.GroupKind{Group: "cert-manager.io", Kind: "Certificate"}
+	podKind         = schema.GroupKind{Kind: "Pod"}
+	eventKind       = schema.GroupKind{Kind: "Event"}
+)
+
+// snapshotKinds are the kinds the checks read, reported when a snapshot
+// lacks them so the caller knows which checks couldn't run
+var snapshotKinds = append([]schema.GroupKind{
+	gatewayKind, httpRouteKind, dnsRecordKind, certificateKind,
+	kuadrantKind, limitadorKind, authorinoKind, deploymentKind, podKind, eventKind,
+}, policyKinds...)
+
+// severities orders findings, most urgent first
+var severities = []string{"critical", "warning", "info"}
+
+type AnalyzeSnapshotParams struct {
+	Path     string `json:"path,omitempty" jsonschema:"Directory or .tar, .tar.gz or .tgz archive of kubectl get -o yaml output, relative to the server's -snapshot-dir"`
+	Snapshot string `json:"snapshot,omitempty" jsonschema:"kubectl get -o yaml output to analyse instead of a path"`
+}
+
+// finding is one problem found in a snapshot
+type finding struct {
+	// Severity is critical, warning or info
+	Severity  string   `yaml:"severity"`
+	Check     string   `yaml:"check"`
+	Object    string   `yaml:"object"`
+	Summary   string   `yaml:"summary"`
+	Details   []string `yaml:"details,omitempty"`
+	NextSteps []string `yaml:"nextSteps,omitempty"`
+}
+
+// snapshotIndex groups a snapshot's objects by kind
+type snapshotIndex struct {
+	byKind map[schema.GroupKind][]*unstructured.Unstructured
+}
+
+func newSnapshotIndex(objects []*unstructured.Unstructured) *snapshotIndex {
+	idx := &snapshotIndex{byKind: make(map[schema.GroupKind][]*unstructured.Unstructured)}
+	for _, obj := range objects {
+		gk := obj.GroupVersionKind().GroupKind()
+		idx.byKind[gk] = append(idx.byKind[gk], obj)
+	}
+	return idx
+}
+
+func (s *snapshotIndex) all(kind schema.GroupKind) []*unstructured.Unstructured {
+	return s.byKind[kind]
+}
+
+// has reports whether the snapshot includes any objects of kind, so a
+// missing object can be told apart from a kind that wasn't collected
+func (s *snapshotIndex) has(kind schema.GroupKind) bool {
+	return len(s.byKind[kind]) > 0
+}
+
+func (s *snapshotIndex) find(kind schema.GroupKind, namespace, name string) *unstructured.Unstructured {
+	for _, obj := range s.byKind[kind] {
+		if obj.GetNamespace() == namespace && obj.GetName() == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+// snapshotChecks run in order over every snapshot
+var snapshotChecks = []func(*snapshotIndex) []finding{
+	checkPolicies,
+	checkPolicyTargets,
+	checkGateways,
+	checkRoutes,
+	checkCertificates,
+	checkDNSRecords,
+	checkComponents,
+	checkWorkloads,
+	checkEvents,
+}
+
+func analyzeSnapshotHandler(ctx context.Context, params AnalyzeSnapshotParams) (string, error) {
+	var (
+		objects []*unstructured.Unstructured
+		skipped []string
+		err     error
+	)
+	switch {
+	case params.Snapshot != "":
+		objects, err = decodeManifests(params.Snapshot)
+		if err != nil {
+			return fmt.Sprintf("Error: invalid snapshot: %v", err), nil
+		}
+	case params.Path != "":
+		objects, skipped, err = loadSnapshot(params.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+	default:
+		return "Error: path or snapshot is required", nil
+	}
+	if len(objects) == 0 {
+		return "Error: snapshot has no objects", nil
+	}
+
+	idx := newSnapshotIndex(objects)
+	var findings []finding
+	for _, check := range snapshotChecks {
+		findings = append(findings, check(idx)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return slices.Index(severities, findings[i].Severity) < slices.Index(severities, findings[j].Severity)
+	})
+
+	counts := map[string]int{"objects": len(objects)}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	var missing []string
+	for _, kind := range snapshotKinds {
+		if !idx.has(kind) {
+			missing = append(missing, kind.Kind)
+		}
+	}
+
+	report := map[string]interface{}{"summary": counts}
+	if len(findings) > 0 {
+		report["findings"] = findings
+	}
+	if len(missing) > 0 {
+		report["notInSnapshot"] = missing
+	}
+	if len(skipped) > 0 {
+		report["skippedFiles"] = skipped
+	}
+	return renderSummary(report)
+}
+
+// resolveSnapshotPath resolves path within snapshotDir, refusing paths
+// that escape it, including through symlinks
+func resolveSnapshotPath(path string) (string, error) {
+	if snapshotDir == "" {
+		return "", errors.New("reading snapshots from disk is disabled; start the server with -snapshot-dir, or pass the snapshot YAML instead")
+	}
+	root, err := filepath.EvalSymlinks(snapshotDir)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	// check before resolving too, so nothing is revealed about files
+	// outside the directory
+	if !within(root, path) {
+		return "", fmt.Errorf("%s is outside the snapshot directory", path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(root, resolved) {
+		return "", fmt.Errorf("%s is outside the snapshot directory", path)
+	}
+	return resolved, nil
+}
+
+// readSnapshotFile reads a single file under the snapshot directory
+func readSnapshotFile(path string) ([]byte, error) {
+	resolved, err := resolveSnapshotPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, not a file", path)
+	}
+	if info.Size() > snapshotMaxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, snapshotMaxBytes)
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// the file may have grown since it was checked
+	data, err := io.ReadAll(io.LimitReader(f, snapshotMaxBytes+1))
+	if err == nil && len(data) > snapshotMaxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, snapshotMaxBytes)
+	}
+	return data, err
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// loadSnapshot reads the objects in every YAML and JSON file in a
+// directory or archive. Files that don't parse are skipped and listed.
+func loadSnapshot(path string) ([]*unstructured.Unstructured, []string, error) {
+	path, err := resolveSnapshotPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		objects []*unstructured.Unstructured
+		skipped []string
+		read    int64
+	)
+	add := func(name string, r io.Reader) error {
+		data, err := io.ReadAll(io.LimitReader(r, snapshotMaxBytes-read+1))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		if read += int64(len(data)); read > snapshotMaxBytes {
+			return fmt.Errorf("snapshot is larger than %d MiB", snapshotMaxBytes>>20)
+		}
+		items, err := decodeManifests(string(data))
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", name, err))
+			return nil
+		}
+		objects = append(objects, items...)
+		return nil
+	}
+
+	switch {
+	case info.IsDir():
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			// symlinks are skipped so they can't lead outside the directory
+			if err != nil || !d.Type().IsRegular() || !isManifestFile(file) {
+				return err
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rel, _ := filepath.Rel(path, file)
+			return add(rel, f)
+		})
+	case isArchive(path):
+		err = readArchive(path, add)
+	default:
+		var f *os.File
+		if f, err = os.Open(path); err == nil {
+			err = add(filepath.Base(path), f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return objects, skipped, nil
+}
+
+// readArchive passes each manifest file in a tar archive, optionally
+// gzipped, to add
+func readArchive(path string, add func(string, io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		if header.Typeflag != tar.TypeReg || !isManifestFile(header.Name) {
+			continue
+		}
+		if err := add(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func isManifestFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func isArchive(name string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// objectName renders an object as Kind namespace/name
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + " " + obj.GetName()
+	}
+	return obj.GetKind() + " " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// conditionDetail renders a condition for a finding's details
+func conditionDetail(c *conditionSummary) string {
+	detail := fmt.Sprintf("%s=%s", c.Type, c.Status)
+	if c.Reason != "" {
+		detail += " (" + c.Reason + ")"
+	}
+	if c.Message != "" {
+		detail += ": " + c.Message
+	}
+	return detail
+}
+
+// notTrue returns the condition if it's present and not True
+func notTrue(conditions []conditionSummary, condType string) *conditionSummary {
+	c := findCondition(conditions, condType)
+	if c == nil || c.Status == "True" {
+		return nil
+	}
+	return c
+}
+
+// checkPolicies reports policies that aren't accepted or enforced, with
+// the diagnosis explain_status would give
+func checkPolicies(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, kind := range policyKinds {
+		for _, policy := range idx.all(kind) {
+			conditions := conditionsAt(policy.Object, "status", "conditions")
+			f := finding{Object: objectName(policy)}
+			var condition *conditionSummary
+			switch {
+			case findCondition(conditions, "Accepted") == nil:
+				f.Severity, f.Check = "info", "policy-no-status"
+				f.Summary = "Policy has no status; the operator hasn't reconciled it or isn't running"
+				f.NextSteps = []string{"Check the kuadrant-operator deployment is running and its logs"}
+			case notTrue(conditions, "Accepted") != nil:
+				condition = notTrue(conditions, "Accepted")
+				f.Severity, f.Check = "critical", "policy-not-accepted"
+			case notTrue(conditions, "Enforced") != nil:
+				condition = notTrue(conditions, "Enforced")
+				f.Severity, f.Check = "warning", "policy-not-enforced"
+			default:
+				continue
+			}
+			if condition != nil {
+				f.Details = []string{conditionDetail(condition)}
+				f.Summary = "Policy is " + policyState(conditions)
+				if info, ok := explainReason(kind.Kind, condition.Type, condition.Reason); ok {
+					f.Summary += ": " + info.Explanation
+					f.NextSteps = info.NextSteps
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// checkPolicyTargets reports policies whose Gateway or HTTPRoute target,
+// or the listener or rule named by its sectionName, isn't in the snapshot
+func checkPolicyTargets(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, kind := range policyKinds {
+		for _, policy := range idx.all(kind) {
+			for _, ref := range policyTargets(policy) {
+				gk := schema.GroupKind{Group: ref.Group, Kind: ref.Kind}
+				if gk != gatewayKind && gk != httpRouteKind {
+					continue
+				}
+				if !idx.has(gk) {
+					continue
+				}
+				target := idx.find(gk, ref.Namespace, ref.Name)
+				switch {
+				case target == nil:
+					findings = append(findings, finding{
+						Severity:  "critical",
+						Check:     "orphaned-target",
+						Object:    objectName(policy),
+						Summary:   fmt.Sprintf("Target %s %s/%s is not in the snapshot", ref.Kind, ref.Namespace, ref.Name),
+						NextSteps: []string{"Check spec.targetRef's group, kind and name, and that the target is in the policy's namespace"},
+					})
+				case ref.SectionName != "" && !hasSection(target, ref.SectionName):
+					findings = append(findings, finding{
+						Severity:  "critical",
+						Check:     "orphaned-target",
+						Object:    objectName(policy),
+						Summary:   fmt.Sprintf("Target %s %s/%s has no section %q", ref.Kind, ref.Namespace, ref.Name, ref.SectionName),
+						NextSteps: []string{"Check spec.targetRef.sectionName against the Gateway's listener names or the HTTPRoute's rule names"},
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// hasSection reports whether a Gateway has the listener, or an HTTPRoute
+// the rule, with the given name
+func hasSection(obj *unstructured.Unstructured, name string) bool {
+	field := "listeners"
+	if obj.GetKind() == httpRouteKind.Kind {
+		field = "rules"
+	}
+	items, _, _ := unstructured.NestedSlice(obj.Object, "spec", field)
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok && stringField(m, "name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkGateways(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, gateway := range idx.all(gatewayKind) {
+		conditions := conditionsAt(gateway.Object, "status", "conditions")
+		for _, condType := range []string{"Accepted", "Programmed"} {
+			if c := notTrue(conditions, condType); c != nil {
+				findings = append(findings, finding{
+					Severity:  "critical",
+					Check:     "gateway-not-ready",
+					Object:    objectName(gateway),
+					Summary:   "Gateway is not " + condType + ", so no traffic reaches its routes or policies",
+					Details:   []string{conditionDetail(c)},
+					NextSteps: []string{"Check the gatewayClassName is installed, and the gateway's proxy deployment and service"},
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// checkRoutes reports HTTPRoutes whose parent Gateway is missing or
+// hasn't accepted them
+func checkRoutes(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, route := range idx.all(httpRouteKind) {
+		parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+		for _, parent := range parents {
+			p, ok := parent.(map[string]interface{})
+			if !ok || !idx.has(gatewayKind) {
+				continue
+			}
+			if kind := stringField(p, "kind"); kind != "" && kind != gatewayKind.Kind {
+				continue
+			}
+			namespace := stringField(p, "namespace")
+			if namespace == "" {
+				namespace = route.GetNamespace()
+			}
+			if idx.find(gatewayKind, namespace, stringField(p, "name")) == nil {
+				findings = append(findings, finding{
+					Severity: "warning",
+					Check:    "orphaned-route",
+					Object:   objectName(route),
+					Summary:  fmt.Sprintf("Parent Gateway %s/%s is not in the snapshot", namespace, stringField(p, "name")),
+				})
+			}
+		}
+
+		statuses, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+		for _, status := range statuses {
+			s, ok := status.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			conditions := conditionsAt(s, "conditions")
+			for _, condType := range []string{"Accepted", "ResolvedRefs"} {
+				if c := notTrue(conditions, condType); c != nil {
+					findings = append(findings, finding{
+						Severity: "warning",
+						Check:    "route-not-accepted",
+						Object:   objectName(route),
+						Summary:  fmt.Sprintf("Route is not %s by parent %s", condType, stringField(s, "parentRef", "name")),
+						Details:  []string{conditionDetail(c)},
+					})
+					break
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func checkCertificates(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, cert := range idx.all(certificateKind) {
+		c := notTrue(conditionsAt(cert.Object, "status", "conditions"), "Ready")
+		if c == nil {
+			continue
+		}
+		findings = append(findings, finding{
+			Severity: "critical",
+			Check:    "certificate-not-ready",
+			Object:   objectName(cert),
+			Summary:  "Certificate is not ready, so listeners using its Secret can't serve TLS",
+			Details:  []string{conditionDetail(c)},
+			NextSteps: []string{
+				"Check the Certificate's CertificateRequests, Orders and Challenges",
+				fmt.Sprintf("Check issuer %s %s is ready", stringField(cert.Object, "spec", "issuerRef", "kind"), stringField(cert.Object, "spec", "issuerRef", "name")),
+			},
+		})
+	}
+	return findings
+}
+
+func checkDNSRecords(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, record := range idx.all(dnsRecordKind) {
+		c := notTrue(conditionsAt(record.Object, "status", "conditions"), "Ready")
+		if c == nil {
+			continue
+		}
+		findings = append(findings, finding{
+			Severity:  "warning",
+			Check:     "dnsrecord-not-ready",
+			Object:    objectName(record),
+			Summary:   fmt.Sprintf("DNSRecord for %s isn't published to the provider", stringField(record.Object, "spec", "rootHost")),
+			Details:   []string{conditionDetail(c)},
+			NextSteps: []string{"Check the provider credentials Secret and that a hosted zone matches the host"},
+		})
+	}
+	return findings
+}
+
+// checkComponents reports Kuadrant, Limitador and Authorino instances
+// that aren't ready
+func checkComponents(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, kind := range []schema.GroupKind{kuadrantKind, limitadorKind, authorinoKind} {
+		for _, obj := range idx.all(kind) {
+			c := notTrue(conditionsAt(obj.Object, "status", "conditions"), "Ready")
+			if c == nil {
+				continue
+			}
+			findings = append(findings, finding{
+				Severity: "critical",
+				Check:    "component-not-ready",
+				Object:   objectName(obj),
+				Summary:  kind.Kind + " is not ready; every policy depending on it is affected",
+				Details:  []string{conditionDetail(c)},
+			})
+		}
+	}
+	return findings
+}
+
+// checkWorkloads reports crashlooping pods and deployments without their
+// desired replicas ready
+func checkWorkloads(idx *snapshotIndex) []finding {
+	var findings []finding
+	for _, pod := range idx.all(podKind) {
+		statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+		for _, status := range statuses {
+			s, ok := status.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			waiting := stringField(s, "state", "waiting", "reason")
+			restarts := intField(s, "restartCount")
+			if waiting != "CrashLoopBackOff" && restarts < 5 {
+				continue
+			}
+			f := finding{
+				Severity: "warning",
+				Check:    "pod-restarting",
+				Object:   objectName(pod),
+				Summary:  fmt.Sprintf("Container %s has restarted %d times", stringField(s, "name"), restarts),
+			}
+			if waiting == "CrashLoopBackOff" {
+				f.Severity, f.Check = "critical", "pod-crashlooping"
+				f.Summary = fmt.Sprintf("Container %s is crashlooping after %d restarts", stringField(s, "name"), restarts)
+			}
+			if reason := stringField(s, "lastState", "terminated", "reason"); reason != "" {
+				f.Details = append(f.Details, fmt.Sprintf("last terminated: %s (exit code %d)", reason, intField(s, "lastState", "terminated", "exitCode")))
+			}
+			f.NextSteps = componentSteps(pod.GetName())
+			findings = append(findings, f)
+		}
+	}
+
+	for _, deployment := range idx.all(deploymentKind) {
+		// spec.replicas defaults to 1 when unset
+		want := int64(1)
+		if _, ok, _ := unstructured.NestedFieldNoCopy(deployment.Object, "spec", "replicas"); ok {
+			want = intField(deployment.Object, "spec", "replicas")
+		}
+		ready := intField(deployment.Object, "status", "readyReplicas")
+		if ready >= want {
+			continue
+		}
+		severity := "warning"
+		if ready == 0 {
+			severity = "critical"
+		}
+		findings = append(findings, finding{
+			Severity:  severity,
+			Check:     "deployment-unavailable",
+			Object:    objectName(deployment),
+			Summary:   fmt.Sprintf("%d/%d replicas ready", ready, want),
+			NextSteps: componentSteps(deployment.GetName()),
+		})
+	}
+	return findings
+}
+
+// componentSteps suggests where to look when a Kuadrant component's pods
+// are failing, by their name
+func componentSteps(name string) []string {
+	switch {
+	case strings.HasPrefix(name, "limitador"):
+		return []string{
+			"Check the Limitador logs for storage errors, e.g. an unreachable Redis in spec.storage",
+			"Check the limits in the Limitador ConfigMap parse; RateLimitPolicies are not enforced while it's down",
+		}
+	case strings.HasPrefix(name, "authorino"):
+		return []string{"Check the Authorino logs; AuthPolicies are not enforced while it's down"}
+	case strings.Contains(name, "operator"):
+		return []string{"Check the operator logs; policy status isn't updated while it's down"}
+	}
+	return []string{"Check the container logs and the pod's events"}
+}
+
+// checkEvents summarises Warning events, one finding per object and reason
+func checkEvents(idx *snapshotIndex) []finding {
+	type key struct{ object, reason string }
+	var (
+		order    []key
+		counts   = make(map[key]int64)
+		messages = make(map[key]string)
+	)
+	for _, event := range idx.all(eventKind) {
+		if stringField(event.Object, "type") != "Warning" {
+			continue
+		}
+		involved := stringField(event.Object, "involvedObject", "kind") + " " + event.GetNamespace() + "/" + stringField(event.Object, "involvedObject", "name")
+		k := key{involved, stringField(event.Object, "reason")}
+		if _, ok := counts[k]; !ok {
+			order = append(order, k)
+		}
+		counts[k] += max(intField(event.Object, "count"), 1)
+		messages[k] = stringField(event.Object, "message")
+	}
+
+	findings := make([]finding, 0, len(order))
+	for _, k := range order {
+		findings = append(findings, finding{
+			Severity: "info",
+			Check:    "warning-event",
+			Object:   k.object,
+			Summary:  fmt.Sprintf("%s (%d times)", k.reason, counts[k]),
+			Details:  []string{messages[k]},
+		})
+	}
+	return findings
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tarGz returns a gzipped tar archive of files
+func tarGz(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedKeys(files) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+const testGateways = `apiVersion: v1
+kind: List
+items:
+  - apiVersion: gateway.networking.k8s.io/v1
+    kind: Gateway
+    metadata:
+      name: external
+      namespace: gateways
+  - apiVersion: gateway.networking.k8s.io/v1
+    kind: Gateway
+    metadata:
+      name: internal
+      namespace: gateways
+`
+
+func TestReadSnapshotFile(t *testing.T) {
+	useSnapshotDir(t, map[string]string{"dump.json": `{"configs": []}`})
+	if err := os.Mkdir(filepath.Join(snapshotDir, "bundle"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// sparse, so it takes no space
+	large, err := os.Create(filepath.Join(snapshotDir, "large.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := large.Truncate(snapshotMaxBytes + 1); err != nil {
+		t.Fatal(err)
+	}
+	large.Close()
+
+	tests := []struct {
+		path   string
+		want   string
+		errMsg string
+	}{
+		{path: "dump.json", want: `{"configs": []}`},
+		{path: "large.json", errMsg: "large.json is larger than 268435456 bytes"},
+		{path: "bundle", errMsg: "bundle is a directory, not a file"},
+		{path: "../dump.json", errMsg: "is outside the snapshot directory"},
+	}
+	for _, tt := range tests {
+		data, err := readSnapshotFile(tt.path)
+		switch {
+		case tt.errMsg != "":
+			if err == nil || !strings.HasSuffix(err.Error(), tt.errMsg) {
+				t.Errorf("readSnapshotFile(%q) error %v, want %q", tt.path, err, tt.errMsg)
+			}
+		case err != nil:
+			t.Errorf("readSnapshotFile(%q) unexpected error %v", tt.path, err)
+		case string(data) != tt.want:
+			t.Errorf("readSnapshotFile(%q) = %q, want %q", tt.path, data, tt.want)
+		}
+	}
+
+	snapshotDir = ""
+	if _, err := readSnapshotFile("dump.json"); err == nil || !strings.HasPrefix(err.Error(), "reading snapshots from disk is disabled") {
+		t.Errorf("error %v without -snapshot-dir", err)
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	files := map[string]string{
+		"gateways.yaml": testGateways,
+		"route.json":    `{"apiVersion": "gateway.networking.k8s.io/v1", "kind": "HTTPRoute", "metadata": {"name": "store", "namespace": "shop"}}`,
+		"broken.yaml":   "kind: [",
+		"notes.txt":     "not a manifest",
+	}
+	useSnapshotDir(t, map[string]string{"bundle.tar.gz": tarGz(t, files)})
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(snapshotDir, "bundle"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(snapshotDir, "bundle", name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{"bundle", "bundle.tar.gz", "bundle/gateways.yaml"} {
+		t.Run(path, func(t *testing.T) {
+			objects, skipped, err := loadSnapshot(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, obj := range objects {
+				names = append(names, objectName(obj))
+			}
+			want := []string{"Gateway gateways/external", "Gateway gateways/internal", "HTTPRoute shop/store"}
+			if path == "bundle/gateways.yaml" {
+				want = want[:2]
+			}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("objects = %v, want %v", names, want)
+			}
+			if path != "bundle/gateways.yaml" && (len(skipped) != 1 || !strings.HasPrefix(skipped[0], "broken.yaml: ")) {
+				t.Errorf("skipped = %v, want broken.yaml", skipped)
+			}
+		})
+	}
+}
+
+func TestSnapshotChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    func(*snapshotIndex) []finding
+		snapshot string
+		// want is the severity, check and summary of each finding
+		want []string
+	}{
+		{
+			name:  "deployment without replicas defaults to one",
+			check: checkWorkloads,
+			snapshot: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: limitador-limitador, namespace: kuadrant-system}
+status: {}
+`,
+			want: []string{"critical deployment-unavailable 0/1 replicas ready"},
+		},
+		{
+			name:  "deployment partly ready",
+			check: checkWorkloads,
+			snapshot: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: authorino, namespace: kuadrant-system}
+spec: {replicas: 3}
+status: {readyReplicas: 2}
+`,
+			want: []string{"warning deployment-unavailable 2/3 replicas ready"},
+		},
+		{
+			name:  "deployment scaled to zero",
+			check: checkWorkloads,
+			snapshot: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: authorino, namespace: kuadrant-system}
+spec: {replicas: 0}
+status: {}
+`,
+		},
+		{
+			name:  "crashlooping and restarting pods",
+			check: checkWorkloads,
+			snapshot: `apiVersion: v1
+kind: Pod
+metadata: {name: limitador-abc, namespace: kuadrant-system}
+status:
+  containerStatuses:
+    - name: limitador
+      restartCount: 7
+      state: {waiting: {reason: CrashLoopBackOff}}
+    - name: sidecar
+      restartCount: 5
+    - name: healthy
+      restartCount: 1
+`,
+			want: []string{
+				"critical pod-crashlooping Container limitador is crashlooping after 7 restarts",
+				"warning pod-restarting Container sidecar has restarted 5 times",
+			},
+		},
+		{
+			name:  "policy conditions",
+			check: checkPolicies,
+			snapshot: `apiVersion: kuadrant.io/v1
+kind: RateLimitPolicy
+metadata: {name: new, namespace: shop}
+---
+apiVersion: kuadrant.io/v1
+kind: RateLimitPolicy
+metadata: {name: enforced, namespace: shop}
+status: {conditions: [{type: Accepted, status: "True"}, {type: Enforced, status: "True"}]}
+---
+apiVersion: kuadrant.io/v1
+kind: AuthPolicy
+metadata: {name: unenforced, namespace: shop}
+status: {conditions: [{type: Accepted, status: "True"}, {type: Enforced, status: "False", reason: Unknown}]}
+`,
+			want: []string{
+				"warning policy-not-enforced Policy is NotEnforced (Unknown): The policy is accepted but its AuthConfig isn't confirmed ready in Authorino yet.",
+				"info policy-no-status Policy has no status; the operator hasn't reconciled it or isn't running",
+			},
+		},
+		{
+			name:  "policy targets",
+			check: checkPolicyTargets,
+			snapshot: testGateways + `---
+apiVersion: kuadrant.io/v1
+kind: DNSPolicy
+metadata: {name: dns, namespace: gateways}
+spec:
+  targetRef: {group: gateway.networking.k8s.io, kind: Gateway, name: external, sectionName: https}
+---
+apiVersion: kuadrant.io/v1
+kind: TLSPolicy
+metadata: {name: tls, namespace: gateways}
+spec:
+  targetRef: {group: gateway.networking.k8s.io, kind: Gateway, name: missing}
+---
+apiVersion: kuadrant.io/v1
+kind: RateLimitPolicy
+metadata: {name: limits, namespace: shop}
+spec:
+  targetRef: {group: gateway.networking.k8s.io, kind: HTTPRoute, name: store}
+`,
+			want: []string{
+				`critical orphaned-target Target Gateway gateways/external has no section "https"`,
+				"critical orphaned-target Target Gateway gateways/missing is not in the snapshot",
+			},
+		},
+		{
+			name:  "route parents",
+			check: checkRoutes,
+			snapshot: testGateways + `---
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata: {name: store, namespace: shop}
+spec:
+  parentRefs: [{name: external, namespace: gateways}, {name: external}]
+status:
+  parents:
+    - parentRef: {name: external}
+      conditions: [{type: Accepted, status: "False", reason: NotAllowedByListeners}]
+`,
+			want: []string{
+				"warning orphaned-route Parent Gateway shop/external is not in the snapshot",
+				"warning route-not-accepted Route is not Accepted by parent external",
+			},
+		},
+		{
+			name:  "warning events are aggregated",
+			check: checkEvents,
+			snapshot: `apiVersion: v1
+kind: Event
+metadata: {name: a, namespace: shop}
+type: Warning
+reason: FailedMount
+message: first
+count: 3
+involvedObject: {kind: Pod, name: store}
+---
+apiVersion: v1
+kind: Event
+metadata: {name: b, namespace: shop}
+type: Warning
+reason: FailedMount
+message: second
+involvedObject: {kind: Pod, name: store}
+---
+apiVersion: v1
+kind: Event
+metadata: {name: c, namespace: shop}
+type: Normal
+reason: Scheduled
+involvedObject: {kind: Pod, name: store}
+`,
+			want: []string{"info warning-event FailedMount (4 times)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := decodeManifests(tt.snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range tt.check(newSnapshotIndex(objects)) {
+				got = append(got, f.Severity+" "+f.Check+" "+f.Summary)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestAnalyzeSnapshotHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        AnalyzeSnapshotParams
+		summary       map[string]int
+		notInSnapshot []string
+		errMsg        string
+	}{
+		{
+			name:          "pasted snapshot",
+			params:        AnalyzeSnapshotParams{Snapshot: testGateways},
+			summary:       map[string]int{"objects": 2},
+			notInSnapshot: []string{"HTTPRoute", "DNSRecord", "Certificate", "Kuadrant", "Limitador", "Authorino", "Deployment", "Pod", "Event", "AuthPolicy", "RateLimitPolicy", "TokenRateLimitPolicy", "DNSPolicy", "TLSPolicy"},
+		},
+		{
+			name:   "empty snapshot",
+			params: AnalyzeSnapshotParams{Snapshot: "apiVersion: v1\nkind: List\nitems: []\n"},
+			errMsg: "Error: snapshot has no objects",
+		},
+		{
+			name:   "path without -snapshot-dir",
+			params: AnalyzeSnapshotParams{Path: "bundle"},
+			errMsg: "Error: reading snapshots from disk is disabled",
+		},
+		{
+			name:   "nothing given",
+			errMsg: "Error: path or snapshot is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := analyzeSnapshotHandler(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errMsg != "" {
+				if !strings.HasPrefix(out, tt.errMsg) {
+					t.Fatalf("got %q, want prefix %q", out, tt.errMsg)
+				}
+				return
+			}
+			var result struct {
+				Summary       map[string]int `yaml:"summary"`
+				NotInSnapshot []string       `yaml:"notInSnapshot"`
+			}
+			if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if !reflect.DeepEqual(result.Summary, tt.summary) {
+				t.Errorf("summary = %v, want %v", result.Summary, tt.summary)
+			}
+			if !reflect.DeepEqual(result.NotInSnapshot, tt.notInSnapshot) {
+				t.Errorf("notInSnapshot = %v, want %v", result.NotInSnapshot, tt.notInSnapshot)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultTenantHeader selects a tenant when the request's identity doesn't
+const defaultTenantHeader = "X-Kuadrant-Tenant"
+
+// tenantConfig is one team's conventions on a shared server
+type tenantConfig struct {
+	Name string `yaml:"name"`
+	// Identities are the authenticated users (token identity, JWT subject
+	// or client certificate common name) that belong to the tenant. When
+	// set, only they can use it.
+	Identities []string `yaml:"identities"`
+	// Tools limits the tools the tenant can see and call, empty allows all
+	Tools []string `yaml:"tools"`
+	// AllowedNamespaces are the namespaces the tenant can apply to and read
+	// with the cluster tools, empty allows all. Unlike namespace, which is
+	// only a default, it's enforced.
+	AllowedNamespaces []string `yaml:"allowedNamespaces"`
+
+	toolDefaults `yaml:",inline"`
+}
+
+// tenantsConfig is the file passed with -tenants-config
+type tenantsConfig struct {
+	// Header names the tenant for requests whose identity isn't mapped to one
+	Header string `yaml:"header"`
+	// Default is the tenant for requests that don't select one; if empty
+	// they are rejected. The stdio transport always uses it.
+	Default string         `yaml:"default"`
+	Tenants []tenantConfig `yaml:"tenants"`
+}
+
+// byName returns the named tenant, or nil
+func (c *tenantsConfig) byName(name string) *tenantConfig {
+	for i := range c.Tenants {
+		if c.Tenants[i].Name == name {
+			return &c.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// allowsTool reports whether the tenant can use the named tool
+func (t *tenantConfig) allowsTool(name string) bool {
+	return len(t.Tools) == 0 || slices.Contains(t.Tools, name)
+}
+
+// tenantNamespaces returns the namespaces the caller's tenant is limited
+// to, or nil if it can use all of them
+func tenantNamespaces(ctx context.Context) []string {
+	if tenant, _ := ctx.Value(tenantKey{}).(*tenantConfig); tenant != nil {
+		return tenant.AllowedNamespaces
+	}
+	return nil
+}
+
+// addTool registers a tool on server if the tenant allows it. Handlers
+// find the tenant and its defaults in their context. When hasDefaults is
+// set, parameters with a default are no longer required by the tool's input
+// schema and their descriptions name the default.
+func addTool[P any](server *mcp.Server, tenant *tenantConfig, defaults toolDefaults, tool *mcp.Tool, handler func(context.Context, P) (string, error), hasDefaults bool) {
+	if !tenant.allowsTool(tool.Name) {
+		return
+	}
+
+	if hasDefaults {
+		schema, err := jsonschema.For[P](&jsonschema.ForOptions{})
+		if err != nil {
+			panic(fmt.Sprintf("schema for %s: %v", tool.Name, err))
+		}
+		for param, value := range defaults.described() {
+			prop, ok := schema.Properties[param]
+			if !ok {
+				continue
+			}
+			schema.Required = slices.DeleteFunc(schema.Required, func(r string) bool { return r == param })
+			desc, _, _ := strings.Cut(prop.Description, " (default: ")
+			prop.Description = strings.TrimSpace(desc + " (default: " + value + ")")
+		}
+		tool.InputSchema = schema
+	}
+
+	next := handler
+	handler = func(ctx context.Context, params P) (string, error) {
+		ctx = context.WithValue(withToolDefaults(ctx, defaults), tenantKey{}, tenant)
+		return next(ctx, params)
+	}
+	mcp.AddTool(server, tool, textTool(handler))
+}
+
+// loadTenantsConfig reads and validates a tenants file
+func loadTenantsConfig(path string) (*tenantsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tenants config: %w", err)
+	}
+	var cfg tenantsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing tenants config %s: %w", path, err)
+	}
+	if cfg.Header == "" {
+		cfg.Header = defaultTenantHeader
+	}
+
+	names := make(map[string]bool)
+	identities := make(map[string]string)
+	for i, tenant := range cfg.Tenants {
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("tenants[%d]: name is required", i)
+		}
+		if names[tenant.Name] {
+			return nil, fmt.Errorf("tenants[%d]: duplicate tenant %q", i, tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		for _, identity := range tenant.Identities {
+			if other, ok := identities[identity]; ok {
+				return nil, fmt.Errorf("tenant %q: identity %q already belongs to tenant %q", tenant.Name, identity, other)
+			}
+			identities[identity] = tenant.Name
+		}
+		for _, tool := range tenant.Tools {
+			if !slices.Contains(toolNames, tool) {
+				return nil, fmt.Errorf("tenant %q: unknown tool %q", tenant.Name, tool)
+			}
+		}
+		if err := tenant.toolDefaults.validate(); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", tenant.Name, err)
+		}
+		if tenant.Namespace != "" && len(tenant.AllowedNamespaces) > 0 && !slices.Contains(tenant.AllowedNamespaces, tenant.Namespace) {
+			return nil, fmt.Errorf("tenant %q: namespace %q is not in allowedNamespaces", tenant.Name, tenant.Namespace)
+		}
+		cfg.Tenants[i] = tenant
+	}
+	if cfg.Default != "" && !names[cfg.Default] {
+		return nil, fmt.Errorf("default tenant %q is not defined", cfg.Default)
+	}
+	return &cfg, nil
+}
+
+// tenantRouter hands each HTTP request the server instance of its tenant,
+// building instances on first use
+type tenantRouter struct {
+	cfg       *tenantsConfig
+	newServer func(*tenantConfig) *mcp.Server
+
+	mu      sync.Mutex
+	servers map[string]*mcp.Server
+}
+
+type tenantKey struct{}
+
+func newTenantRouter(cfg *tenantsConfig, newServer func(*tenantConfig) *mcp.Server) *tenantRouter {
+	return &tenantRouter{cfg: cfg, newServer: newServer, servers: make(map[string]*mcp.Server)}
+}
+
+// resolve picks the tenant for a request: the one the authenticated
+// identity belongs to, otherwise the one named by the tenant header,
+// otherwise the default
+func (t *tenantRouter) resolve(r *http.Request) (*tenantConfig, error) {
+	identity := requestIdentity(r)
+	requested := r.Header.Get(t.cfg.Header)
+
+	if identity != "" {
+		for i := range t.cfg.Tenants {
+			tenant := &t.cfg.Tenants[i]
+			if !slices.Contains(tenant.Identities, identity) {
+				continue
+			}
+			if requested != "" && requested != tenant.Name {
+				return nil, fmt.Errorf("%s belongs to tenant %q, not %q", identity, tenant.Name, requested)
+			}
+			return tenant, nil
+		}
+	}
+
+	name := requested
+	if name == "" {
+		name = t.cfg.Default
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no tenant selected, set the %s header", t.cfg.Header)
+	}
+	tenant := t.cfg.byName(name)
+	if tenant == nil {
+		return nil, fmt.Errorf("unknown tenant %q", name)
+	}
+	if len(tenant.Identities) > 0 && !slices.Contains(tenant.Identities, identity) {
+		return nil, fmt.Errorf("not a member of tenant %q", name)
+	}
+	return tenant, nil
+}
+
+// middleware rejects requests that don't resolve to a tenant and records
+// the tenant for server
+func (t *tenantRouter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := t.resolve(r)
+		if err != nil {
+			slog.Warn("Rejected request", "error", err, "identity", requestIdentity(r))
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+	})
+}
+
+// server returns the server instance for the request's tenant, for use as
+// the SSE and StreamableHTTP server factory
+func (t *tenantRouter) server(r *http.Request) *mcp.Server {
+	tenant, _ := r.Context().Value(tenantKey{}).(*tenantConfig)
+	if tenant == nil {
+		return nil
+	}
+	return t.get(tenant)
+}
+
+// get returns the tenant's server instance, building it on first use
+func (t *tenantRouter) get(tenant *tenantConfig) *mcp.Server {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	server, ok := t.servers[tenant.Name]
+	if !ok {
+		server = t.newServer(tenant)
+		t.servers[tenant.Name] = server
+		slog.Info("Created server for tenant", "tenant", tenant.Name)
+	}
+	return server
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const testTenants = `header: X-Team
+default: platform
+tenants:
+  - name: shop
+    identities: [alice]
+    tools: [create_gateway, create_httproute]
+    namespace: shop
+    labels: {team: shop}
+  - name: platform
+    namespace: gateways
+`
+
+func TestLoadTenantsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		header  string
+		tenants int
+		errMsg  string
+	}{
+		{name: "tenants", config: testTenants, header: "X-Team", tenants: 2},
+		{name: "default header", config: "tenants:\n  - name: shop\n", header: defaultTenantHeader, tenants: 1},
+		{name: "no name", config: "tenants:\n  - namespace: shop\n", errMsg: "tenants[0]: name is required"},
+		{name: "duplicate tenant", config: "tenants:\n  - name: shop\n  - name: shop\n", errMsg: `tenants[1]: duplicate tenant "shop"`},
+		{
+			name:   "shared identity",
+			config: "tenants:\n  - name: shop\n    identities: [alice]\n  - name: platform\n    identities: [alice]\n",
+			errMsg: `tenant "platform": identity "alice" already belongs to tenant "shop"`,
+		},
+		{name: "unknown tool", config: "tenants:\n  - name: shop\n    tools: [delete_cluster]\n", errMsg: `tenant "shop": unknown tool "delete_cluster"`},
+		{
+			name:   "invalid defaults",
+			config: "tenants:\n  - name: shop\n    issuerRef: {name: letsencrypt}\n",
+			errMsg: `tenant "shop": issuerRef must have a kind and name`,
+		},
+		{
+			name:   "namespace not allowed",
+			config: "tenants:\n  - name: shop\n    namespace: shop\n    allowedNamespaces: [team-b]\n",
+			errMsg: `tenant "shop": namespace "shop" is not in allowedNamespaces`,
+		},
+		{name: "undefined default", config: "default: ops\ntenants:\n  - name: shop\n", errMsg: `default tenant "ops" is not defined`},
+		{name: "not YAML", config: "tenants: [", errMsg: "parsing tenants config "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTenantsConfig(writeTestFile(t, "tenants.yaml", tt.config))
+			if tt.errMsg != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.errMsg) {
+					t.Fatalf("error %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Header != tt.header || len(cfg.Tenants) != tt.tenants {
+				t.Errorf("header %s with %d tenants, want %s with %d", cfg.Header, len(cfg.Tenants), tt.header, tt.tenants)
+			}
+		})
+	}
+}
+
+func TestTenantRouterResolve(t *testing.T) {
+	cfg, err := loadTenantsConfig(writeTestFile(t, "tenants.yaml", testTenants))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := loadTokens(writeTestFile(t, "tokens", "secret-a alice\nsecret-b bob\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTenantRouter(cfg, func(tenant *tenantConfig) *mcp.Server {
+		return mcp.NewServer(&mcp.Implementation{Name: tenant.Name}, nil)
+	})
+	handler := auth.RequireBearerToken(tokens.verify, nil)(router.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if router.server(r) == nil {
+			t.Error("no server for the request")
+		}
+		w.Write([]byte(r.Context().Value(tenantKey{}).(*tenantConfig).Name))
+	})))
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		code   int
+		// want is the tenant, or the start of the rejection
+		want string
+	}{
+		{name: "identity's tenant", token: "secret-a", code: http.StatusOK, want: "shop"},
+		{name: "identity's tenant requested", token: "secret-a", header: "shop", code: http.StatusOK, want: "shop"},
+		{name: "identity requests another tenant", token: "secret-a", header: "platform", code: http.StatusForbidden, want: `alice belongs to tenant "shop", not "platform"`},
+		{name: "default tenant", token: "secret-b", code: http.StatusOK, want: "platform"},
+		{name: "tenant restricted to its identities", token: "secret-b", header: "shop", code: http.StatusForbidden, want: `not a member of tenant "shop"`},
+		{name: "unknown tenant", token: "secret-b", header: "ops", code: http.StatusForbidden, want: `unknown tenant "ops"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.header != "" {
+				req.Header.Set("X-Team", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body.String(), tt.code, tt.want)
+			}
+		})
+	}
+
+	// each tenant's server is built once
+	shop := cfg.byName("shop")
+	if router.get(shop) != router.get(shop) {
+		t.Error("the tenant's server was built twice")
+	}
+}
+
+func TestTenantRouterNoDefault(t *testing.T) {
+	router := newTenantRouter(&tenantsConfig{Header: defaultTenantHeader, Tenants: []tenantConfig{{Name: "shop"}}}, nil)
+	_, err := router.resolve(httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if err == nil || err.Error() != "no tenant selected, set the X-Kuadrant-Tenant header" {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestNewServerForTenant(t *testing.T) {
+	cfg, err := loadTenantsConfig(writeTestFile(t, "tenants.yaml", testTenants))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := newServer(cfg.byName("shop")).Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+		if tool.Name != "create_gateway" {
+			continue
+		}
+		schema := tool.InputSchema.(map[string]interface{})
+		if required, _ := schema["required"].([]interface{}); len(required) != 1 || required[0] != "name" {
+			t.Errorf("create_gateway requires %v, want only name", schema["required"])
+		}
+		namespace := schema["properties"].(map[string]interface{})["namespace"].(map[string]interface{})
+		if !strings.HasSuffix(namespace["description"].(string), " (default: shop)") {
+			t.Errorf("namespace description = %q", namespace["description"])
+		}
+	}
+	if strings.Join(names, ",") != "create_gateway,create_httproute" {
+		t.Errorf("tools = %v, want the tenant's", names)
+	}
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "create_gateway", Arguments: map[string]interface{}{"name": "external"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := result.Content[0].(*mcp.TextContent).Text
+	for _, want := range []string{"namespace: shop", "team: shop"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("missing %q in:\n%s", want, manifest)
+		}
+	}
+}
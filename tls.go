@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certReloader serves a TLS certificate and client CA bundle from disk,
+// picking up renewed files (e.g. from cert-manager) without a restart
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string // optional client CA bundle
+	clientAuth tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertReloader(certFile, keyFile, caFile string, clientAuth tls.ClientAuthType) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, clientAuth: clientAuth}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the certificate, key and client CA, replacing the current ones
+// only if all of them are valid
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.mu.Unlock()
+	return nil
+}
+
+// fileModTimes returns a key that changes whenever any of the files do
+func (r *certReloader) fileModTimes() string {
+	var times []string
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times = append(times, info.ModTime().String())
+		} else {
+			times = append(times, "")
+		}
+	}
+	return strings.Join(times, "|")
+}
+
+// tlsConfig returns a server config that uses the current files for every
+// new connection
+func (r *certReloader) tlsConfig() *tls.Config {
+	// the config returned per connection replaces the server's, so it
+	// needs the ALPN protocols for HTTP/2 to be negotiated
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	config := base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		config := base.Clone()
+		config.Certificates = []tls.Certificate{*r.cert}
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = r.clientAuth
+		return config, nil
+	}
+	return config
+}
+
+// watch reloads the files every interval if they have changed, keeping the
+// previous certificate if the new files are invalid or half written
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	modTimes := r.fileModTimes()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := r.fileModTimes()
+		if current == modTimes {
+			continue
+		}
+		modTimes = current
+
+		if err := r.load(); err != nil {
+			slog.Error("Failed to reload TLS certificate", "cert", r.certFile, "error", err)
+			continue
+		}
+		slog.Info("Reloaded TLS certificate", "cert", r.certFile)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for localhost named cn,
+// and its key, to dir, returning the certificate
+func writeTestCert(t *testing.T, dir, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "tls.key"), "EC PRIVATE KEY", keyDER)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedCN returns the common name of the certificate a new connection
+// would be served
+func servedCN(t *testing.T, r *certReloader) string {
+	t.Helper()
+	config, err := r.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "first")
+	r, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", tls.NoClientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.watch(ctx, 10*time.Millisecond)
+	// let watch record the files' current modification times
+	time.Sleep(50 * time.Millisecond)
+
+	// renewed files are picked up
+	writeTestCert(t, dir, "second")
+	touch(t, dir, time.Now().Add(time.Minute))
+	waitFor(t, func() bool { return servedCN(t, r) == "second" })
+
+	// files that don't load, e.g. half written, keep the current certificate
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir, time.Now().Add(2*time.Minute))
+	if err := r.load(); err == nil {
+		t.Fatal("loading a truncated certificate succeeded")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if cn := servedCN(t, r); cn != "second" {
+		t.Errorf("serving %s after an invalid renewal, want second", cn)
+	}
+
+	// and the next valid files replace it
+	writeTestCert(t, dir, "third")
+	touch(t, dir, time.Now().Add(3*time.Minute))
+	waitFor(t, func() bool { return servedCN(t, r) == "third" })
+}
+
+func TestCertReloaderClientCA(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "server")
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), caFile, tls.RequireAndVerifyClientCert)
+	if err == nil || err.Error() != "no certificates found in client CA "+caFile {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestCertReloaderHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeTestCert(t, dir, "server")
+	r, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", tls.NoClientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+		TLSConfig: r.tlsConfig(),
+	}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("negotiated %s, want HTTP/2", resp.Proto)
+	}
+}
+
+// touch sets the modification time of the files in dir
+func touch(t *testing.T, dir string, at time.Time) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := os.Chtimes(filepath.Join(dir, e.Name()), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitFor polls cond until it's true or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
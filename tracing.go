@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans through the global provider, which is a no-op until
+// setupTracing installs an exporter
+var tracer = otel.Tracer("github.com/jasonmadigan/kuadrant-mcp-server")
+
+// setupTracing installs a tracer provider exporting spans with the given
+// exporter: "otlp" (OTLP over HTTP, configured with the standard
+// OTEL_EXPORTER_OTLP_* variables), "console" to write them to stderr, or
+// "none". The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	case "console", "stdout":
+		// stdout carries the stdio transport
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q (want otlp, console or none)", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "kuadrant-mcp-server"),
+			attribute.String("service.version", serverVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a span for every MCP request. Over the
+// StreamableHTTP transport the span continues the trace from the
+// traceparent header of the HTTP request carrying it.
+func tracingMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(extra.Header))
+		}
+
+		name := method
+		attrs := []attribute.KeyValue{attribute.String("mcp.method.name", method)}
+		switch params := req.GetParams().(type) {
+		case *mcp.CallToolParamsRaw:
+			name = method + " " + params.Name
+			attrs = append(attrs, attribute.String("gen_ai.tool.name", params.Name))
+		case *mcp.ReadResourceParams:
+			attrs = append(attrs, attribute.String("mcp.resource.uri", params.URI))
+		}
+		if session := req.GetSession(); session != nil && session.ID() != "" {
+			attrs = append(attrs, attribute.String("mcp.session.id", session.ID()))
+		}
+
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		result, err := next(ctx, method, req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if _, ok := req.GetParams().(*mcp.CallToolParamsRaw); ok && toolOutcome(result, nil) == "error" {
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		return result, err
+	}
+}
+
+// traceLogAttrs returns the IDs of the span in ctx, for correlating log
+// lines with traces
+func traceLogAttrs(ctx context.Context) []slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []slog.Attr{
+		slog.String("trace_id", sc.TraceID().String()),
+		slog.String("span_id", sc.SpanID().String()),
+	}
+}
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerTransport sets a header on every request it sends
+type headerTransport struct {
+	key, value string
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSetupTracing(t *testing.T) {
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+	ctx := context.Background()
+
+	shutdown, err := setupTracing(ctx, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(ctx); err != nil {
+		t.Errorf("shutting down with no exporter: %v", err)
+	}
+	if otel.GetTracerProvider() != oldProvider {
+		t.Error("none installed a tracer provider")
+	}
+
+	if _, err := setupTracing(ctx, "jaeger"); err == nil || err.Error() != `invalid trace exporter "jaeger" (want otlp, console or none)` {
+		t.Errorf("error %v", err)
+	}
+
+	shutdown, err = setupTracing(ctx, "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); !ok {
+		t.Errorf("console installed %T", otel.GetTracerProvider())
+	}
+	if fields := otel.GetTextMapPropagator().Fields(); len(fields) < 2 {
+		t.Errorf("propagator fields %v, want traceparent and baggage", fields)
+	}
+	if err := shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	oldTracer, oldPropagator := tracer, otel.GetTextMapPropagator()
+	tracer = provider.Tracer("test")
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tracer = oldTracer
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "kuadrant-mcp"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "lookup"}, func(ctx context.Context, _ *mcp.CallToolRequest, p struct {
+		Name string `json:"name,omitempty"`
+	}) (*mcp.CallToolResult, any, error) {
+		// handlers' own spans are children of the request's
+		_, span := tracer.Start(ctx, "kube get")
+		span.End()
+		text := "gateway " + p.Name
+		if p.Name == "" {
+			text = "Error: name is required"
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}, nil, nil
+	})
+	server.AddResource(&mcp.Resource{URI: "kuadrant://docs/authpolicy", Name: "authpolicy"},
+		func(context.Context, *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: "kuadrant://docs/authpolicy", Text: "# AuthPolicy"}}}, nil
+		})
+	server.AddReceivingMiddleware(tracingMiddleware)
+	ts := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	defer ts.Close()
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := context.Background()
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, &mcp.StreamableClientTransport{
+		Endpoint:   ts.URL,
+		HTTPClient: &http.Client{Transport: headerTransport{"traceparent", traceparent}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "lookup", Arguments: map[string]any{"name": "api"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "lookup", Arguments: map[string]any{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "no_such_tool"}); err == nil {
+		t.Error("calling an unknown tool succeeded")
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "kuadrant://docs/authpolicy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var toolCalls []sdktrace.ReadOnlySpan
+	var read, child sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "tools/call lookup", "tools/call no_such_tool":
+			toolCalls = append(toolCalls, span)
+		case "resources/read":
+			read = span
+		case "kube get":
+			// the first is the successful call's
+			if child == nil {
+				child = span
+			}
+		}
+	}
+	if len(toolCalls) != 3 || read == nil || child == nil {
+		var names []string
+		for _, span := range recorder.Ended() {
+			names = append(names, span.Name())
+		}
+		t.Fatalf("got spans %v", names)
+	}
+
+	for _, span := range append(toolCalls, read) {
+		if span.SpanKind() != trace.SpanKindServer {
+			t.Errorf("%s: kind %v", span.Name(), span.SpanKind())
+		}
+		// the trace continues from the client's traceparent header
+		if got := span.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" || !span.Parent().IsRemote() {
+			t.Errorf("%s: parent trace %s, remote %v", span.Name(), got, span.Parent().IsRemote())
+		}
+		if v := spanAttr(span, "mcp.session.id"); v != session.ID() {
+			t.Errorf("%s: mcp.session.id = %q, want %s", span.Name(), v, session.ID())
+		}
+	}
+
+	succeeded, failed, invalid := toolCalls[0], toolCalls[1], toolCalls[2]
+	if v := spanAttr(succeeded, "gen_ai.tool.name"); v != "lookup" {
+		t.Errorf("gen_ai.tool.name = %q", v)
+	}
+	if v := spanAttr(succeeded, "mcp.method.name"); v != "tools/call" {
+		t.Errorf("mcp.method.name = %q", v)
+	}
+	if succeeded.Status().Code != codes.Unset {
+		t.Errorf("successful call has status %v", succeeded.Status())
+	}
+	if child.Parent().SpanID() != succeeded.SpanContext().SpanID() {
+		t.Error("the handler's span isn't a child of the request's")
+	}
+	if status := failed.Status(); status.Code != codes.Error || status.Description != "tool returned an error" {
+		t.Errorf("a call returning an error has status %v", status)
+	}
+	if status := invalid.Status(); status.Code != codes.Error || status.Description == "" {
+		t.Errorf("a rejected call has status %v", status)
+	}
+	if len(invalid.Events()) == 0 || invalid.Events()[0].Name != "exception" {
+		t.Error("a rejected call's error isn't recorded")
+	}
+	if v := spanAttr(read, "mcp.resource.uri"); v != "kuadrant://docs/authpolicy" {
+		t.Errorf("mcp.resource.uri = %q", v)
+	}
+}
+
+// spanAttr returns the string value of a span's attribute
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultKuadrantVersion is used when a tool or resource does not specify a release
+const defaultKuadrantVersion = "latest"
+
+// kuadrantRelease describes what a given Kuadrant release ships: the git refs
+// its docs live at, and the policy API versions and spec fields it accepts
+type kuadrantRelease struct {
+	version      string
+	operatorRef  string // kuadrant-operator git ref
+	authorinoRef string // authorino git ref shipped with this release
+	docsVersion  string // docs.kuadrant.io version path segment
+	apis         map[string]policyAPI
+}
+
+// policyAPI is the API version and allowed spec fields of a policy kind
+type policyAPI struct {
+	apiVersion string
+	specFields []string
+	// legacyRates renders rate limits as duration/unit instead of window
+	legacyRates bool
+	// selectors marks APIs whose when conditions are selector, operator
+	// and value, and whose counters are selectors, instead of CEL
+	selectors bool
+}
+
+// v1 policy APIs, shared by all 1.x releases
+var v1PolicyAPIs = map[string]policyAPI{
+	"DNSPolicy": {
+		apiVersion: "kuadrant.io/v1",
+		specFields: []string{"targetRef", "providerRefs", "loadBalancing", "healthCheck", "excludeAddresses"},
+	},
+	"TLSPolicy": {
+		apiVersion: "kuadrant.io/v1alpha1",
+		specFields: []string{"targetRef", "issuerRef", "commonName", "duration", "renewBefore"},
+	},
+	"RateLimitPolicy": {
+		apiVersion: "kuadrant.io/v1",
+		specFields: []string{"targetRef", "limits", "defaults", "overrides", "when"},
+	},
+	"AuthPolicy": {
+		apiVersion: "kuadrant.io/v1",
+		specFields: []string{"targetRef", "rules", "defaults", "overrides"},
+	},
+}
+
+// kuadrantReleases lists the releases docs and manifests can be pinned to
+var kuadrantReleases = map[string]kuadrantRelease{
+	"latest": {
+		version:      "latest",
+		operatorRef:  "main",
+		authorinoRef: "main",
+		docsVersion:  "latest",
+		apis:         v1PolicyAPIs,
+	},
+	"v1.3": {
+		version:      "v1.3",
+		operatorRef:  "v1.3.0",
+		authorinoRef: "v0.22.0",
+		docsVersion:  "1.3.x",
+		apis:         v1PolicyAPIs,
+	},
+	"v1.2": {
+		version:      "v1.2",
+		operatorRef:  "v1.2.0",
+		authorinoRef: "v0.21.0",
+		docsVersion:  "1.2.x",
+		apis:         v1PolicyAPIs,
+	},
+	"v1.1": {
+		version:      "v1.1",
+		operatorRef:  "v1.1.0",
+		authorinoRef: "v0.20.0",
+		docsVersion:  "1.1.x",
+		apis:         v1PolicyAPIs,
+	},
+	"v1.0": {
+		version:      "v1.0",
+		operatorRef:  "v1.0.1",
+		authorinoRef: "v0.20.0",
+		docsVersion:  "1.0.x",
+		apis:         v1PolicyAPIs,
+	},
+	"v0.11": {
+		version:      "v0.11",
+		operatorRef:  "v0.11.0",
+		authorinoRef: "v0.19.0",
+		docsVersion:  "0.11.x",
+		apis: map[string]policyAPI{
+			"DNSPolicy": {
+				apiVersion: "kuadrant.io/v1alpha1",
+				specFields: []string{"targetRef", "providerRefs", "loadBalancing", "healthCheck"},
+			},
+			"TLSPolicy": {
+				apiVersion: "kuadrant.io/v1alpha1",
+				specFields: []string{"targetRef", "issuerRef", "commonName", "duration", "renewBefore"},
+			},
+			"RateLimitPolicy": {
+				apiVersion:  "kuadrant.io/v1beta3",
+				specFields:  []string{"targetRef", "limits", "defaults", "overrides"},
+				legacyRates: true,
+				selectors:   true,
+			},
+			"AuthPolicy": {
+				apiVersion: "kuadrant.io/v1beta3",
+				specFields: []string{"targetRef", "rules", "defaults", "overrides"},
+				selectors:  true,
+			},
+		},
+	},
+}
+
+// lookupRelease resolves a user supplied version such as "1.2", "v1.2" or
+// "v1.2.0" to a known release. An empty version selects the default.
+func lookupRelease(version string) (kuadrantRelease, error) {
+	v := strings.TrimSpace(strings.ToLower(version))
+	if v == "" {
+		v = defaultKuadrantVersion
+	}
+	if v != "latest" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	// accept patch versions by trimming to major.minor
+	if parts := strings.Split(v, "."); len(parts) > 2 {
+		v = strings.Join(parts[:2], ".")
+	}
+
+	release, ok := kuadrantReleases[v]
+	if !ok {
+		return kuadrantRelease{}, fmt.Errorf("unknown Kuadrant version %q (supported: %s)", version, strings.Join(releaseVersions(), ", "))
+	}
+	return release, nil
+}
+
+// releaseVersions returns the supported release versions in a stable order
+func releaseVersions() []string {
+	versions := make([]string, 0, len(kuadrantReleases))
+	for v := range kuadrantReleases {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// checkSpec returns an error if spec sets any field that kind does not
+// support in this release, or writes when conditions or counters in
+// another API version's form
+func (r kuadrantRelease) checkSpec(ctx context.Context, kind string, spec map[string]interface{}) (err error) {
+	_, span := tracer.Start(ctx, "manifest.validate", trace.WithAttributes(
+		attribute.String("k8s.resource.kind", kind),
+		attribute.String("kuadrant.version", r.version),
+	))
+	defer func() { endSpan(span, err) }()
+
+	allowed := make(map[string]bool)
+	for _, field := range r.apis[kind].specFields {
+		allowed[field] = true
+	}
+
+	fields := make([]string, 0, len(spec))
+	for field := range spec {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if !allowed[field] {
+			return fmt.Errorf("%s in Kuadrant %s does not support spec.%s", kind, r.version, field)
+		}
+	}
+	if kind != "RateLimitPolicy" {
+		return nil
+	}
+
+	api := r.apis[kind]
+	for _, section := range []string{"", "defaults", "overrides"} {
+		limits, path := spec["limits"], "limits"
+		if section != "" {
+			sectionSpec, _ := spec[section].(map[string]interface{})
+			limits, path = sectionSpec["limits"], section+".limits"
+		}
+		byName, _ := limits.(map[string]interface{})
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			limit, _ := byName[name].(map[string]interface{})
+			if err := api.checkLimit(limit); err != nil {
+				return fmt.Errorf("%s in Kuadrant %s: spec.%s.%s.%w", kind, r.version, path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimit returns an error if a limit's when conditions or counters
+// aren't in the form of the API version
+func (a policyAPI) checkLimit(limit map[string]interface{}) error {
+	for i, when := range listItems(limit["when"]) {
+		w, _ := when.(map[string]interface{})
+		switch {
+		case a.selectors && w["selector"] == nil:
+			return fmt.Errorf("when[%d] must have a selector, operator and value in %s", i, a.apiVersion)
+		case !a.selectors && w["predicate"] == nil:
+			return fmt.Errorf("when[%d] must be a CEL predicate in %s", i, a.apiVersion)
+		}
+	}
+	for i, counter := range listItems(limit["counters"]) {
+		c, _ := counter.(map[string]interface{})
+		switch _, isSelector := counter.(string); {
+		case a.selectors && !isSelector:
+			return fmt.Errorf("counters[%d] must be a selector in %s", i, a.apiVersion)
+		case !a.selectors && c["expression"] == nil:
+			return fmt.Errorf("counters[%d] must be a CEL expression in %s", i, a.apiVersion)
+		}
+	}
+	return nil
+}
+
+// listItems returns the items of a list decoded from JSON or built by a
+// handler
+func listItems(v interface{}) []interface{} {
+	switch list := v.(type) {
+	case []interface{}:
+		return list
+	case []map[string]interface{}:
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			items[i] = item
+		}
+		return items
+	}
+	return nil
+}
+
+// renderCounters returns counters in the form the release's
+// RateLimitPolicy API expects. Selector APIs take the selector alone.
+func renderCounters(release kuadrantRelease, counters []map[string]interface{}) interface{} {
+	if !release.apis["RateLimitPolicy"].selectors {
+		return counters
+	}
+	selectors := make([]interface{}, 0, len(counters))
+	for _, counter := range counters {
+		if selector, ok := counter["selector"].(string); ok {
+			selectors = append(selectors, selector)
+		} else {
+			selectors = append(selectors, counter)
+		}
+	}
+	return selectors
+}
+
+// legacyRate converts a window such as "60s" into the duration/unit form
+// used by RateLimitPolicy before kuadrant.io/v1. The window must already
+// have passed validateWindow.
+func legacyRate(rate RateLimit) map[string]interface{} {
+	units := map[byte]string{'s': "second", 'm': "minute", 'h': "hour"}
+	duration, _ := strconv.Atoi(rate.Window[:len(rate.Window)-1])
+	return map[string]interface{}{
+		"limit":    rate.Limit,
+		"duration": duration,
+		"unit":     units[rate.Window[len(rate.Window)-1]],
+	}
+}
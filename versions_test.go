@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupRelease(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		errMsg  string
+	}{
+		{"", "latest", ""},
+		{"latest", "latest", ""},
+		{"LATEST", "latest", ""},
+		{"1.2", "v1.2", ""},
+		{"v1.2", "v1.2", ""},
+		{" v1.0.1 ", "v1.0", ""},
+		{"0.11", "v0.11", ""},
+		{"v2.0", "", `unknown Kuadrant version "v2.0" (supported: latest, v0.11, v1.0, v1.1, v1.2, v1.3)`},
+		{"next", "", `unknown Kuadrant version "next"`},
+	}
+	for _, tt := range tests {
+		release, err := lookupRelease(tt.version)
+		switch {
+		case tt.errMsg != "":
+			if err == nil || !strings.HasPrefix(err.Error(), tt.errMsg) {
+				t.Errorf("lookupRelease(%q) error %v, want %q", tt.version, err, tt.errMsg)
+			}
+		case err != nil:
+			t.Errorf("lookupRelease(%q) unexpected error %v", tt.version, err)
+		case release.version != tt.want:
+			t.Errorf("lookupRelease(%q) = %s, want %s", tt.version, release.version, tt.want)
+		}
+	}
+}
+
+func TestCheckSpec(t *testing.T) {
+	tests := []struct {
+		version string
+		kind    string
+		spec    map[string]interface{}
+		errMsg  string
+	}{
+		{"latest", "RateLimitPolicy", map[string]interface{}{"targetRef": nil, "limits": nil}, ""},
+		{"latest", "DNSPolicy", map[string]interface{}{"targetRef": nil, "routingStrategy": nil}, "DNSPolicy in Kuadrant latest does not support spec.routingStrategy"},
+		{"v0.11", "TLSPolicy", map[string]interface{}{"targetRef": nil, "issuerRef": nil, "usages": nil}, "TLSPolicy in Kuadrant v0.11 does not support spec.usages"},
+		// the first unsupported field, in order, is reported
+		{"v1.0", "AuthPolicy", map[string]interface{}{"when": nil, "routeSelectors": nil}, "AuthPolicy in Kuadrant v1.0 does not support spec.routeSelectors"},
+		// fields added in v1
+		{"latest", "DNSPolicy", map[string]interface{}{"targetRef": nil, "excludeAddresses": nil}, ""},
+		{"v0.11", "DNSPolicy", map[string]interface{}{"targetRef": nil, "excludeAddresses": nil}, "DNSPolicy in Kuadrant v0.11 does not support spec.excludeAddresses"},
+		{"v1.2", "RateLimitPolicy", map[string]interface{}{"targetRef": nil, "when": nil}, ""},
+		{"v0.11", "RateLimitPolicy", map[string]interface{}{"targetRef": nil, "when": nil}, "RateLimitPolicy in Kuadrant v0.11 does not support spec.when"},
+		// when and counters take CEL in v1 and selectors in v1beta3
+		{"latest", "RateLimitPolicy", limitSpec("", predicate, expression), ""},
+		{"v0.11", "RateLimitPolicy", limitSpec("", selector, "auth.identity.userid"), ""},
+		{
+			"latest", "RateLimitPolicy", limitSpec("", selector, expression),
+			"RateLimitPolicy in Kuadrant latest: spec.limits.per-user.when[0] must be a CEL predicate in kuadrant.io/v1",
+		},
+		{
+			"v1.0", "RateLimitPolicy", limitSpec("overrides", predicate, "auth.identity.userid"),
+			"RateLimitPolicy in Kuadrant v1.0: spec.overrides.limits.per-user.counters[0] must be a CEL expression in kuadrant.io/v1",
+		},
+		{
+			"v0.11", "RateLimitPolicy", limitSpec("defaults", predicate, "auth.identity.userid"),
+			"RateLimitPolicy in Kuadrant v0.11: spec.defaults.limits.per-user.when[0] must have a selector, operator and value in kuadrant.io/v1beta3",
+		},
+		{
+			"v0.11", "RateLimitPolicy", limitSpec("", selector, expression),
+			"RateLimitPolicy in Kuadrant v0.11: spec.limits.per-user.counters[0] must be a selector in kuadrant.io/v1beta3",
+		},
+	}
+	for _, tt := range tests {
+		err := kuadrantReleases[tt.version].checkSpec(context.Background(), tt.kind, tt.spec)
+		switch {
+		case tt.errMsg == "" && err != nil:
+			t.Errorf("%s %s: unexpected error %v", tt.version, tt.kind, err)
+		case tt.errMsg != "" && (err == nil || err.Error() != tt.errMsg):
+			t.Errorf("%s %s: error %v, want %q", tt.version, tt.kind, err, tt.errMsg)
+		}
+	}
+}
+
+var (
+	predicate  = map[string]interface{}{"predicate": `request.method == "GET"`}
+	selector   = map[string]interface{}{"selector": "request.method", "operator": "eq", "value": "GET"}
+	expression = map[string]interface{}{"expression": "auth.identity.userid"}
+)
+
+// limitSpec returns a RateLimitPolicy spec with a per-user limit, in
+// section (defaults or overrides) if set, as a handler builds it
+func limitSpec(section string, when map[string]interface{}, counter interface{}) map[string]interface{} {
+	limits := map[string]interface{}{
+		"per-user": map[string]interface{}{
+			"when":     []map[string]interface{}{when},
+			"counters": []interface{}{counter},
+		},
+	}
+	if section == "" {
+		return map[string]interface{}{"targetRef": nil, "limits": limits}
+	}
+	return map[string]interface{}{"targetRef": nil, section: map[string]interface{}{"limits": limits}}
+}
+
+func TestRenderCounters(t *testing.T) {
+	counters := []map[string]interface{}{{"selector": "auth.identity.userid"}, expression}
+	if got := renderCounters(kuadrantReleases["latest"], counters); !reflect.DeepEqual(got, counters) {
+		t.Errorf("latest: got %v, want the counters unchanged", got)
+	}
+	want := []interface{}{"auth.identity.userid", expression}
+	if got := renderCounters(kuadrantReleases["v0.11"], counters); !reflect.DeepEqual(got, want) {
+		t.Errorf("v0.11: got %v, want %v", got, want)
+	}
+}
+
+func TestLegacyRate(t *testing.T) {
+	tests := []struct {
+		rate RateLimit
+		want map[string]interface{}
+	}{
+		{RateLimit{Limit: 10, Window: "60s"}, map[string]interface{}{"limit": 10, "duration": 60, "unit": "second"}},
+		{RateLimit{Limit: 100, Window: "5m"}, map[string]interface{}{"limit": 100, "duration": 5, "unit": "minute"}},
+		{RateLimit{Limit: 1000, Window: "24h"}, map[string]interface{}{"limit": 1000, "duration": 24, "unit": "hour"}},
+	}
+	for _, tt := range tests {
+		if got := legacyRate(tt.rate); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("legacyRate(%+v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestParseDocURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want docRef
+		ok   bool
+	}{
+		{"kuadrant://docs/dnspolicy", docRef{uri: "kuadrant://docs/dnspolicy"}, true},
+		{"kuadrant://docs/v1.2/dnspolicy", docRef{uri: "kuadrant://docs/dnspolicy", version: "v1.2"}, true},
+		{"kuadrant://docs/v1.2/dnspolicy#health-checks", docRef{uri: "kuadrant://docs/dnspolicy", version: "v1.2", section: "health-checks"}, true},
+		{"kuadrant://toc/dnspolicy", docRef{uri: "kuadrant://docs/dnspolicy"}, true},
+		{"kuadrant://manifests/gateway", docRef{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDocURI(tt.uri)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseDocURI(%q) = %+v, %v, want %+v, %v", tt.uri, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDocSourceURLs(t *testing.T) {
+	operator := docSource{repo: "kuadrant-operator", path: "doc/reference/dnspolicy.md", docsPath: "kuadrant-operator/doc/reference/dnspolicy/"}
+	authorino := docSource{repo: "authorino", path: "docs/features.md"}
+	mirrored := docSource{repo: "kuadrant-operator", path: "README.md", baseURL: "file:///srv/mirror"}
+	fixed := docSource{url: "https://example.com/guide.md", docsUrl: "https://example.com/guide"}
+
+	tests := []struct {
+		source          docSource
+		version         string
+		rawURL, docsURL string
+	}{
+		{operator, "latest", "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/main/doc/reference/dnspolicy.md", "https://docs.kuadrant.io/latest/kuadrant-operator/doc/reference/dnspolicy/"},
+		{operator, "v1.2", "https://raw.githubusercontent.com/Kuadrant/kuadrant-operator/v1.2.0/doc/reference/dnspolicy.md", "https://docs.kuadrant.io/1.2.x/kuadrant-operator/doc/reference/dnspolicy/"},
+		{authorino, "v1.2", "https://raw.githubusercontent.com/Kuadrant/authorino/v0.21.0/docs/features.md", ""},
+		{mirrored, "v1.1", "file:///srv/mirror/kuadrant-operator/v1.1.0/README.md", ""},
+		{fixed, "v1.0", "https://example.com/guide.md", "https://example.com/guide"},
+	}
+	for _, tt := range tests {
+		release := kuadrantReleases[tt.version]
+		if got := tt.source.rawURL(release); got != tt.rawURL {
+			t.Errorf("rawURL(%s) = %s, want %s", tt.version, got, tt.rawURL)
+		}
+		if got := tt.source.docsURL(release); got != tt.docsURL {
+			t.Errorf("docsURL(%s) = %s, want %s", tt.version, got, tt.docsURL)
+		}
+	}
+}
+
+func TestCreateRateLimitPolicyForRelease(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+		notWant []string
+		errMsg  string
+	}{
+		{"latest", []string{"apiVersion: kuadrant.io/v1\n", "window: 60s"}, []string{"duration:"}, ""},
+		{"v0.11", []string{"apiVersion: kuadrant.io/v1beta3", "duration: 60", "unit: second"}, []string{"window:"}, ""},
+		{"v9", nil, nil, `Error: unknown Kuadrant version "v9"`},
+	}
+	for _, tt := range tests {
+		out, err := createRateLimitPolicyHandler(context.Background(), CreateRateLimitPolicyParams{
+			Name:            "rl",
+			Namespace:       "ns",
+			TargetRef:       map[string]interface{}{"group": "gateway.networking.k8s.io", "kind": "Gateway", "name": "gw"},
+			Limits:          map[string]LimitDefinition{"global": {Rates: []RateLimit{{Limit: 10, Window: "60s"}}}},
+			KuadrantVersion: tt.version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.errMsg != "" {
+			if !strings.HasPrefix(out, tt.errMsg) {
+				t.Errorf("%s: got %q, want prefix %q", tt.version, out, tt.errMsg)
+			}
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: missing %q in:\n%s", tt.version, want, out)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(out, notWant) {
+				t.Errorf("%s: unexpected %q in:\n%s", tt.version, notWant, out)
+			}
+		}
+	}
+}